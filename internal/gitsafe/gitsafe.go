@@ -0,0 +1,74 @@
+// Package gitsafe keeps git from running programs configured in a repository. Sandboxed
+// commands can write to the workspace, so its git configuration and hooks must not be
+// trusted by git commands running outside of the sandbox.
+package gitsafe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// NoHooks disables the hooks of the repository.
+var NoHooks = []string{"-c", "core.hooksPath=/dev/null"}
+
+// Args returns the options passed to git in dir before the command: core.fsmonitor is
+// disabled and the clean, smudge and process commands of filters defined in the
+// configuration of the repository are emptied. Filters of the global and system
+// configuration, e.g. the one of git-lfs, are set up by the user and keep working.
+func Args(ctx context.Context, dir string, env []string) []string {
+	args := []string{"-c", "core.fsmonitor=false"}
+	for _, name := range repositoryFilters(ctx, dir, env) {
+		for _, key := range []string{"clean", "smudge", "process"} {
+			args = append(args, "-c", "filter."+name+"."+key+"=")
+		}
+		args = append(args, "-c", "filter."+name+".required=false")
+	}
+	return args
+}
+
+// repositoryFilters returns the names of the filters configured in the local or worktree
+// configuration of the repository in dir.
+func repositoryFilters(ctx context.Context, dir string, env []string) []string {
+	cmd := exec.CommandContext(ctx, "git", "-c", "core.fsmonitor=false", "config", "--show-scope", "--name-only", "--get-regexp", `^filter\.`)
+	cmd.Dir = dir
+	cmd.Env = env
+	out, err := cmd.Output()
+	if err != nil {
+		// Without any filter, git config exits with 1
+		return nil
+	}
+	var names []string
+	for line := range strings.Lines(string(out)) {
+		scope, key, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok || scope != "local" && scope != "worktree" {
+			continue
+		}
+		key = strings.TrimPrefix(key, "filter.")
+		name := key[:max(strings.LastIndexByte(key, '.'), 0)]
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Dirs returns the absolute git directory and common git directory of the repository
+// containing dir. They differ in linked worktrees.
+func Dirs(ctx context.Context, dir string) (gitDir, commonDir string, err error) {
+	cmd := exec.CommandContext(ctx, "git", "-c", "core.fsmonitor=false", "rev-parse", "--path-format=absolute", "--git-dir", "--git-common-dir")
+	cmd.Dir = dir
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", "", err
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 {
+		return "", "", fmt.Errorf("unexpected output of git rev-parse: %q", stdout.String())
+	}
+	return lines[0], lines[1], nil
+}
@@ -0,0 +1,58 @@
+package gitsafe
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+}
+
+// TestArgs tests that hooks and filters planted in a repository do not run.
+func TestArgs(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(t.TempDir(), "pwned")
+	git(t, dir, "init", "-q")
+	git(t, dir, "config", "filter.evil.clean", "touch "+marker+"; cat")
+	git(t, dir, "config", "filter.evil.required", "true")
+	hook := "#!/bin/sh\ntouch " + marker + "\n"
+	if err := os.WriteFile(filepath.Join(dir, ".git", "hooks", "pre-commit"), []byte(hook), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".gitattributes"), []byte("*.txt filter=evil\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	args := slices.Concat(NoHooks, Args(context.Background(), dir, os.Environ()))
+	git(t, dir, append(args, "add", ".")...)
+	git(t, dir, append(args, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "a")...)
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("A hook or filter of the repository was run")
+	}
+}
+
+func TestDirs(t *testing.T) {
+	dir := t.TempDir()
+	git(t, dir, "init", "-q")
+	gitDir, commonDir, err := Dirs(context.Background(), dir)
+	want, _ := filepath.EvalSymlinks(filepath.Join(dir, ".git"))
+	if got, _ := filepath.EvalSymlinks(gitDir); err != nil || got != want || gitDir != commonDir {
+		t.Errorf("Dirs = %s, %s, %v", gitDir, commonDir, err)
+	}
+	if _, _, err := Dirs(context.Background(), t.TempDir()); err == nil {
+		t.Error("Expected an error outside of a repository")
+	}
+}
@@ -0,0 +1,210 @@
+// Package output keeps command output within the limits of a model's context.
+// Long output is shortened to its head and tail, and the full text is kept
+// as MCP resource run://<id>/<stream> which can be read page by page.
+package output
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// URITemplate is the template of the resources holding full outputs.
+const URITemplate = "run://{id}/{stream}{?offset,limit}"
+
+// DefaultMaxRuns is the number of full outputs kept by default.
+const DefaultMaxRuns = 64
+
+// Limits caps the output returned in tool results. Zero values disable a cap.
+type Limits struct {
+	MaxBytes int
+	MaxLines int
+}
+
+// DefaultLimits returns the limits used unless configured otherwise.
+func DefaultLimits() Limits {
+	return Limits{MaxBytes: 32 << 10, MaxLines: 400}
+}
+
+// URI returns the URI of the resource holding stream of run id.
+func URI(id, stream string) string {
+	return "run://" + id + "/" + stream
+}
+
+// Truncate shortens text to the limits by keeping its head and tail.
+// The omitted middle is replaced by a marker referring to uri, if any. It reports whether text was shortened.
+func (l Limits) Truncate(text, uri string) (string, bool) {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	tooLong := l.MaxBytes > 0 && len(text) > l.MaxBytes
+	tooManyLines := l.MaxLines > 0 && len(lines) > l.MaxLines
+	if !tooLong && !tooManyLines {
+		return text, false
+	}
+
+	head, tail := text, text
+	if tooManyLines {
+		head = strings.Join(lines[:l.MaxLines/2], "")
+		tail = strings.Join(lines[len(lines)-(l.MaxLines-l.MaxLines/2):], "")
+	}
+	if l.MaxBytes > 0 {
+		head = prefix(head, l.MaxBytes/2)
+		tail = suffix(tail, l.MaxBytes-l.MaxBytes/2)
+	}
+
+	omitted := text[len(head) : len(text)-len(tail)]
+	marker := fmt.Sprintf("[... %d lines (%d bytes) omitted", strings.Count(omitted, "\n"), len(omitted))
+	if uri != "" {
+		marker += ", full output: " + uri
+	}
+	marker += " ...]\n"
+	if head != "" && !strings.HasSuffix(head, "\n") {
+		marker = "\n" + marker
+	}
+	return head + marker + tail, true
+}
+
+// prefix returns the longest prefix of s within n bytes, preferably ending at a line break.
+func prefix(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if i := strings.LastIndexByte(s[:n], '\n'); i >= 0 {
+		return s[:i+1]
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// suffix returns the longest suffix of s within n bytes, preferably starting after a line break.
+func suffix(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	start := len(s) - n
+	if s[start-1] == '\n' {
+		return s[start:]
+	}
+	if i := strings.IndexByte(s[start:], '\n'); i >= 0 && start+i+1 < len(s) {
+		return s[start+i+1:]
+	}
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return s[start:]
+}
+
+// Store keeps the full output of the most recent shortened runs in memory.
+type Store struct {
+	limits  Limits
+	maxRuns int
+
+	mu    sync.Mutex
+	runs  map[string]map[string]string
+	order []string
+}
+
+// NewStore returns a Store shortening output to limits and keeping the output of maxRuns runs.
+func NewStore(limits Limits, maxRuns int) *Store {
+	return &Store{limits: limits, maxRuns: maxRuns, runs: make(map[string]map[string]string)}
+}
+
+// Shorten truncates stdout and stderr in place. If any of them was shortened, both are kept
+// in full and the ID of the run is returned; otherwise the ID is empty.
+func (s *Store) Shorten(stdout, stderr *string) string {
+	id := newID()
+	full := map[string]string{"stdout": *stdout, "stderr": *stderr}
+	var truncated bool
+	for stream, p := range map[string]*string{"stdout": stdout, "stderr": stderr} {
+		var ok bool
+		*p, ok = s.limits.Truncate(*p, URI(id, stream))
+		truncated = truncated || ok
+	}
+	if !truncated {
+		return ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[id] = full
+	s.order = append(s.order, id)
+	for len(s.order) > s.maxRuns {
+		delete(s.runs, s.order[0])
+		s.order = s.order[1:]
+	}
+	return id
+}
+
+// Template returns the resource template to register together with [Store.ReadResource].
+func (s *Store) Template() *mcp.ResourceTemplate {
+	return &mcp.ResourceTemplate{
+		Name:        "run-output",
+		Title:       "Full output of a command",
+		Description: "The full stdout or stderr of a command whose result was shortened. Use offset and limit to read a range of lines.",
+		MIMEType:    "text/plain",
+		URITemplate: URITemplate,
+	}
+}
+
+// ReadResource returns the output of a run, optionally restricted to limit lines starting at line offset.
+func (s *Store) ReadResource(_ context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	u, err := url.Parse(req.Params.URI)
+	if err != nil || u.Scheme != "run" {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	s.mu.Lock()
+	text, ok := s.runs[u.Host][strings.TrimPrefix(u.Path, "/")]
+	s.mu.Unlock()
+	if !ok {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+
+	query := u.Query()
+	if query.Has("offset") || query.Has("limit") {
+		offset, err := strconv.Atoi(query.Get("offset"))
+		if err != nil && query.Has("offset") || offset < 0 {
+			return nil, fmt.Errorf("invalid offset %q", query.Get("offset"))
+		}
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil && query.Has("limit") || limit < 0 {
+			return nil, fmt.Errorf("invalid limit %q", query.Get("limit"))
+		}
+		text = lineRange(text, offset, limit)
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{
+			{URI: req.Params.URI, MIMEType: "text/plain", Text: text},
+		},
+	}, nil
+}
+
+// lineRange returns limit lines of text starting at line offset (counted from 0), all remaining if limit is 0.
+func lineRange(text string, offset, limit int) string {
+	lines := strings.SplitAfter(text, "\n")
+	if offset >= len(lines) {
+		return ""
+	}
+	lines = lines[offset:]
+	if limit > 0 && limit < len(lines) {
+		lines = lines[:limit]
+	}
+	return strings.Join(lines, "")
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
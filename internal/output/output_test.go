@@ -0,0 +1,113 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func numberedLines(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name      string
+		limits    Limits
+		text      string
+		expected  string
+		truncated bool
+	}{
+		{"Within limits", Limits{MaxBytes: 100, MaxLines: 10}, numberedLines(3), numberedLines(3), false},
+		{"No limits", Limits{}, numberedLines(100), numberedLines(100), false},
+		{"Too many lines", Limits{MaxLines: 4}, numberedLines(10),
+			"line 1\nline 2\n[... 6 lines (42 bytes) omitted, full output: run://x/stdout ...]\nline 9\nline 10\n", true},
+		{"Too many bytes", Limits{MaxBytes: 30}, numberedLines(10),
+			"line 1\nline 2\n[... 6 lines (42 bytes) omitted, full output: run://x/stdout ...]\nline 9\nline 10\n", true},
+		{"Too many bytes within line", Limits{MaxBytes: 32}, numberedLines(10),
+			"line 1\nline 2\n[... 6 lines (42 bytes) omitted, full output: run://x/stdout ...]\nline 9\nline 10\n", true},
+		{"Single long line", Limits{MaxBytes: 10}, strings.Repeat("ä", 20),
+			"ää\n[... 0 lines (32 bytes) omitted, full output: run://x/stdout ...]\nää", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, truncated := tc.limits.Truncate(tc.text, "run://x/stdout")
+			if result != tc.expected || truncated != tc.truncated {
+				t.Errorf("Expected (%q, %v), got (%q, %v)", tc.expected, tc.truncated, result, truncated)
+			}
+		})
+	}
+}
+
+func TestTruncateWithoutURI(t *testing.T) {
+	result, _ := Limits{MaxLines: 2}.Truncate(numberedLines(3), "")
+	if expected := "line 1\n[... 1 lines (7 bytes) omitted ...]\nline 3\n"; result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore(Limits{MaxLines: 4}, 1)
+
+	stdout, stderr := "ok\n", "warning\n"
+	if id := store.Shorten(&stdout, &stderr); id != "" || stdout != "ok\n" {
+		t.Errorf("Short output was stored as %q: %q", id, stdout)
+	}
+
+	full := numberedLines(10)
+	stdout = full
+	id := store.Shorten(&stdout, &stderr)
+	if id == "" || !strings.Contains(stdout, URI(id, "stdout")) {
+		t.Fatalf("Long output was not shortened: %q, %q", id, stdout)
+	}
+
+	srv := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	srv.AddResourceTemplate(store.Template(), store.ReadResource)
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	ss, err := srv.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect server: %v", err)
+	}
+	defer ss.Close()
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil).Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer cs.Close()
+
+	tests := []struct {
+		uri      string
+		expected string
+	}{
+		{URI(id, "stdout"), full},
+		{URI(id, "stderr"), "warning\n"},
+		{URI(id, "stdout") + "?offset=2&limit=2", "line 3\nline 4\n"},
+		{URI(id, "stdout") + "?offset=8", "line 9\nline 10\n"},
+	}
+	for _, tc := range tests {
+		result, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: tc.uri})
+		if err != nil {
+			t.Errorf("Failed to read %s: %v", tc.uri, err)
+			continue
+		}
+		if text := result.Contents[0].Text; text != tc.expected {
+			t.Errorf("Expected %q for %s, got %q", tc.expected, tc.uri, text)
+		}
+	}
+
+	// Only the most recent run is kept
+	stdout = full
+	store.Shorten(&stdout, &stderr)
+	if _, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: URI(id, "stdout")}); err == nil {
+		t.Errorf("Expected evicted run to be gone")
+	}
+}
@@ -0,0 +1,15 @@
+// Package patterns parses the comma-separated lists of patterns given in flags.
+package patterns
+
+import "strings"
+
+// Split splits a comma-separated list of patterns, dropping surrounding spaces and empty entries.
+func Split(s string) []string {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
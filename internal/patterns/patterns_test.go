@@ -0,0 +1,22 @@
+package patterns
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", nil},
+		{"test", []string{"test"}},
+		{" build, lint-* ,,test ", []string{"build", "lint-*", "test"}},
+	}
+	for _, tc := range tests {
+		if got := Split(tc.input); !slices.Equal(got, tc.want) {
+			t.Errorf("Split(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
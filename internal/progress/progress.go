@@ -0,0 +1,112 @@
+// Package progress streams the output of running commands to MCP clients
+// as progress and logging notifications.
+package progress
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// interval batches output lines, so a noisy command does not send a notification per line.
+const interval = 250 * time.Millisecond
+
+type line struct {
+	stream string
+	text   string
+}
+
+// Reporter sends output lines of a tool call to the client. It is safe for concurrent use.
+// A nil Reporter discards all lines.
+type Reporter struct {
+	ctx     context.Context
+	session *mcp.ServerSession
+	token   any
+	logger  string
+
+	mu      sync.Mutex
+	pending []line
+	timer   *time.Timer
+	count   int
+}
+
+// New returns a Reporter for the tool call req, or nil if the client did not ask for progress.
+// logger names the source of the logging notifications.
+func New(ctx context.Context, req *mcp.CallToolRequest, logger string) *Reporter {
+	if req == nil || req.Session == nil || req.Params == nil {
+		return nil
+	}
+	token := req.Params.GetProgressToken()
+	if token == nil {
+		return nil
+	}
+	return &Reporter{ctx: ctx, session: req.Session, token: token, logger: logger}
+}
+
+// Line queues a line of the given stream ("stdout" or "stderr") for the next notification.
+func (r *Reporter) Line(stream, text string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = append(r.pending, line{stream, text})
+	if r.timer == nil {
+		r.timer = time.AfterFunc(interval, r.Flush)
+	}
+}
+
+// Flush sends all queued lines. It has to be called once the command has finished.
+func (r *Reporter) Flush() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	if len(r.pending) == 0 {
+		return
+	}
+
+	var message strings.Builder
+	for _, l := range r.pending {
+		message.WriteString(l.text)
+		message.WriteByte('\n')
+	}
+	r.count += len(r.pending)
+	// Errors are ignored: the command keeps running if the client went away.
+	r.session.NotifyProgress(r.ctx, &mcp.ProgressNotificationParams{
+		ProgressToken: r.token,
+		Progress:      float64(r.count),
+		Message:       strings.TrimSuffix(message.String(), "\n"),
+	})
+
+	// Consecutive lines of the same stream form one log message
+	for start := 0; start < len(r.pending); {
+		end := start + 1
+		for end < len(r.pending) && r.pending[end].stream == r.pending[start].stream {
+			end++
+		}
+		texts := make([]string, 0, end-start)
+		for _, l := range r.pending[start:end] {
+			texts = append(texts, l.text)
+		}
+		level := mcp.LoggingLevel("info")
+		if r.pending[start].stream == "stderr" {
+			level = "warning"
+		}
+		r.session.Log(r.ctx, &mcp.LoggingMessageParams{
+			Level:  level,
+			Logger: r.logger,
+			Data:   strings.Join(texts, "\n"),
+		})
+		start = end
+	}
+	r.pending = r.pending[:0]
+}
@@ -0,0 +1,78 @@
+package progress
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type noArgs struct{}
+
+func TestReporter(t *testing.T) {
+	srv := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(srv, &mcp.Tool{Name: "run"}, func(ctx context.Context, req *mcp.CallToolRequest, args noArgs) (*mcp.CallToolResult, any, error) {
+		reporter := New(ctx, req, "test")
+		defer reporter.Flush()
+		reporter.Line("stdout", "compiling")
+		reporter.Line("stderr", "warning: unused")
+		reporter.Line("stdout", "done")
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "ok"}}}, nil, nil
+	})
+
+	var mu sync.Mutex
+	var progress, logs []string
+	client := mcp.NewClient(&mcp.Implementation{Name: "client"}, &mcp.ClientOptions{
+		ProgressNotificationHandler: func(ctx context.Context, req *mcp.ProgressNotificationClientRequest) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress = append(progress, req.Params.Message)
+		},
+		LoggingMessageHandler: func(ctx context.Context, req *mcp.LoggingMessageRequest) {
+			mu.Lock()
+			defer mu.Unlock()
+			logs = append(logs, string(req.Params.Level)+": "+req.Params.Data.(string))
+		},
+	})
+
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	ss, err := srv.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect server: %v", err)
+	}
+	defer ss.Close()
+	cs, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer cs.Close()
+	if err := cs.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: "info"}); err != nil {
+		t.Fatalf("Failed to set logging level: %v", err)
+	}
+
+	// Without progress token nothing is reported
+	if _, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "run"}); err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	// SetProgressToken does not allocate the metadata, so set it directly
+	params := &mcp.CallToolParams{Name: "run", Meta: mcp.Meta{"progressToken": "token"}}
+	if _, err := cs.CallTool(ctx, params); err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+
+	// Notifications are delivered asynchronously, so close the session to wait for them
+	cs.Close()
+	ss.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(progress, "|") != "compiling\nwarning: unused\ndone" {
+		t.Errorf("Unexpected progress notifications: %q", progress)
+	}
+	if strings.Join(logs, "|") != "info: compiling|warning: warning: unused|info: done" {
+		t.Errorf("Unexpected log messages: %q", logs)
+	}
+}
@@ -0,0 +1,149 @@
+package runner
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultEnv lists the environment variables passed to commands unless configured otherwise.
+// Entries are patterns in the syntax of [path.Match].
+var DefaultEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "LANG", "LC_*", "TZ", "TERM", "TMPDIR", "XDG_CACHE_HOME", "XDG_CONFIG_HOME",
+	"GOPATH", "GOROOT", "GOCACHE", "GOMODCACHE", "GOPROXY", "GOPRIVATE", "GONOSUMDB", "GOTOOLCHAIN",
+	"CARGO_HOME", "RUSTUP_HOME", "JAVA_HOME", "VIRTUAL_ENV", "NVM_DIR",
+}
+
+// DefaultCallEnv lists the environment variables a tool call may set unless configured otherwise.
+var DefaultCallEnv = []string{
+	"GOFLAGS", "CGO_ENABLED", "GOOS", "GOARCH", "GOEXPERIMENT", "GODEBUG", "GOMAXPROCS",
+	"VERBOSE", "V", "DEBUG", "CI", "NO_COLOR", "RUST_BACKTRACE", "RUST_LOG", "NODE_ENV",
+}
+
+// DefaultSecretEnv lists the names of environment variables which likely hold credentials.
+var DefaultSecretEnv = []string{
+	"*TOKEN*", "*SECRET*", "*PASSWORD*", "*PASSWD*", "*_KEY", "*_KEY_*", "*APIKEY*", "*CREDENTIAL*", "*_AUTH", "*_AUTH_*",
+	"SSH_AUTH_SOCK", "GPG_AGENT_INFO", "NETRC", "GIT_ASKPASS", "SSH_ASKPASS",
+}
+
+// envName matches valid names of environment variables.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// safeGoFlags lists the flags GOFLAGS set by a call may contain. Many other flags, like
+// -toolexec, -exec or -ldflags=-extld=..., run other programs or replace source and
+// module files.
+var safeGoFlags = []string{"a", "buildvcs", "count", "cover", "covermode", "failfast", "json", "mod", "p", "race", "short", "tags", "timeout", "trimpath", "v", "vet"}
+
+// EnvPolicy decides the environment of commands. All lists but Set hold patterns in the syntax of [path.Match].
+type EnvPolicy struct {
+	// Pass lists the variables of the server passed to commands.
+	Pass []string
+	// Set lists variables as NAME=value which are always set, overriding passed ones.
+	Set []string
+	// Allow lists the variables a tool call may set.
+	Allow []string
+	// Secrets lists variables which are never passed nor set by a call, even if Pass or Allow match.
+	// Variables in Set are kept, as they are configured explicitly.
+	Secrets []string
+}
+
+// DefaultEnvPolicy passes [DefaultEnv], lets calls set [DefaultCallEnv] and scrubs [DefaultSecretEnv].
+func DefaultEnvPolicy() EnvPolicy {
+	return EnvPolicy{Pass: DefaultEnv, Allow: DefaultCallEnv, Secrets: DefaultSecretEnv}
+}
+
+// Check validates the fixed variables and the variables requested by a call.
+func (p EnvPolicy) Check(env map[string]string) error {
+	for _, kv := range p.Set {
+		if name, _, ok := strings.Cut(kv, "="); !ok || !envName.MatchString(name) {
+			return fmt.Errorf("invalid environment variable '%s', expected NAME=value", kv)
+		}
+	}
+	for name, value := range env {
+		switch {
+		case !envName.MatchString(name):
+			return fmt.Errorf("invalid environment variable name '%s'", name)
+		case strings.ContainsRune(value, 0):
+			return fmt.Errorf("value of environment variable '%s' contains a NUL byte", name)
+		case slices.ContainsFunc(p.Set, func(kv string) bool { return strings.HasPrefix(kv, name+"=") }):
+			return fmt.Errorf("environment variable '%s' is fixed by the server", name)
+		case !matchAny(p.Allow, name) || matchAny(p.Secrets, name):
+			return fmt.Errorf("environment variable '%s' may not be set, allowed variables: %s", name, strings.Join(p.Allow, ", "))
+		case name == "GOFLAGS":
+			if err := checkGoFlags(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkGoFlags returns an error if value contains a flag which is not in safeGoFlags.
+func checkGoFlags(value string) error {
+	for _, field := range strings.Fields(value) {
+		// Quotes would change how go splits the flags
+		name, _, _ := strings.Cut(strings.TrimLeft(field, "-"), "=")
+		if !strings.HasPrefix(field, "-") || strings.ContainsAny(field, `"'`) || !slices.Contains(safeGoFlags, name) {
+			return fmt.Errorf("GOFLAGS may not contain '%s', allowed flags are -%s", field, strings.Join(safeGoFlags, ", -"))
+		}
+	}
+	return nil
+}
+
+// Environ returns the environment of a command: the variables of environ matching Pass but no secret,
+// followed by the fixed variables and the variables requested by the call.
+func (p EnvPolicy) Environ(environ []string, env map[string]string) ([]string, error) {
+	if err := p.Check(env); err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, kv := range FilterEnv(environ, p.Pass) {
+		name, _, _ := strings.Cut(kv, "=")
+		if matchAny(p.Secrets, name) || slices.ContainsFunc(p.Set, func(kv string) bool { return strings.HasPrefix(kv, name+"=") }) {
+			continue
+		}
+		if _, ok := env[name]; ok {
+			continue
+		}
+		result = append(result, kv)
+	}
+	result = append(result, p.Set...)
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		result = append(result, name+"="+env[name])
+	}
+	return result, nil
+}
+
+// FilterEnv returns the variables of environ whose names match one of the patterns.
+func FilterEnv(environ []string, patterns []string) []string {
+	filtered := []string{}
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if matchAny(patterns, name) {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatEnv renders env as sorted shell-like assignments, e.g. for approval prompts.
+// The result ends with a space unless env is empty, so it can be put in front of a command.
+func FormatEnv(env map[string]string) string {
+	var b strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		fmt.Fprintf(&b, "%s=%q ", name, env[name])
+	}
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterEnv(t *testing.T) {
+	environ := []string{"PATH=/bin", "LC_ALL=C", "AWS_SECRET_ACCESS_KEY=x", "HOME=/home/me", "PATHOLOGY=1"}
+	expected := []string{"PATH=/bin", "LC_ALL=C", "HOME=/home/me"}
+	if filtered := FilterEnv(environ, DefaultEnv); !reflect.DeepEqual(filtered, expected) {
+		t.Errorf("Expected %q, got %q", expected, filtered)
+	}
+}
+
+func TestEnvPolicy(t *testing.T) {
+	policy := DefaultEnvPolicy()
+	policy.Pass = append(policy.Pass, "*")
+	policy.Set = []string{"LANG=C.UTF-8", "NPM_TOKEN=fixed"}
+	environ := []string{"PATH=/bin", "LANG=de_DE", "GITHUB_TOKEN=x", "SSH_AUTH_SOCK=/tmp/agent", "GOFLAGS=-mod=mod", "EDITOR=vi"}
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected []string
+		wantErr  bool
+	}{
+		{"Without call variables", nil, []string{"PATH=/bin", "GOFLAGS=-mod=mod", "EDITOR=vi", "LANG=C.UTF-8", "NPM_TOKEN=fixed"}, false},
+		{"Call overrides passed variable", map[string]string{"GOFLAGS": "-v", "VERBOSE": "1"}, []string{"PATH=/bin", "EDITOR=vi", "LANG=C.UTF-8", "NPM_TOKEN=fixed", "GOFLAGS=-v", "VERBOSE=1"}, false},
+		{"Not allowed", map[string]string{"LD_PRELOAD": "/tmp/x.so"}, nil, true},
+		{"Fixed variable", map[string]string{"LANG": "C"}, nil, true},
+		{"Invalid name", map[string]string{"A=B": "1"}, nil, true},
+		{"NUL byte", map[string]string{"DEBUG": "1\x00"}, nil, true},
+		{"Harmless go flags", map[string]string{"GOFLAGS": "-mod=mod -tags=execution -race"}, []string{"PATH=/bin", "EDITOR=vi", "LANG=C.UTF-8", "NPM_TOKEN=fixed", "GOFLAGS=-mod=mod -tags=execution -race"}, false},
+		{"Toolexec in GOFLAGS", map[string]string{"GOFLAGS": "-toolexec=/tmp/x"}, nil, true},
+		{"Exec in GOFLAGS", map[string]string{"GOFLAGS": "-v --exec /tmp/x"}, nil, true},
+		{"Quoted overlay in GOFLAGS", map[string]string{"GOFLAGS": `"-overlay=/tmp/o.json"`}, nil, true},
+		{"Modfile in GOFLAGS", map[string]string{"GOFLAGS": "-mod=mod\t-modfile=/tmp/go.mod"}, nil, true},
+		{"Vettool in GOFLAGS", map[string]string{"GOFLAGS": "-vettool=/bin/sh"}, nil, true},
+		{"External linker in GOFLAGS", map[string]string{"GOFLAGS": "-ldflags=-linkmode=external -extld=/tmp/x"}, nil, true},
+		{"Linker flags with quotes in GOFLAGS", map[string]string{"GOFLAGS": `-tags=x "-ldflags=-extld=/tmp/x"`}, nil, true},
+		{"Gcflags in GOFLAGS", map[string]string{"GOFLAGS": "-gcflags=all=-N"}, nil, true},
+		{"Pkgdir in GOFLAGS", map[string]string{"GOFLAGS": "-pkgdir=/tmp/pkg"}, nil, true},
+		{"Argument without flag in GOFLAGS", map[string]string{"GOFLAGS": "-race /tmp/x"}, nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := policy.Environ(environ, tc.env)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+
+	secret := policy
+	secret.Allow = []string{"*"}
+	if err := secret.Check(map[string]string{"AWS_SECRET_ACCESS_KEY": "x"}); err == nil {
+		t.Errorf("Expected secret variable to be rejected")
+	}
+}
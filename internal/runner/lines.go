@@ -0,0 +1,42 @@
+package runner
+
+import "bytes"
+
+// maxLineLength is the length after which an unterminated line is passed on anyway.
+const maxLineLength = 64 << 10
+
+// LineWriter is an io.Writer calling a function for every line written to it.
+// It is not safe for concurrent use.
+type LineWriter struct {
+	fn  func(line string)
+	buf []byte
+}
+
+// NewLineWriter returns a LineWriter calling fn with each line without its line break.
+func NewLineWriter(fn func(line string)) *LineWriter {
+	return &LineWriter{fn: fn}
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			if len(w.buf) >= maxLineLength {
+				w.fn(string(w.buf))
+				w.buf = w.buf[:0]
+			}
+			return len(p), nil
+		}
+		w.fn(string(bytes.TrimSuffix(w.buf[:i], []byte{'\r'})))
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Flush passes on a final line which was not terminated by a line break.
+func (w *LineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.fn(string(w.buf))
+		w.buf = nil
+	}
+}
@@ -0,0 +1,20 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := NewLineWriter(func(line string) { lines = append(lines, line) })
+	for _, chunk := range []string{"first", " line\nsecond\r\n", "\nthi", "rd"} {
+		w.Write([]byte(chunk))
+	}
+	w.Flush()
+
+	expected := []string{"first line", "second", "", "third"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %q, got %q", expected, lines)
+	}
+}
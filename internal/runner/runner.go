@@ -0,0 +1,51 @@
+// Package runner starts external commands which are bound to a context.
+// Each command runs in its own process group, so cancelling the context
+// terminates the command together with every process it spawned.
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// waitDelay bounds how long Wait blocks for output pipes after the command was killed.
+const waitDelay = 2 * time.Second
+
+// Status describes how a command ended.
+type Status struct {
+	ExitCode int
+	TimedOut bool
+	Canceled bool
+}
+
+// Command returns a command running name in a new process group.
+// When ctx is done, the whole process group is killed.
+func Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.WaitDelay = waitDelay
+	return cmd
+}
+
+// Run runs cmd, created by [Command] with ctx, and reports how it ended.
+// A non-zero exit code is reported in the status and is no error; a command stopped
+// because ctx expired or was cancelled has the exit code -1.
+func Run(ctx context.Context, cmd *exec.Cmd) (Status, error) {
+	err := cmd.Run()
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return Status{ExitCode: -1, TimedOut: true}, nil
+	case ctx.Err() != nil:
+		return Status{ExitCode: -1, Canceled: true}, nil
+	case err == nil:
+		return Status{}, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return Status{ExitCode: exitErr.ExitCode()}, nil
+	}
+	return Status{}, fmt.Errorf("command failed: %v", err)
+}
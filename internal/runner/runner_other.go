@@ -0,0 +1,8 @@
+//go:build !unix
+
+package runner
+
+import "os/exec"
+
+// setProcessGroup is a no-op on platforms without process groups; only the command itself is killed.
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,96 @@
+//go:build unix
+
+package runner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		timeout  time.Duration
+		expected Status
+	}{
+		{"Success", "exit 0", time.Minute, Status{}},
+		{"Failure", "exit 3", time.Minute, Status{ExitCode: 3}},
+		{"Timeout", "sleep 30", 100 * time.Millisecond, Status{ExitCode: -1, TimedOut: true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			status, err := Run(ctx, Command(ctx, "sh", "-c", tc.script))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if status != tc.expected {
+				t.Errorf("Expected %+v, got %+v", tc.expected, status)
+			}
+		})
+	}
+}
+
+// TestRunKillsProcessGroup makes sure that processes spawned by the command do not outlive it.
+func TestRunKillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	status, err := Run(ctx, Command(ctx, "sh", "-c", "sleep 30 & echo $! > "+pidFile+"; wait"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !status.Canceled || status.TimedOut {
+		t.Errorf("Expected cancelled status, got %+v", status)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run returned after %v", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("Failed to read PID: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("Failed to parse PID: %v", err)
+	}
+	// The killed child may linger as zombie until it is reaped by init
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := syscall.Kill(pid, 0)
+		if errors.Is(err, syscall.ESRCH) || isZombie(pid) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Grandchild %d is still running", pid)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func isZombie(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	// The state follows the command name in parentheses
+	for i := len(data) - 1; i > 0; i-- {
+		if data[i] == ')' {
+			return i+2 < len(data) && data[i+2] == 'Z'
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+// Package sandbox runs commands in Linux user, mount, PID and optionally network
+// namespaces, so a command picked by the model can only see the workspace.
+//
+// Commands are started through a helper: the server re-executes itself with
+// [HelperArg], sets up the mounts inside the new namespaces, applies resource
+// limits and then replaces itself with the command. [Main] has to be called at
+// the start of the program to dispatch to the helper.
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// HelperArg is the first argument marking a process as sandbox helper.
+const HelperArg = "__sandbox"
+
+// Limits caps the resources of a sandboxed command. Zero values disable a cap.
+type Limits struct {
+	// CPUSeconds is the CPU time of each process.
+	CPUSeconds uint64 `json:"cpu_seconds,omitempty"`
+	// MemoryBytes is the address space of each process.
+	MemoryBytes uint64 `json:"memory_bytes,omitempty"`
+	// Processes is the number of processes of the sandbox. Since Linux 5.14 the kernel
+	// counts the processes of a user per user namespace, so processes of the user outside
+	// of the sandbox do not count; older kernels count all processes of the user.
+	Processes uint64 `json:"processes,omitempty"`
+}
+
+// Config describes the sandbox.
+type Config struct {
+	// Workspace is bind-mounted read-write at its own path.
+	Workspace string `json:"workspace"`
+	// Hide lists directories replaced by empty, writable tmpfs mounts.
+	Hide []string `json:"hide"`
+	// Binds lists directories which stay accessible read-write although they are below a hidden directory.
+	Binds []string `json:"binds,omitempty"`
+	// ReadOnly lists glob patterns of files and directories which are mounted read-only,
+	// in order, e.g. the git directory: git commands outside of the sandbox run its hooks
+	// and configuration. Binds below them stay writable.
+	ReadOnly []string `json:"read_only,omitempty"`
+	// NoNetwork cuts off all network access but the loopback interface.
+	NoNetwork bool   `json:"no_network,omitempty"`
+	Limits    Limits `json:"limits"`
+}
+
+// DefaultHide returns the directories hidden by default: home directories and shared temporary directories.
+func DefaultHide() []string {
+	hide := []string{"/home", "/root", "/tmp", "/var/tmp", "/run/user"}
+	if home, err := os.UserHomeDir(); err == nil {
+		hide = append(hide, filepath.Clean(home))
+	}
+	return hide
+}
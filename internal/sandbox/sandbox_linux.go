@@ -0,0 +1,288 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Capabilities the helper needs to set up the sandbox, see capability.h.
+const (
+	capSetPCAP  = 8
+	capNetAdmin = 12
+	capSysAdmin = 21
+)
+
+// rlimitNPROC is RLIMIT_NPROC, which the syscall package does not define. The value holds for
+// all architectures but mips and sparc.
+const rlimitNPROC = 6
+
+// Wrap changes cmd, which must not be started yet, to run inside the sandbox.
+// cmd.Dir has to be within the workspace.
+func (c *Config) Wrap(cmd *exec.Cmd) error {
+	if c == nil {
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("sandbox: %v", err)
+	}
+	config, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	cmd.Args = append([]string{self, HelperArg, string(config), cmd.Path}, cmd.Args...)
+	cmd.Path = self
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	attr := cmd.SysProcAttr
+	attr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID
+	if c.NoNetwork {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	// Files in the workspace keep belonging to the user
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	attr.GidMappingsEnableSetgroups = false
+	// A user other than root loses its capabilities in the namespace when the helper is
+	// executed; the helper drops them before it executes the command
+	attr.AmbientCaps = []uintptr{capSetPCAP, capNetAdmin, capSysAdmin}
+	return nil
+}
+
+// Check verifies that sandboxed commands can be started on this system.
+func (c *Config) Check() error {
+	cmd := exec.Command("true")
+	cmd.Dir = c.Workspace
+	if err := c.Wrap(cmd); err != nil {
+		return err
+	}
+	// Without a command, the helper exits after setting up the sandbox
+	cmd.Args = cmd.Args[:3]
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sandbox is not available: %v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Main runs the sandbox helper if the process was started as one and never returns in that case.
+func Main() {
+	if len(os.Args) < 3 || os.Args[1] != HelperArg {
+		return
+	}
+	if err := helper(os.Args[2], os.Args[3:]); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+		os.Exit(126)
+	}
+	os.Exit(0)
+}
+
+// helper sets up the sandbox and executes argv, whose first element is the path of the executable.
+func helper(configJSON string, argv []string) error {
+	var c Config
+	if err := json.Unmarshal([]byte(configJSON), &c); err != nil {
+		return err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	// Mounts must not propagate to the host
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %v", err)
+	}
+
+	// Keep the workspace and binds reachable before the directories above them are hidden
+	keep := append([]string{c.Workspace}, c.Binds...)
+	fds := make([]int, len(keep))
+	for i, path := range keep {
+		fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("open %s: %v", path, err)
+		}
+		fds[i] = fd
+	}
+	for _, dir := range c.Hide {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := syscall.Mount("tmpfs", dir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755"); err != nil {
+			return fmt.Errorf("hide %s: %v", dir, err)
+		}
+	}
+	for i, path := range keep {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return fmt.Errorf("create mount point %s: %v", path, err)
+		}
+		source := fmt.Sprintf("/proc/self/fd/%d", fds[i])
+		if err := syscall.Mount(source, path, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind %s: %v", path, err)
+		}
+		syscall.Close(fds[i])
+	}
+
+	for _, pattern := range c.ReadOnly {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if err := readOnly(path); err != nil {
+				return fmt.Errorf("make %s read-only: %v", path, err)
+			}
+		}
+	}
+
+	// Only processes of the sandbox are visible
+	if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount /proc: %v", err)
+	}
+	if c.NoNetwork {
+		if err := loopbackUp(); err != nil {
+			return fmt.Errorf("set up loopback: %v", err)
+		}
+	}
+	if err := setLimits(c.Limits); err != nil {
+		return err
+	}
+	if err := os.Chdir(wd); err != nil {
+		return err
+	}
+
+	if len(argv) < 2 {
+		return nil
+	}
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return err
+	}
+	if err := dropCapabilities(); err != nil {
+		return fmt.Errorf("drop capabilities: %v", err)
+	}
+	return syscall.Exec(path, argv[1:], os.Environ())
+}
+
+// Flags of statfs, the kernel keeps them locked on mounts of a user namespace.
+const (
+	stNosuid     = 0x2
+	stNodev      = 0x4
+	stNoexec     = 0x8
+	stNoatime    = 0x400
+	stNodiratime = 0x800
+	stRelatime   = 0x1000
+)
+
+// readOnly bind-mounts path onto itself, including the mounts below it, and makes the new
+// mount read-only. The mounts below it keep their flags.
+func readOnly(path string) error {
+	if err := syscall.Mount(path, path, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return err
+	}
+	flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+	for flag, ms := range map[int64]uintptr{
+		stNosuid:     syscall.MS_NOSUID,
+		stNodev:      syscall.MS_NODEV,
+		stNoexec:     syscall.MS_NOEXEC,
+		stNoatime:    syscall.MS_NOATIME,
+		stNodiratime: syscall.MS_NODIRATIME,
+		stRelatime:   syscall.MS_RELATIME,
+	} {
+		if int64(st.Flags)&flag != 0 {
+			flags |= ms
+		}
+	}
+	return syscall.Mount("", path, "", flags, "")
+}
+
+// dropCapabilities drops all capabilities of the process and keeps the command from
+// gaining them again when it is executed, even as root. Otherwise the command could
+// undo the mounts of the sandbox.
+func dropCapabilities() error {
+	const (
+		prCapbsetDrop        = 24
+		prCapAmbient         = 47
+		prCapAmbientClearAll = 4
+		capabilityVersion3   = 0x20080522
+	)
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0); errno != 0 {
+		return errno
+	}
+	for c := uintptr(0); ; c++ {
+		_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapbsetDrop, c, 0)
+		if errno == syscall.EINVAL {
+			// c is beyond the last capability of the kernel
+			break
+		}
+		if errno != 0 {
+			return errno
+		}
+	}
+	hdr := struct {
+		version uint32
+		pid     int32
+	}{version: capabilityVersion3}
+	var data [2]struct{ effective, permitted, inheritable uint32 }
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func setLimits(l Limits) error {
+	for _, limit := range []struct {
+		resource int
+		value    uint64
+	}{
+		{syscall.RLIMIT_CPU, l.CPUSeconds},
+		{syscall.RLIMIT_AS, l.MemoryBytes},
+		// Set inside the user namespace of the sandbox, the limit counts only its processes
+		{rlimitNPROC, l.Processes},
+	} {
+		if limit.value == 0 {
+			continue
+		}
+		rlimit := syscall.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := syscall.Setrlimit(limit.resource, &rlimit); err != nil {
+			return fmt.Errorf("set resource limit %d: %v", limit.resource, err)
+		}
+	}
+	return nil
+}
+
+// loopbackUp brings up the loopback interface of a new network namespace.
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	var req struct {
+		name  [syscall.IFNAMSIZ]byte
+		flags uint16
+		_     [22]byte
+	}
+	copy(req.name[:], "lo")
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return errno
+	}
+	req.flags |= syscall.IFF_UP
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// The test binary serves as sandbox helper
+	Main()
+	os.Exit(m.Run())
+}
+
+// run runs a shell script inside a sandbox with config and returns its output.
+func run(t *testing.T, c *Config, script string) string {
+	t.Helper()
+	if err := c.Check(); err != nil {
+		t.Skipf("Sandbox is not available: %v", err)
+	}
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Dir = c.Workspace
+	if err := c.Wrap(cmd); err != nil {
+		t.Fatalf("Failed to wrap command: %v", err)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Sandboxed command failed: %v\n%s", err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestSandboxMounts(t *testing.T) {
+	workspace := t.TempDir()
+	secret := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "input"), []byte("visible"), 0644)
+	os.WriteFile(filepath.Join(secret, "id_ed25519"), []byte("private key"), 0600)
+
+	// Both directories are below the hidden temporary directory
+	c := &Config{Workspace: workspace, Hide: []string{filepath.Dir(workspace), filepath.Dir(secret)}}
+	out := run(t, c, "cat input; echo; pwd; test -e "+secret+"/id_ed25519 && echo leaked; echo written > output; echo $$")
+
+	lines := strings.Split(out, "\n")
+	if len(lines) != 3 || lines[0] != "visible" || lines[1] != workspace || lines[2] != "1" {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+	if data, err := os.ReadFile(filepath.Join(workspace, "output")); err != nil || string(data) != "written\n" {
+		t.Errorf("Workspace is not writable: %q (%v)", data, err)
+	}
+}
+
+func TestSandboxReadOnly(t *testing.T) {
+	workspace := t.TempDir()
+	for _, dir := range []string{".git/hooks", ".git/worktrees/a", "tree"} {
+		os.MkdirAll(filepath.Join(workspace, dir), 0755)
+	}
+	os.WriteFile(filepath.Join(workspace, "tree", ".git"), []byte("gitdir: ../.git/worktrees/a\n"), 0644)
+
+	c := &Config{
+		Workspace: workspace,
+		Binds:     []string{filepath.Join(workspace, ".git", "worktrees")},
+		ReadOnly:  []string{filepath.Join(workspace, ".git"), filepath.Join(workspace, "*", ".git")},
+	}
+	out := run(t, c, `for f in .git/hooks/pre-commit .git/config tree/.git .git/worktrees/a/HEAD input; do (echo x > $f) 2>/dev/null && echo "$f written"; done; true`)
+	if out != ".git/worktrees/a/HEAD written\ninput written" {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+}
+
+func TestSandboxCapabilities(t *testing.T) {
+	workspace := t.TempDir()
+	os.Mkdir(filepath.Join(workspace, ".git"), 0755)
+	c := &Config{Workspace: workspace, ReadOnly: []string{filepath.Join(workspace, ".git")}}
+	// The command can neither undo the read-only mount nor regain capabilities
+	out := run(t, c, "grep -E '^Cap(Prm|Eff|Bnd|Amb)' /proc/self/status | tr -d ' \\t'; umount .git 2>/dev/null && echo unmounted; true")
+	if out != "CapPrm:0000000000000000\nCapEff:0000000000000000\nCapBnd:0000000000000000\nCapAmb:0000000000000000" {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+}
+
+func TestSandboxNoNetwork(t *testing.T) {
+	c := &Config{Workspace: t.TempDir(), NoNetwork: true}
+	// The header of /proc/net/dev has two lines, followed by one line per interface
+	out := run(t, c, "tail -n +3 /proc/net/dev | cut -d: -f1 | tr -d ' '")
+	if out != "lo" {
+		t.Errorf("Expected only loopback interface, got:\n%s", out)
+	}
+}
+
+func TestSandboxLimits(t *testing.T) {
+	c := &Config{Workspace: t.TempDir(), Limits: Limits{CPUSeconds: 30, MemoryBytes: 1 << 30}}
+	out := run(t, c, "ulimit -t; ulimit -v")
+	if out != "30\n1048576" {
+		t.Errorf("Unexpected limits:\n%s", out)
+	}
+}
+
+func TestSandboxProcesses(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("The kernel does not enforce RLIMIT_NPROC for root")
+	}
+	// The limit is below the number of processes of the user outside of the sandbox in
+	// most environments, but only the processes of the sandbox count. The subshell exits
+	// once it cannot fork anymore, the processes are counted with shell builtins.
+	c := &Config{Workspace: t.TempDir(), Limits: Limits{Processes: 8}}
+	out := run(t, c, "(for i in $(seq 20); do sleep 5 & done) 2>/dev/null; set -- /proc/[0-9]*; echo $#")
+	if n, err := strconv.Atoi(out); err != nil || n > 8 || n < 2 {
+		t.Errorf("Expected at most 8 processes in the sandbox, got:\n%s", out)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var errUnsupported = errors.New("sandbox is only supported on Linux")
+
+// Wrap changes cmd, which must not be started yet, to run inside the sandbox.
+func (c *Config) Wrap(cmd *exec.Cmd) error {
+	if c == nil {
+		return nil
+	}
+	return errUnsupported
+}
+
+// Check verifies that sandboxed commands can be started on this system.
+func (c *Config) Check() error {
+	return errUnsupported
+}
+
+// Main runs the sandbox helper if the process was started as one.
+func Main() {}
@@ -0,0 +1,188 @@
+// Package textdiff renders line-based differences between two texts as unified diff.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change.
+const contextLines = 3
+
+// maxCells bounds the size of the edit table. Larger inputs are shown as a single replacement.
+const maxCells = 4_000_000
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+type op struct {
+	kind opKind
+	line string
+	// Line numbers (0-based) in the old and new text before this operation.
+	oldLine, newLine int
+}
+
+// Unified returns the unified diff of oldText and newText labelled with oldName and newName.
+// It returns an empty string if both texts are equal.
+func Unified(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	ops := diffLines(splitLines(oldText), splitLines(newText))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks(ops) {
+		writeHunk(&b, ops[h[0]:h[1]])
+	}
+	return b.String()
+}
+
+// splitLines splits text into lines, keeping a missing trailing newline visible.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] += "\n\\ No newline at end of file\n"
+	}
+	return lines
+}
+
+// diffLines computes an edit script turning a into b based on their longest common subsequence.
+func diffLines(a, b []string) []op {
+	// Strip common prefix and suffix, which keeps the table small for typical edits.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	ops := make([]op, 0, len(a)+len(b))
+	oldLine, newLine := 0, 0
+	emit := func(kind opKind, line string) {
+		ops = append(ops, op{kind: kind, line: line, oldLine: oldLine, newLine: newLine})
+		if kind != opInsert {
+			oldLine++
+		}
+		if kind != opDelete {
+			newLine++
+		}
+	}
+
+	for _, l := range a[:prefix] {
+		emit(opEqual, l)
+	}
+	if len(ma)*len(mb) > maxCells {
+		for _, l := range ma {
+			emit(opDelete, l)
+		}
+		for _, l := range mb {
+			emit(opInsert, l)
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of ma[i:] and mb[j:].
+		lcs := make([][]int, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) || j < len(mb) {
+			switch {
+			case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+				emit(opEqual, ma[i])
+				i++
+				j++
+			case i < len(ma) && (j == len(mb) || lcs[i+1][j] >= lcs[i][j+1]):
+				emit(opDelete, ma[i])
+				i++
+			default:
+				emit(opInsert, mb[j])
+				j++
+			}
+		}
+	}
+	for _, l := range a[len(a)-suffix:] {
+		emit(opEqual, l)
+	}
+	return ops
+}
+
+// hunks groups changes with their context into ranges [start, end) of ops.
+func hunks(ops []op) [][2]int {
+	var result [][2]int
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == opEqual {
+			continue
+		}
+		start := max(0, i-contextLines)
+		end := i
+		// Extend the hunk while the next change is close enough to share context.
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != opEqual {
+				end = j + 1
+			} else if j-end >= 2*contextLines {
+				break
+			}
+		}
+		end = min(len(ops), end+contextLines)
+		if n := len(result); n > 0 && start <= result[n-1][1] {
+			result[n-1][1] = end
+		} else {
+			result = append(result, [2]int{start, end})
+		}
+		i = end - 1
+	}
+	return result
+}
+
+// writeHunk writes a single hunk including its header.
+func writeHunk(b *strings.Builder, ops []op) {
+	oldCount, newCount := 0, 0
+	for _, o := range ops {
+		if o.kind != opInsert {
+			oldCount++
+		}
+		if o.kind != opDelete {
+			newCount++
+		}
+	}
+	fmt.Fprintf(b, "@@ -%s +%s @@\n", hunkRange(ops[0].oldLine, oldCount), hunkRange(ops[0].newLine, newCount))
+	for _, o := range ops {
+		b.WriteByte(byte(o.kind))
+		b.WriteString(o.line)
+	}
+}
+
+// hunkRange formats a range of lines the way GNU diff does.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
@@ -0,0 +1,84 @@
+package textdiff
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		expected string
+	}{
+		{
+			name:     "Equal",
+			old:      "a\nb\n",
+			new:      "a\nb\n",
+			expected: "",
+		},
+		{
+			name:     "New file",
+			old:      "",
+			new:      "a\nb\n",
+			expected: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:     "Changed line with context",
+			old:      "1\n2\n3\n4\n5\n6\n7\n8\n",
+			new:      "1\n2\n3\n4\nfive\n6\n7\n8\n",
+			expected: "--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name:     "Missing trailing newline",
+			old:      "a\n",
+			new:      "a\nb",
+			expected: "--- old\n+++ new\n@@ -1 +1,2 @@\n a\n+b\n\\ No newline at end of file\n",
+		},
+		{
+			name:     "Separate hunks",
+			old:      "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			new:      "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			expected: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Unified("old", "new", tc.old, tc.new)
+			if got != tc.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tc.expected, got)
+			}
+		})
+	}
+}
+
+// TestUnifiedApplies checks that patch(1) accepts the generated diffs.
+func TestUnifiedApplies(t *testing.T) {
+	patch, err := exec.LookPath("patch")
+	if err != nil {
+		t.Skip("patch not installed")
+	}
+
+	old := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n\nfunc a() {}\nfunc b() {}\nfunc c() {}\nfunc d() {}\n"
+	new := strings.Replace(old, "hello", "world", 1)
+	new = strings.Replace(new, "func c() {}\n", "", 1) + "func e() {}\n"
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(file, []byte(old), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	cmd := exec.Command(patch, "-s", file)
+	cmd.Stdin = strings.NewReader(Unified("a/main.go", "b/main.go", old, new))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("patch failed: %v\n%s", err, out)
+	}
+	got, _ := os.ReadFile(file)
+	if string(got) != new {
+		t.Errorf("Expected patched file:\n%s\nGot:\n%s", new, got)
+	}
+}
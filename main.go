@@ -1,29 +1,126 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/seb-schulz/mcpilot-pair/internal/gitsafe"
+	"github.com/seb-schulz/mcpilot-pair/internal/output"
+	"github.com/seb-schulz/mcpilot-pair/internal/patterns"
+	"github.com/seb-schulz/mcpilot-pair/internal/progress"
+	"github.com/seb-schulz/mcpilot-pair/internal/runner"
+	"github.com/seb-schulz/mcpilot-pair/internal/sandbox"
+	"github.com/seb-schulz/mcpilot-pair/middleware/approval"
+	"github.com/seb-schulz/mcpilot-pair/middleware/audit"
 	"github.com/seb-schulz/mcpilot-pair/middleware/auth"
+	"github.com/seb-schulz/mcpilot-pair/middleware/lock"
+	"github.com/seb-schulz/mcpilot-pair/middleware/worktree"
+	"github.com/seb-schulz/mcpilot-pair/tools/code"
+	"github.com/seb-schulz/mcpilot-pair/tools/command"
 	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+	"github.com/seb-schulz/mcpilot-pair/tools/git"
+	"github.com/seb-schulz/mcpilot-pair/tools/golang"
+	"github.com/seb-schulz/mcpilot-pair/tools/jobs"
+	"github.com/seb-schulz/mcpilot-pair/tools/lsp"
 	"github.com/seb-schulz/mcpilot-pair/tools/make"
 )
 
 var (
-	port string
+	port           string
+	showKey        bool
+	authMode       string
+	publicURL      string
+	trustedProxies string
+	toolRate       int
+	approvalMode   string
+	approvalAddr   string
+	auditLog       string
+	makeAllow      string
+	makeDeny       string
+	makeTimeout    time.Duration
+	outputLimits   = output.DefaultLimits()
+	jobTimeout     time.Duration
+	goTimeout      time.Duration
+	commandPolicy  command.Policy
+	commandFile    string
+	commandTimeout time.Duration
+	maxJobs        int
+	lockWait       time.Duration
+	gitProtected   string
+	gitCoAuthor    string
+	gitHooks       bool
+	sandboxEnabled bool
+	sandboxConfig  = sandbox.Config{Hide: sandbox.DefaultHide()}
+	sandboxBinds   stringList
+	sandboxMemory  uint64
+	envPolicy      = runner.DefaultEnvPolicy()
+	envPass        string
+	envAllow       string
+	envSecrets     string
+	envSet         stringList
+	sessionTrees   bool
+	lspServers     lsp.Servers
 )
 
+// shutdownTimeout bounds how long the server waits for open requests on shutdown.
+const shutdownTimeout = 5 * time.Second
+
 func init() {
 	flag.StringVar(&port, "p", "8080", "Port für den Server (Standard: 8080)")
 	flag.StringVar(&port, "port", "8080", "Port für den Server (Standard: 8080)")
+	flag.BoolVar(&showKey, "show-key", false, "Print the API key in clear text on startup")
+	flag.StringVar(&authMode, "auth", "apikey", "Authorization mode: 'apikey' (static bearer key) or 'oauth' (OAuth 2.1 with consent page)")
+	flag.StringVar(&publicURL, "public-url", "", "Externally visible base URL used in OAuth metadata (default: derived from the request)")
+	flag.StringVar(&trustedProxies, "trusted-proxy", "", "Comma-separated IPs or CIDR prefixes of reverse proxies whose X-Forwarded-For header is trusted")
+	flag.IntVar(&toolRate, "tool-rate", 120, "Maximum tool calls per minute and credential (0 disables the limit)")
+	flag.StringVar(&approvalMode, "approval", "off", "Approval of mutating tool calls of clients without elicitation: 'off' (deny them), 'terminal' or 'web' (clients supporting elicitation are always asked directly)")
+	flag.StringVar(&approvalAddr, "approval-addr", "127.0.0.1:8081", "Loopback address of the approval page (with --approval web)")
+	flag.StringVar(&auditLog, "audit-log", audit.DefaultPath(), "Path of the audit log of all tool calls (empty disables it)")
+	flag.StringVar(&makeAllow, "make-allow", strings.Join(make.DefaultPolicy().Allow, ","), "Comma-separated patterns of make targets make_run may run")
+	flag.StringVar(&makeDeny, "make-deny", strings.Join(make.DefaultPolicy().Deny, ","), "Comma-separated patterns of make targets make_run must not run (takes precedence over --make-allow)")
+	flag.IntVar(&outputLimits.MaxBytes, "output-max-bytes", outputLimits.MaxBytes, "Maximum bytes of command output returned per stream (0 disables the limit)")
+	flag.IntVar(&outputLimits.MaxLines, "output-max-lines", outputLimits.MaxLines, "Maximum lines of command output returned per stream (0 disables the limit)")
+	flag.DurationVar(&makeTimeout, "make-timeout", make.DefaultTimeout, "Maximum duration of a make run before make and its child processes are killed")
+	flag.DurationVar(&goTimeout, "go-timeout", golang.DefaultTimeout, "Maximum duration of a go command before it and its child processes are killed")
+	flag.DurationVar(&lockWait, "lock-wait", lock.DefaultWait, "Maximum time a build or write waits for another one in the same directory or file before it is rejected")
+	flag.StringVar(&gitProtected, "git-protected", strings.Join(git.DefaultProtected, ","), "Comma-separated patterns of branches the git tools must not change")
+	flag.BoolVar(&gitHooks, "git-hooks", false, "Run the hooks of the repository, e.g. pre-commit, in git_commit, git_branch_switch and other git tools; they run with the privileges of the server")
+	flag.StringVar(&gitCoAuthor, "git-co-author", "", "Added as Co-authored-by trailer to commits of git_commit, e.g. 'Assistant <assistant@example.com>'")
+	flag.Var(&commandPolicy, "allow-command", "Command run_command may execute, e.g. 'npm test' or 'pytest -k *' (* matches any text, a final ... any further arguments); repeatable")
+	flag.StringVar(&commandFile, "command-policy", "", "File with one allowed command per line, like --allow-command")
+	flag.DurationVar(&commandTimeout, "command-timeout", command.DefaultTimeout, "Maximum duration of run_command before the command and its child processes are killed")
+	flag.DurationVar(&jobTimeout, "job-timeout", jobs.DefaultTimeout, "Maximum duration of a background job")
+	flag.IntVar(&maxJobs, "max-jobs", jobs.DefaultMaxRunning, "Maximum number of concurrently running background jobs per session")
+	flag.StringVar(&envPass, "env-pass", strings.Join(envPolicy.Pass, ","), "Comma-separated patterns of environment variables passed from the server to make, go and other commands")
+	flag.Var(&envSet, "env-set", "Environment variable NAME=value always set for commands, e.g. GOFLAGS=-mod=mod; repeatable")
+	flag.StringVar(&envAllow, "env-allow", strings.Join(envPolicy.Allow, ","), "Comma-separated patterns of environment variables a tool call may set")
+	flag.StringVar(&envSecrets, "env-secrets", strings.Join(envPolicy.Secrets, ","), "Comma-separated patterns of environment variables never passed nor set by tool calls (empty disables scrubbing)")
+	flag.BoolVar(&sandboxEnabled, "sandbox", false, "Run make, go and other commands in Linux namespaces which only expose the workspace (home and temporary directories are hidden)")
+	flag.Var(&sandboxBinds, "sandbox-bind", "Directory kept accessible inside the sandbox although below a hidden one, e.g. the Go module cache; repeatable")
+	flag.BoolVar(&sandboxConfig.NoNetwork, "sandbox-no-network", false, "Cut off network access of sandboxed commands except loopback")
+	flag.Uint64Var(&sandboxConfig.Limits.CPUSeconds, "sandbox-cpu", 0, "CPU seconds per sandboxed process (0 disables the limit)")
+	flag.Uint64Var(&sandboxMemory, "sandbox-memory", 0, "Address space in MiB per sandboxed process (0 disables the limit)")
+	flag.Uint64Var(&sandboxConfig.Limits.Processes, "sandbox-procs", 0, "Maximum number of processes of each sandboxed command (0 disables the limit)")
+	flag.BoolVar(&sessionTrees, "session-worktrees", false, "Give every session its own git worktree on a fresh branch instead of working in the current checkout; review them with `mcpilot-pair session`")
+	flag.Var(&lspServers, "lsp", "Language server for files with the given extensions, e.g. 'go=gopls' or 'py,pyi=pyright-langserver --stdio'; repeatable")
 }
 
 func prompt(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
@@ -62,18 +159,217 @@ func embeddedResource(_ context.Context, req *mcp.ReadResourceRequest) (*mcp.Rea
 	}, nil
 }
 
+// addTool registers a tool and puts it behind the approval gate unless it is annotated as read-only.
+func addTool[In, Out any](srv *mcp.Server, gate *approval.Gate, t *mcp.Tool, h mcp.ToolHandlerFor[In, Out]) {
+	mcp.AddTool(srv, t, h)
+	if t.Annotations == nil || !t.Annotations.ReadOnlyHint {
+		gate.Guard(t.Name, nil)
+	}
+}
+
+// stringList is a flag.Value collecting the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// directoryKey returns the lock key of a directory argument of a tool.
+func directoryKey(ctx context.Context, directory string) []string {
+	dir, err := filesystem.ResolveDirectory(ctx, directory)
+	if err != nil {
+		return nil
+	}
+	return []string{dir}
+}
+
+// resolvePaths returns the absolute paths of files relative to the working directory,
+// leaving out those outside of it.
+func resolvePaths(ctx context.Context, files ...string) []string {
+	var paths []string
+	for _, f := range files {
+		if path, err := filesystem.ResolvePath(ctx, f); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// The following functions return the absolute paths of the files changed by the tools
+// which modify the workspace, from their arguments or their results.
+func writeFiles(ctx context.Context, args filesystem.WriteFileArgs) []string {
+	return resolvePaths(ctx, args.Path)
+}
+
+func modFiles(ctx context.Context, args golang.ModTidyArgs) []string {
+	if args.Check {
+		return nil
+	}
+	return resolvePaths(ctx, filepath.Join(args.Directory, "go.mod"), filepath.Join(args.Directory, "go.sum"))
+}
+
+func fmtFiles(ctx context.Context, result golang.FmtResult) []string {
+	if !result.Applied {
+		return nil
+	}
+	return resolvePaths(ctx, result.Files...)
+}
+
+func restoreFiles(ctx context.Context, result git.RestoreResult) []string {
+	return resolvePaths(ctx, result.Files...)
+}
+
+func stashFiles(ctx context.Context, result git.StashResult) []string {
+	return resolvePaths(ctx, result.Files...)
+}
+
+func renameFiles(ctx context.Context, result code.RenameResult) []string {
+	if !result.Applied {
+		return nil
+	}
+	return resolvePaths(ctx, result.Files...)
+}
+
+func lspEditFiles(ctx context.Context, result lsp.EditResult) []string {
+	if !result.Applied {
+		return nil
+	}
+	return resolvePaths(ctx, result.Files...)
+}
+
+func codeActionFiles(ctx context.Context, result lsp.CodeActionsResult) []string {
+	if result.Applied == nil {
+		return nil
+	}
+	return lspEditFiles(ctx, *result.Applied)
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
 func main() {
+	// Sandboxed commands are started through this binary
+	sandbox.Main()
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		os.Exit(audit.Command(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "session" {
+		os.Exit(worktree.Command(os.Args[2:], os.Stdout, os.Stderr))
+	}
 	flag.Parse()
 
+	var prompter approval.Prompter
+	switch approvalMode {
+	case "off":
+	case "terminal":
+		prompter = approval.NewTerminalPrompter(os.Stdin, os.Stderr)
+	case "web":
+		web := approval.NewWebPrompter(approvalAddr)
+		go func() {
+			if err := web.ListenAndServe(context.Background()); err != nil {
+				log.Fatalf("Approval page error: %v", err)
+			}
+		}()
+		prompter = web
+	default:
+		log.Fatalf("unknown approval mode %q", approvalMode)
+	}
+	gate := approval.NewGate(prompter, approval.DefaultTimeout)
+
+	envPolicy = runner.EnvPolicy{
+		Pass:    patterns.Split(envPass),
+		Set:     envSet,
+		Allow:   patterns.Split(envAllow),
+		Secrets: patterns.Split(envSecrets),
+	}
+	if err := envPolicy.Check(nil); err != nil {
+		log.Fatalf("Invalid --env-set: %v", err)
+	}
+
+	var worktrees *worktree.Manager
+	if sessionTrees {
+		var err error
+		worktrees, err = worktree.NewManager(context.Background(), ".")
+		if err != nil {
+			log.Fatalf("Session worktrees are not available: %v", err)
+		}
+	}
+
+	var box *sandbox.Config
+	if sandboxEnabled {
+		box = &sandboxConfig
+		workspace, err := filesystem.ResolvePath(context.Background(), ".")
+		if err != nil {
+			log.Fatalf("Could not resolve the workspace: %v", err)
+		}
+		box.Workspace = workspace
+		box.Binds = sandboxBinds
+		box.Limits.MemoryBytes = sandboxMemory << 20
+		// The git tools run outside of the sandbox, so sandboxed commands must not change
+		// the hooks and configuration of the repository
+		if gitDir, commonDir, err := gitsafe.Dirs(context.Background(), workspace); err == nil {
+			box.ReadOnly = slices.Compact([]string{gitDir, commonDir})
+		}
+		if worktrees != nil {
+			// Session worktrees live in the git directory, inside the sandbox's workspace
+			// too; they stay writable but for the files pointing to their git directories
+			if err := os.MkdirAll(worktrees.Dir(), 0755); err != nil {
+				log.Fatalf("Could not create the worktree directory: %v", err)
+			}
+			box.Binds = append(box.Binds, worktrees.Dir())
+			box.ReadOnly = append(box.ReadOnly, filepath.Join(worktrees.Dir(), "*", ".git"))
+		}
+		if err := box.Check(); err != nil {
+			log.Fatalf("Sandbox is not available: %v", err)
+		}
+	}
+
+	makeRunner := make.NewRunner(make.Policy{
+		Allow: patterns.Split(makeAllow),
+		Deny:  patterns.Split(makeDeny),
+	})
+	makeRunner.Timeout = makeTimeout
+	makeRunner.Env = envPolicy
+	makeRunner.Sandbox = box
+
+	// Background jobs run with their own, longer timeout
+	jobRunner := *makeRunner
+	jobRunner.Timeout = jobTimeout
+	jobManager := jobs.NewManager(&jobRunner, maxJobs)
+
+	// Builds are serialised per directory and writes per file
+	locks := lock.NewManager(lockWait)
+	jobManager.Locks = locks
+
 	srv := mcp.NewServer(&mcp.Implementation{
 		Name:    "mcpilot-pair",
 		Version: "0.3.0",
-	}, nil)
+	}, &mcp.ServerOptions{
+		InitializedHandler: func(ctx context.Context, req *mcp.InitializedRequest) {
+			// Release the state of a session once the client closed it
+			session := req.Session
+			go func() {
+				session.Wait()
+				gate.Forget(session.ID())
+				jobManager.EndSession(session.ID())
+				if worktrees != nil {
+					worktrees.EndSession(session.ID())
+				}
+			}()
+		},
+	})
 
 	// Register the filesystem_read_file tool
-	mcp.AddTool(srv, &mcp.Tool{
+	addTool(srv, gate, &mcp.Tool{
 		Name:        "filesystem_read_file",
 		Description: "Reads the content of a file.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args filesystem.ReadFileArgs) (*mcp.CallToolResult, any, error) {
 		result, err := filesystem.ReadFile(ctx, args)
 		if err != nil {
@@ -87,9 +383,10 @@ func main() {
 	})
 
 	// Register the filesystem_write_file tool
-	mcp.AddTool(srv, &mcp.Tool{
+	addTool(srv, gate, &mcp.Tool{
 		Name:        "filesystem_write_file",
 		Description: "Writes content to a file.",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(true), IdempotentHint: true},
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args filesystem.WriteFileArgs) (*mcp.CallToolResult, any, error) {
 		_, err := filesystem.WriteFile(ctx, args)
 		if err != nil {
@@ -103,9 +400,10 @@ func main() {
 	})
 
 	// Register the filesystem_list_files tool
-	mcp.AddTool(srv, &mcp.Tool{
+	addTool(srv, gate, &mcp.Tool{
 		Name:        "filesystem_list_files",
 		Description: "Lists files and directories in a path.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args filesystem.ListFilesArgs) (*mcp.CallToolResult, any, error) {
 		result, err := filesystem.ListFiles(ctx, args)
 		if err != nil {
@@ -120,12 +418,12 @@ func main() {
 	})
 
 	// Register the filesystem_file_exists tool
-	mcp.AddTool(srv, &mcp.Tool{
+	addTool(srv, gate, &mcp.Tool{
 		Name:        "filesystem_file_exists",
 		Description: "Checks if a file or directory exists.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args filesystem.FileExistsArgs) (*mcp.CallToolResult, any, error) {
 		result, err := filesystem.FileExists(ctx, args)
-		log.Println("filesystem_file_exists", result, err)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -137,15 +435,37 @@ func main() {
 		}, nil, nil
 	})
 
+	// Long command output is shortened, the full output is available as resource
+	outputs := output.NewStore(outputLimits, output.DefaultMaxRuns)
+	srv.AddResourceTemplate(outputs.Template(), outputs.ReadResource)
+
+	// Register the make_list_targets tool
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "make_list_targets",
+		Description: "Lists the targets of the Makefile in a directory with their help comments and whether make_run may run them.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args make.ListTargetsArgs) (*mcp.CallToolResult, make.ListTargetsResult, error) {
+		result, err := makeRunner.ListTargets(ctx, args)
+		if err != nil {
+			return nil, make.ListTargetsResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+
 	// Register the make_run tool
-	mcp.AddTool(srv, &mcp.Tool{
+	addTool(srv, gate, &mcp.Tool{
 		Name:        "make_run",
-		Description: "Executes `make -C <directory> <target>` in a bash environment. Allowed targets: all, build, test, clean.",
+		Description: "Executes `make -C <directory> <target>` within the working directory. Only targets defined in the Makefile and allowed by the server policy can be run, see make_list_targets.",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(true)},
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args make.RunMakeArgs) (*mcp.CallToolResult, any, error) {
-		result, err := make.RunMake(ctx, args)
+		// Stream the output while make is running if the client asked for progress
+		reporter := progress.New(ctx, req, "make")
+		result, err := makeRunner.RunMake(ctx, args, reporter.Line)
+		reporter.Flush()
 		if err != nil {
 			return nil, nil, err
 		}
+		result.OutputID = outputs.Shorten(&result.Stdout, &result.Stderr)
 		jsonData, _ := json.Marshal(result)
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
@@ -154,10 +474,466 @@ func main() {
 		}, nil, nil
 	})
 
-	// Registriere die Search-Funktion als Tool
+	// Register the job tools
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "job_start",
+		Description: "Starts `make -C <directory> <target>` as background job and returns its ID immediately. Use it for long-running targets like integration tests or dev servers. Follow the job with job_status and job_output.",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(true)},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args jobs.StartArgs) (*mcp.CallToolResult, jobs.Info, error) {
+		info, err := jobManager.Start(ctx, req.Session.ID(), args)
+		if err != nil {
+			return nil, jobs.Info{}, err
+		}
+		return &mcp.CallToolResult{}, info, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "job_status",
+		Description: "Returns the state of a background job.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args jobs.JobArgs) (*mcp.CallToolResult, jobs.Info, error) {
+		info, err := jobManager.Status(req.Session.ID(), args)
+		if err != nil {
+			return nil, jobs.Info{}, err
+		}
+		return &mcp.CallToolResult{}, info, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "job_output",
+		Description: "Returns output lines of a background job starting at an offset. Pass next_offset of the previous call to read new lines only.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args jobs.OutputArgs) (*mcp.CallToolResult, jobs.OutputResult, error) {
+		result, err := jobManager.Output(req.Session.ID(), args)
+		if err != nil {
+			return nil, jobs.OutputResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "job_list",
+		Description: "Lists the background jobs of this session.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, jobs.ListResult, error) {
+		return &mcp.CallToolResult{}, jobManager.List(req.Session.ID()), nil
+	})
+	// Stopping a job of the own session needs no approval
 	mcp.AddTool(srv, &mcp.Tool{
+		Name:        "job_stop",
+		Description: "Stops a background job together with all processes it started.",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(false), IdempotentHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args jobs.JobArgs) (*mcp.CallToolResult, jobs.Info, error) {
+		info, err := jobManager.Stop(req.Session.ID(), args)
+		if err != nil {
+			return nil, jobs.Info{}, err
+		}
+		return &mcp.CallToolResult{}, info, nil
+	})
+
+	goRunner := golang.NewRunner()
+	goRunner.Timeout = goTimeout
+	goRunner.Env = envPolicy
+	goRunner.Sandbox = box
+
+	// Register the go_test tool
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "go_test",
+		Description: "Runs `go test -json` on package patterns (default ./...) and returns the status and duration per package and test, the output of failed tests and the source locations of failures and panics.",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(false)},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args golang.TestArgs) (*mcp.CallToolResult, golang.TestResult, error) {
+		reporter := progress.New(ctx, req, "go")
+		result, err := goRunner.Test(ctx, args, reporter.Line)
+		reporter.Flush()
+		if err != nil {
+			return nil, golang.TestResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+
+	// Register the go toolchain tools
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "go_build",
+		Description: "Compiles Go packages (default ./...) without keeping the binaries and returns the compiler errors as {file, line, column, message}.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args golang.PackagesArgs) (*mcp.CallToolResult, golang.CheckResult, error) {
+		result, err := goRunner.Build(ctx, args)
+		if err != nil {
+			return nil, golang.CheckResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "go_vet",
+		Description: "Runs `go vet` on Go packages (default ./...) and returns the findings as {file, line, column, message}.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args golang.PackagesArgs) (*mcp.CallToolResult, golang.CheckResult, error) {
+		result, err := goRunner.Vet(ctx, args)
+		if err != nil {
+			return nil, golang.CheckResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "go_list",
+		Description: "Lists Go packages (default ./...) with their directory, files, imports and loading errors.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args golang.PackagesArgs) (*mcp.CallToolResult, golang.ListResult, error) {
+		result, err := goRunner.List(ctx, args)
+		if err != nil {
+			return nil, golang.ListResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "go_fmt",
+		Description: "Reports Go files which are not formatted like gofmt does, or rewrites them if apply is set. Syntax errors are returned as {file, line, column, message}.",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(false), IdempotentHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args golang.FmtArgs) (*mcp.CallToolResult, golang.FmtResult, error) {
+		result, err := golang.Fmt(ctx, args)
+		if err != nil {
+			return nil, golang.FmtResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "go_mod_tidy",
+		Description: "Runs `go mod tidy` on a module, or only reports the changes to go.mod and go.sum as diff if check is set.",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(false), IdempotentHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args golang.ModTidyArgs) (*mcp.CallToolResult, golang.ModTidyResult, error) {
+		result, err := goRunner.ModTidy(ctx, args)
+		if err != nil {
+			return nil, golang.ModTidyResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+
+	// Register the Go code navigation tools, which analyse the source without running go
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "code_outline",
+		Description: "Lists the top-level declarations of a Go file or of the package in a directory: funcs, methods, types, consts and vars with signatures, line ranges and doc comments. Works on code which does not compile.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args code.OutlineArgs) (*mcp.CallToolResult, code.OutlineResult, error) {
+		result, err := code.Outline(ctx, args)
+		if err != nil {
+			return nil, code.OutlineResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "code_find_symbol",
+		Description: "Finds where a Go identifier is defined in the module, using type information instead of a text search. Accepts Name, Type.Method, Type.Field or pkg.Name and returns file, line, signature and doc comment of each definition.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args code.FindSymbolArgs) (*mcp.CallToolResult, code.FindSymbolResult, error) {
+		result, err := code.FindSymbol(ctx, args)
+		if err != nil {
+			return nil, code.FindSymbolResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "code_references",
+		Description: "Lists every use of a Go symbol in the module with file, line, source line and enclosing function. The name must identify one definition; qualify it as Type.Method or pkg.Name if it is ambiguous.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args code.ReferencesArgs) (*mcp.CallToolResult, code.ReferencesResult, error) {
+		result, err := code.References(ctx, args)
+		if err != nil {
+			return nil, code.ReferencesResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "code_callers",
+		Description: "Lists the call sites of a Go function or method in the module with their enclosing function. Calls through interfaces and function values are not found.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args code.CallHierarchyArgs) (*mcp.CallToolResult, code.CallersResult, error) {
+		result, err := code.Callers(ctx, args)
+		if err != nil {
+			return nil, code.CallersResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "code_callees",
+		Description: "Lists the functions and methods called by a Go function or method in source order, with the location of their definitions inside the module. Calls of interface methods are marked as dynamic.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args code.CallHierarchyArgs) (*mcp.CallToolResult, code.CalleesResult, error) {
+		result, err := code.Callees(ctx, args)
+		if err != nil {
+			return nil, code.CalleesResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "code_rename",
+		Description: "Renames a Go symbol with its definition and all uses in the module, including methods, fields and tests. Returns the diff without changing files unless apply is set. Renames which would break the type check or make an identifier refer to another declaration are refused; all files are written together or not at all.",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(false)},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args code.RenameArgs) (*mcp.CallToolResult, code.RenameResult, error) {
+		result, err := code.Rename(ctx, args)
+		if err != nil {
+			return nil, code.RenameResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+
+	// Register the language server tools
+	var lspManager *lsp.Manager
+	if len(lspServers) > 0 {
+		lspManager = lsp.NewManager(lspServers)
+		lspManager.Env = envPolicy
+		lspManager.Sandbox = box
+		defer lspManager.Close()
+		exts := strings.Join(lspServers.Extensions(), ", ")
+
+		addTool(srv, gate, &mcp.Tool{
+			Name:        "lsp_hover",
+			Description: "Returns the documentation and type of the symbol at a 1-based line and byte column of a file, as reported by the language server. Files with the extensions " + exts + " are supported.",
+			Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+		}, func(ctx context.Context, req *mcp.CallToolRequest, args lsp.PositionArgs) (*mcp.CallToolResult, lsp.HoverResult, error) {
+			result, err := lspManager.Hover(ctx, args)
+			if err != nil {
+				return nil, lsp.HoverResult{}, err
+			}
+			return &mcp.CallToolResult{}, result, nil
+		})
+		addTool(srv, gate, &mcp.Tool{
+			Name:        "lsp_definition",
+			Description: "Returns the definitions of the symbol at a 1-based line and byte column of a file with their source lines, as reported by the language server. Files with the extensions " + exts + " are supported.",
+			Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+		}, func(ctx context.Context, req *mcp.CallToolRequest, args lsp.PositionArgs) (*mcp.CallToolResult, lsp.LocationsResult, error) {
+			result, err := lspManager.Definition(ctx, args)
+			if err != nil {
+				return nil, lsp.LocationsResult{}, err
+			}
+			return &mcp.CallToolResult{}, result, nil
+		})
+		addTool(srv, gate, &mcp.Tool{
+			Name:        "lsp_references",
+			Description: "Returns the references to the symbol at a 1-based line and byte column of a file with their source lines, as reported by the language server. Files with the extensions " + exts + " are supported.",
+			Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+		}, func(ctx context.Context, req *mcp.CallToolRequest, args lsp.ReferencesArgs) (*mcp.CallToolResult, lsp.LocationsResult, error) {
+			result, err := lspManager.References(ctx, args)
+			if err != nil {
+				return nil, lsp.LocationsResult{}, err
+			}
+			return &mcp.CallToolResult{}, result, nil
+		})
+		addTool(srv, gate, &mcp.Tool{
+			Name:        "lsp_diagnostics",
+			Description: "Returns the errors and warnings the language server reports for a file after it checked the current content. Files with the extensions " + exts + " are supported.",
+			Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+		}, func(ctx context.Context, req *mcp.CallToolRequest, args lsp.DiagnosticsArgs) (*mcp.CallToolResult, lsp.DiagnosticsResult, error) {
+			result, err := lspManager.Diagnostics(ctx, args)
+			if err != nil {
+				return nil, lsp.DiagnosticsResult{}, err
+			}
+			return &mcp.CallToolResult{}, result, nil
+		})
+		addTool(srv, gate, &mcp.Tool{
+			Name:        "lsp_rename",
+			Description: "Renames the symbol at a 1-based line and byte column of a file everywhere the language server finds it. Returns the diff without changing files unless apply is set; all files are written together or not at all.",
+			Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(false)},
+		}, func(ctx context.Context, req *mcp.CallToolRequest, args lsp.RenameArgs) (*mcp.CallToolResult, lsp.EditResult, error) {
+			result, err := lspManager.Rename(ctx, args)
+			if err != nil {
+				return nil, lsp.EditResult{}, err
+			}
+			return &mcp.CallToolResult{}, result, nil
+		})
+		addTool(srv, gate, &mcp.Tool{
+			Name:        "lsp_code_actions",
+			Description: "Lists the quick fixes and refactorings the language server offers for a position or range of a file, including fixes of its diagnostics there. Set apply to the title of an action to apply it; the changed files and their diff are returned.",
+			Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(false)},
+		}, func(ctx context.Context, req *mcp.CallToolRequest, args lsp.CodeActionsArgs) (*mcp.CallToolResult, lsp.CodeActionsResult, error) {
+			result, err := lspManager.CodeActions(ctx, args)
+			if err != nil {
+				return nil, lsp.CodeActionsResult{}, err
+			}
+			return &mcp.CallToolResult{}, result, nil
+		})
+	}
+
+	gitRunner := git.NewRunner()
+	gitRunner.Env = envPolicy
+	gitRunner.Protected = patterns.Split(gitProtected)
+	gitRunner.CoAuthor = gitCoAuthor
+	gitRunner.Hooks = gitHooks
+
+	// Register the read-only git tools
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "git_status",
+		Description: "Returns the current branch and the staged, unstaged, untracked and conflicted files of the git repository, with paths relative to the working directory.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args git.StatusArgs) (*mcp.CallToolResult, git.StatusResult, error) {
+		result, err := gitRunner.Status(ctx, args)
+		if err != nil {
+			return nil, git.StatusResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "git_diff",
+		Description: "Returns the changed files with line counts and the unified diff of the working tree (default), the staged changes, or between revisions. Use it to review changes before committing.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args git.DiffArgs) (*mcp.CallToolResult, git.DiffResult, error) {
+		result, err := gitRunner.Diff(ctx, args)
+		if err != nil {
+			return nil, git.DiffResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "git_show",
+		Description: "Returns a commit with its message, changed files and diff, or the content of a file at a revision.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args git.ShowArgs) (*mcp.CallToolResult, git.ShowResult, error) {
+		result, err := gitRunner.Show(ctx, args)
+		if err != nil {
+			return nil, git.ShowResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "git_log",
+		Description: "Returns the commits of a revision or range (default HEAD), the most recent first, optionally only those changing paths, by an author or since a date.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args git.LogArgs) (*mcp.CallToolResult, git.LogResult, error) {
+		result, err := gitRunner.Log(ctx, args)
+		if err != nil {
+			return nil, git.LogResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "git_blame",
+		Description: "Returns for each line of a range of a file the commit, author, date and subject of the last change. Use it to find out why code changed.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args git.BlameArgs) (*mcp.CallToolResult, git.BlameResult, error) {
+		result, err := gitRunner.Blame(ctx, args)
+		if err != nil {
+			return nil, git.BlameResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "git_grep",
+		Description: "Searches the tracked files of the working tree, or of a revision, for an extended regular expression. Returns a list of files with line numbers and matching lines.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args git.GrepArgs) (*mcp.CallToolResult, git.GrepResult, error) {
+		result, err := gitRunner.Grep(ctx, args)
+		if err != nil {
+			return nil, git.GrepResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+
+	// Register the mutating git tools; none of them pushes
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "git_add",
+		Description: "Stages the changes of the given paths and returns the new status. Refused on protected branches.",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(false), IdempotentHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args git.AddArgs) (*mcp.CallToolResult, git.StatusResult, error) {
+		result, err := gitRunner.Add(ctx, args)
+		if err != nil {
+			return nil, git.StatusResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "git_commit",
+		Description: "Commits the staged changes with the given message to the current branch. Refused on protected branches; the commit is never pushed.",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(false)},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args git.CommitArgs) (*mcp.CallToolResult, git.CommitResult, error) {
+		result, err := gitRunner.Commit(ctx, args)
+		if err != nil {
+			return nil, git.CommitResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "git_branch_create",
+		Description: "Creates a local branch, optionally switching to it while keeping uncommitted changes. Use it before committing on a protected branch.",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(false)},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args git.BranchCreateArgs) (*mcp.CallToolResult, git.BranchResult, error) {
+		result, err := gitRunner.BranchCreate(ctx, args)
+		if err != nil {
+			return nil, git.BranchResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "git_branch_switch",
+		Description: "Switches to an existing local branch, keeping uncommitted changes. Switching to protected branches is refused.",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(true)},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args git.BranchSwitchArgs) (*mcp.CallToolResult, git.BranchResult, error) {
+		result, err := gitRunner.BranchSwitch(ctx, args)
+		if err != nil {
+			return nil, git.BranchResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "git_stash",
+		Description: "Saves the uncommitted changes and removes them from the working tree (push), re-applies a stash (pop, apply) or lists the stashes (list).",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(true)},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args git.StashArgs) (*mcp.CallToolResult, git.StashResult, error) {
+		result, err := gitRunner.Stash(ctx, args)
+		if err != nil {
+			return nil, git.StashResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+	addTool(srv, gate, &mcp.Tool{
+		Name:        "git_restore",
+		Description: "Discards the uncommitted changes of the given paths in the working tree, or unstages them with staged. Discarded changes cannot be recovered.",
+		Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(true)},
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args git.RestoreArgs) (*mcp.CallToolResult, git.RestoreResult, error) {
+		result, err := gitRunner.Restore(ctx, args)
+		if err != nil {
+			return nil, git.RestoreResult{}, err
+		}
+		return &mcp.CallToolResult{}, result, nil
+	})
+
+	// Register the run_command tool if any commands are allowed
+	if commandFile != "" {
+		if err := commandPolicy.Load(commandFile); err != nil {
+			log.Fatalf("invalid --command-policy: %v", err)
+		}
+	}
+	if len(commandPolicy.Rules) > 0 {
+		commandRunner := command.NewRunner(commandPolicy)
+		commandRunner.Timeout = commandTimeout
+		commandRunner.Env = envPolicy
+		commandRunner.Sandbox = box
+		addTool(srv, gate, &mcp.Tool{
+			Name:        "run_command",
+			Description: "Runs a command without shell in the working directory. Only these commands are allowed (* matches any text, ... any further arguments): " + commandPolicy.String(),
+			Annotations: &mcp.ToolAnnotations{DestructiveHint: boolPtr(true)},
+		}, func(ctx context.Context, req *mcp.CallToolRequest, args command.RunArgs) (*mcp.CallToolResult, command.RunResult, error) {
+			reporter := progress.New(ctx, req, "command")
+			result, err := commandRunner.Run(ctx, args, reporter.Line)
+			reporter.Flush()
+			if err != nil {
+				return nil, command.RunResult{}, err
+			}
+			result.OutputID = outputs.Shorten(&result.Stdout, &result.Stderr)
+			return &mcp.CallToolResult{}, result, nil
+		})
+		locks.Guard("run_command", lock.Keys(func(ctx context.Context, args command.RunArgs) []string { return directoryKey(ctx, args.Directory) }))
+		gate.Guard("run_command", approval.Describe(func(ctx context.Context, args command.RunArgs) (string, error) {
+			return fmt.Sprintf("%s%q (in %s)", runner.FormatEnv(args.Env), args.Command, cmp.Or(args.Directory, ".")), nil
+		}))
+	}
+
+	// Registriere die Search-Funktion als Tool
+	addTool(srv, gate, &mcp.Tool{
 		Name:        "search",
 		Description: "Search for a regex pattern in files within the working directory. Returns a list of files with line numbers and matching lines.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args filesystem.SearchArgs) (*mcp.CallToolResult, filesystem.SearchResult, error) {
 		result, err := filesystem.Search(ctx, args)
 		if err != nil {
@@ -167,9 +943,10 @@ func main() {
 	})
 
 	// Registriere fetch als Alias für filesystem_read_file
-	mcp.AddTool(srv, &mcp.Tool{
+	addTool(srv, gate, &mcp.Tool{
 		Name:        "fetch",
 		Description: "Alias for filesystem_read_file. Reads the content of a file within the working directory.",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
 	}, func(ctx context.Context, req *mcp.CallToolRequest, args filesystem.ReadFileArgs) (*mcp.CallToolResult, filesystem.ReadFileResult, error) {
 		result, err := filesystem.ReadFile(ctx, args)
 		if err != nil {
@@ -178,6 +955,116 @@ func main() {
 		return &mcp.CallToolResult{}, result, nil
 	})
 
+	gate.Guard("filesystem_write_file", approval.Describe(filesystem.PreviewWrite))
+	gate.Guard("make_run", approval.Describe(func(ctx context.Context, args make.RunMakeArgs) (string, error) {
+		return fmt.Sprintf("%smake -C %q %q", runner.FormatEnv(args.Env), cmp.Or(args.Directory, "."), args.Target), nil
+	}))
+	gate.Guard("go_test", approval.Describe(golang.DescribeTest))
+	gate.Guard("go_fmt", approval.Describe(func(ctx context.Context, args golang.FmtArgs) (string, error) {
+		mode := "-l"
+		if args.Apply {
+			mode = "-w"
+		}
+		return fmt.Sprintf("gofmt %s %s", mode, cmp.Or(strings.Join(args.Paths, " "), ".")), nil
+	}))
+	gate.Guard("go_mod_tidy", approval.Describe(func(ctx context.Context, args golang.ModTidyArgs) (string, error) {
+		if args.Check {
+			return fmt.Sprintf("go mod tidy -diff (in %s)", cmp.Or(args.Directory, ".")), nil
+		}
+		return fmt.Sprintf("go mod tidy (in %s)", cmp.Or(args.Directory, ".")), nil
+	}))
+	gate.Guard("git_commit", approval.Describe(func(ctx context.Context, args git.CommitArgs) (string, error) {
+		return "git commit with message:\n\n" + args.Message, nil
+	}))
+	gate.Guard("git_restore", approval.Describe(func(ctx context.Context, args git.RestoreArgs) (string, error) {
+		if args.Staged {
+			return fmt.Sprintf("git restore --staged %s", strings.Join(args.Paths, " ")), nil
+		}
+		return fmt.Sprintf("git restore %s (discards uncommitted changes)", strings.Join(args.Paths, " ")), nil
+	}))
+	gate.Guard("code_rename", approval.Describe(code.PreviewRename))
+	if lspManager != nil {
+		gate.Guard("lsp_rename", approval.Describe(lspManager.PreviewRename))
+		gate.Guard("lsp_code_actions", approval.Describe(func(ctx context.Context, args lsp.CodeActionsArgs) (string, error) {
+			if args.Apply == "" {
+				// Listing the actions does not change anything
+				return "", approval.ErrNotGuarded
+			}
+			return lspManager.PreviewCodeAction(ctx, args)
+		}))
+	}
+	gate.Guard("job_start", approval.Describe(func(ctx context.Context, args jobs.StartArgs) (string, error) {
+		return fmt.Sprintf("%smake -C %q %q (background job)", runner.FormatEnv(args.Env), cmp.Or(args.Directory, "."), args.Target), nil
+	}))
+
+	locks.Guard("filesystem_write_file", lock.Keys(writeFiles))
+	for _, tool := range []string{"git_add", "git_commit", "git_branch_create", "git_branch_switch", "git_stash", "git_restore"} {
+		locks.Guard(tool, lock.Keys(func(ctx context.Context, args struct{}) []string { return directoryKey(ctx, "") }))
+	}
+	locks.Guard("make_run", lock.Keys(func(ctx context.Context, args make.RunMakeArgs) []string { return directoryKey(ctx, args.Directory) }))
+	// go_build, go_vet and go_list do not modify the workspace and run in parallel
+	locks.Guard("go_test", lock.Keys(func(ctx context.Context, args golang.TestArgs) []string { return directoryKey(ctx, args.Directory) }))
+	locks.Guard("go_mod_tidy", lock.Keys(func(ctx context.Context, args golang.ModTidyArgs) []string { return directoryKey(ctx, args.Directory) }))
+	// A rename may change any file of the module
+	locks.Guard("code_rename", lock.Keys(func(ctx context.Context, args code.RenameArgs) []string { return directoryKey(ctx, "") }))
+	// Edits of language servers may change any file of the workspace
+	locks.Guard("lsp_rename", lock.Keys(func(ctx context.Context, args lsp.RenameArgs) []string { return directoryKey(ctx, "") }))
+	locks.Guard("lsp_code_actions", lock.Keys(func(ctx context.Context, args lsp.CodeActionsArgs) []string { return directoryKey(ctx, "") }))
+	locks.Guard("go_fmt", lock.Keys(func(ctx context.Context, args golang.FmtArgs) []string {
+		paths := args.Paths
+		if len(paths) == 0 {
+			paths = []string{"."}
+		}
+		var keys []string
+		for _, p := range paths {
+			if path, err := filesystem.ResolvePath(ctx, p); err == nil {
+				keys = append(keys, path)
+			}
+		}
+		return keys
+	}))
+
+	// The first middleware is the outermost one
+	var middlewares []mcp.Middleware
+	if worktrees != nil {
+		// All other middlewares resolve paths in the worktree of the session
+		middlewares = append(middlewares, worktrees.Middleware)
+	}
+	if lspManager != nil {
+		// Language servers learn about the files written by other tools
+		lspManager.TrackFiles("filesystem_write_file", lsp.Files(writeFiles))
+		lspManager.TrackFiles("go_mod_tidy", lsp.Files(modFiles))
+		lspManager.TrackResultFiles("go_fmt", lsp.ResultFiles(fmtFiles))
+		lspManager.TrackResultFiles("git_restore", lsp.ResultFiles(restoreFiles))
+		lspManager.TrackResultFiles("git_stash", lsp.ResultFiles(stashFiles))
+		lspManager.TrackResultFiles("code_rename", lsp.ResultFiles(renameFiles))
+		middlewares = append(middlewares, lspManager.Middleware)
+	}
+	if auditLog != "" {
+		auditLogger, err := audit.Open(auditLog)
+		if err != nil {
+			log.Fatalf("Audit log error: %v", err)
+		}
+		defer auditLogger.Close()
+		auditLogger.TrackFiles("filesystem_write_file", audit.Files(writeFiles))
+		auditLogger.TrackFiles("go_mod_tidy", audit.Files(modFiles))
+		auditLogger.TrackResultFiles("go_fmt", audit.ResultFiles(fmtFiles))
+		auditLogger.TrackResultFiles("git_restore", audit.ResultFiles(restoreFiles))
+		auditLogger.TrackResultFiles("git_stash", audit.ResultFiles(stashFiles))
+		auditLogger.TrackResultFiles("code_rename", audit.ResultFiles(renameFiles))
+		auditLogger.TrackResultFiles("lsp_rename", audit.ResultFiles(lspEditFiles))
+		auditLogger.TrackResultFiles("lsp_code_actions", audit.ResultFiles(codeActionFiles))
+		middlewares = append(middlewares, auditLogger.Middleware)
+	}
+	if toolRate > 0 {
+		middlewares = append(middlewares, auth.NewRateLimiter(toolRate, toolRate/4).Middleware)
+	}
+	// Without a fallback prompter, guarded calls of clients lacking elicitation are denied
+	middlewares = append(middlewares, gate.Middleware)
+	// Locks are taken after approval, so waiting for the human does not block other calls
+	middlewares = append(middlewares, locks.Middleware)
+	srv.AddReceivingMiddleware(middlewares...)
+
 	srv.AddResource(&mcp.Resource{
 		Name:     "info",
 		MIMEType: "text/plain",
@@ -190,14 +1077,52 @@ func main() {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
+	guardConfig := auth.DefaultGuardConfig()
+	proxies, err := auth.ParsePrefixes(trustedProxies)
+	if err != nil {
+		log.Fatalf("invalid --trusted-proxy: %v", err)
+	}
+	guardConfig.TrustedProxies = proxies
+	guard := auth.NewGuard(guardConfig)
+
+	var authMiddleware func(http.Handler) http.Handler
+	switch authMode {
+	case "apikey":
+		authMiddleware = auth.APIKeyMiddleware(showKey)
+	case "oauth":
+		oauth := auth.NewOAuthServer(auth.LoadAPIKey(showKey), publicURL)
+		oauth.Mount(r, guard)
+		authMiddleware = oauth.Middleware
+	default:
+		log.Fatalf("unknown authorization mode %q", authMode)
+	}
+
+	// Metrics of the brute-force protection and rate limits
+	r.With(guard.Middleware, authMiddleware).Handle("/debug/vars", expvar.Handler())
+
 	// MCP-Handler registrieren
-	r.With(auth.APIKeyMiddleware).Handle("/mcp/*", mcp.NewStreamableHTTPHandler(func(req *http.Request) *mcp.Server {
+	r.With(guard.Middleware, authMiddleware).Handle("/mcp/*", mcp.NewStreamableHTTPHandler(func(req *http.Request) *mcp.Server {
 		return srv
 	}, nil))
 
-	addr := ":" + port
-	log.Printf("MCPilot pair server is running on %s", addr)
-	if err := http.ListenAndServe(addr, r); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		// Open event streams keep connections busy, so close them after the grace period
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			server.Close()
+		}
+	}()
+
+	log.Printf("MCPilot pair server is running on %s", server.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Server error: %v", err)
 	}
+	jobManager.Close()
 }
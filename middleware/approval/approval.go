@@ -0,0 +1,252 @@
+// Package approval puts a human in the loop for tool calls which modify the workspace.
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// DefaultTimeout is how long a tool call waits for a decision before it is denied.
+const DefaultTimeout = 5 * time.Minute
+
+// maxElicitDetails limits the details sent in an elicitation, clients render them inline.
+const maxElicitDetails = 8 << 10
+
+// Decision is the answer of a human to a [Request].
+type Decision int
+
+const (
+	Deny Decision = iota
+	Approve
+	// AlwaysAllow approves the call and all further calls of the same tool in the session.
+	AlwaysAllow
+)
+
+func (d Decision) String() string {
+	switch d {
+	case Approve:
+		return "approved"
+	case AlwaysAllow:
+		return "always allowed"
+	default:
+		return "denied"
+	}
+}
+
+// Request describes a tool call waiting for approval.
+type Request struct {
+	ID        string
+	SessionID string
+	Tool      string
+	// Details show what the call is going to do, e.g. a diff or a command line.
+	Details string
+}
+
+// Prompter asks a human to decide on a request.
+type Prompter interface {
+	Prompt(ctx context.Context, req Request) (Decision, error)
+}
+
+// ErrNotGuarded is returned by a [DescribeFunc] for calls which need no approval, e.g.
+// because only some arguments of the tool make it modify the workspace.
+var ErrNotGuarded = errors.New("call needs no approval")
+
+// DescribeFunc renders the details of a tool call from its raw arguments.
+type DescribeFunc func(ctx context.Context, arguments json.RawMessage) (string, error)
+
+// Describe adapts a function taking the typed arguments of a tool to a [DescribeFunc].
+func Describe[In any](fn func(ctx context.Context, args In) (string, error)) DescribeFunc {
+	return func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		var args In
+		if len(arguments) > 0 {
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return "", fmt.Errorf("invalid arguments: %v", err)
+			}
+		}
+		return fn(ctx, args)
+	}
+}
+
+// describeArguments is the fallback showing the pretty-printed arguments of a call.
+func describeArguments(_ context.Context, arguments json.RawMessage) (string, error) {
+	var v any
+	if err := json.Unmarshal(arguments, &v); err != nil {
+		return string(arguments), nil
+	}
+	pretty, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return string(arguments), nil
+	}
+	return string(pretty), nil
+}
+
+// Gate holds back calls of guarded tools until a human approved them. Clients supporting
+// elicitation are asked directly, otherwise the fallback prompter is used.
+type Gate struct {
+	fallback Prompter
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	tools   map[string]DescribeFunc
+	allowed map[string]map[string]bool // session ID -> tool name
+	nextID  int
+}
+
+// NewGate creates a gate asking fallback for approval if the client does not support elicitation.
+func NewGate(fallback Prompter, timeout time.Duration) *Gate {
+	return &Gate{
+		fallback: fallback,
+		timeout:  timeout,
+		tools:    make(map[string]DescribeFunc),
+		allowed:  make(map[string]map[string]bool),
+	}
+}
+
+// Guard requires approval for every call of tool. describe renders the details shown to the
+// human; if nil, the arguments of the call are shown.
+func (g *Gate) Guard(tool string, describe DescribeFunc) {
+	if describe == nil {
+		describe = describeArguments
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.tools[tool] = describe
+}
+
+// Middleware is an MCP middleware holding back calls of guarded tools until they are approved.
+// Denied calls return a tool error, so the model learns about the decision.
+func (g *Gate) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || method != "tools/call" {
+			return next(ctx, method, req)
+		}
+
+		sessionID := call.Session.ID()
+		g.mu.Lock()
+		describe, guarded := g.tools[call.Params.Name]
+		allowed := g.allowed[sessionID][call.Params.Name]
+		g.nextID++
+		id := fmt.Sprintf("%06d", g.nextID)
+		g.mu.Unlock()
+		if !guarded || allowed {
+			return next(ctx, method, req)
+		}
+
+		details, err := describe(ctx, call.Params.Arguments)
+		if errors.Is(err, ErrNotGuarded) {
+			return next(ctx, method, req)
+		}
+		if err != nil {
+			details = fmt.Sprintf("(could not render details: %v)\n\n%s", err, call.Params.Arguments)
+		}
+		approvalReq := Request{ID: id, SessionID: sessionID, Tool: call.Params.Name, Details: details}
+
+		decision, err := g.ask(ctx, call.Session, approvalReq)
+		if err != nil {
+			log.Printf("approval of %s failed: %v", call.Params.Name, err)
+			decision = Deny
+		}
+		log.Printf("call of %s in session %s %s", call.Params.Name, sessionID, decision)
+
+		switch decision {
+		case AlwaysAllow:
+			g.mu.Lock()
+			if g.allowed[sessionID] == nil {
+				g.allowed[sessionID] = make(map[string]bool)
+			}
+			g.allowed[sessionID][call.Params.Name] = true
+			g.mu.Unlock()
+			fallthrough
+		case Approve:
+			return next(ctx, method, req)
+		default:
+			msg := fmt.Sprintf("The user denied the call of %s.", call.Params.Name)
+			if err != nil {
+				msg = fmt.Sprintf("The call of %s was not approved: %v", call.Params.Name, err)
+			}
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{&mcp.TextContent{Text: msg}},
+			}, nil
+		}
+	}
+}
+
+// Forget drops the "always allow" rules of a session, e.g. when it ended.
+func (g *Gate) Forget(sessionID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.allowed, sessionID)
+}
+
+// ask obtains a decision via elicitation if the client supports it, otherwise via the fallback prompter.
+func (g *Gate) ask(ctx context.Context, ss *mcp.ServerSession, req Request) (Decision, error) {
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	var decision Decision
+	var err error
+	if supportsElicitation(ss) {
+		decision, err = elicit(ctx, ss, req)
+	} else if g.fallback != nil {
+		decision, err = g.fallback.Prompt(ctx, req)
+	} else {
+		return Deny, errors.New("no way to ask for approval")
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Deny, fmt.Errorf("no decision within %s", g.timeout)
+	}
+	return decision, err
+}
+
+// supportsElicitation reports whether the client of ss announced the elicitation capability.
+func supportsElicitation(ss *mcp.ServerSession) bool {
+	params := ss.InitializeParams()
+	return params != nil && params.Capabilities != nil && params.Capabilities.Elicitation != nil
+}
+
+// elicitSchema is the form shown to the user; accepting it approves the call.
+var elicitSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"always_allow": map[string]any{
+			"type":        "boolean",
+			"title":       "Always allow",
+			"description": "Allow all further calls of this tool in this session without asking",
+			"default":     false,
+		},
+	},
+}
+
+// elicit asks the user through the MCP client.
+func elicit(ctx context.Context, ss *mcp.ServerSession, req Request) (Decision, error) {
+	details := req.Details
+	if len(details) > maxElicitDetails {
+		details = details[:maxElicitDetails] + "\n[…]"
+	}
+	res, err := ss.Elicit(ctx, &mcp.ElicitParams{
+		Message:         fmt.Sprintf("Allow %s?\n\n%s", req.Tool, details),
+		RequestedSchema: elicitSchema,
+	})
+	if err != nil {
+		return Deny, err
+	}
+	if res.Action != "accept" {
+		return Deny, nil
+	}
+	if always, _ := res.Content["always_allow"].(bool); always {
+		return AlwaysAllow, nil
+	}
+	return Approve, nil
+}
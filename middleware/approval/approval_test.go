@@ -0,0 +1,168 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// fakePrompter answers every request with a fixed decision and remembers the requests.
+type fakePrompter struct {
+	decision Decision
+	requests []Request
+}
+
+func (p *fakePrompter) Prompt(_ context.Context, req Request) (Decision, error) {
+	p.requests = append(p.requests, req)
+	return p.decision, nil
+}
+
+type echoArgs struct {
+	Text string `json:"text"`
+}
+
+// connect starts a server with a guarded and an unguarded tool and connects a client to it.
+func connect(t *testing.T, gate *Gate, clientOpts *mcp.ClientOptions) *mcp.ClientSession {
+	t.Helper()
+	srv := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	handler := func(ctx context.Context, req *mcp.CallToolRequest, args echoArgs) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: args.Text}}}, nil, nil
+	}
+	mcp.AddTool(srv, &mcp.Tool{Name: "write"}, handler)
+	mcp.AddTool(srv, &mcp.Tool{Name: "read"}, handler)
+	gate.Guard("write", Describe(func(_ context.Context, args echoArgs) (string, error) {
+		if args.Text == "" {
+			return "", ErrNotGuarded
+		}
+		return "write " + args.Text, nil
+	}))
+	srv.AddReceivingMiddleware(gate.Middleware)
+
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	ss, err := srv.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect server: %v", err)
+	}
+	t.Cleanup(func() { ss.Close() })
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "client"}, clientOpts)
+	cs, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	t.Cleanup(func() { cs.Close() })
+	return cs
+}
+
+func callTool(t *testing.T, cs *mcp.ClientSession, name, text string) *mcp.CallToolResult {
+	t.Helper()
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      name,
+		Arguments: map[string]any{"text": text},
+	})
+	if err != nil {
+		t.Fatalf("Failed to call %s: %v", name, err)
+	}
+	return res
+}
+
+func TestGateFallbackPrompter(t *testing.T) {
+	tests := []struct {
+		name        string
+		decision    Decision
+		expectError bool
+		expectAsked int
+	}{
+		{"Denied", Deny, true, 2},
+		{"Approved once", Approve, false, 2},
+		{"Always allowed", AlwaysAllow, false, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			prompter := &fakePrompter{decision: tc.decision}
+			cs := connect(t, NewGate(prompter, DefaultTimeout), nil)
+
+			for i := 0; i < 2; i++ {
+				res := callTool(t, cs, "write", "hello")
+				if res.IsError != tc.expectError {
+					t.Errorf("Call %d: expected IsError=%v, got %v", i, tc.expectError, res.IsError)
+				}
+			}
+			if len(prompter.requests) != tc.expectAsked {
+				t.Fatalf("Expected %d prompts, got %d", tc.expectAsked, len(prompter.requests))
+			}
+			if got := prompter.requests[0]; got.Tool != "write" || got.Details != "write hello" {
+				t.Errorf("Unexpected request: %+v", got)
+			}
+
+			if res := callTool(t, cs, "read", "hello"); res.IsError {
+				t.Error("Expected unguarded tool to pass")
+			}
+			if len(prompter.requests) != tc.expectAsked {
+				t.Errorf("Expected unguarded tool not to be prompted")
+			}
+		})
+	}
+}
+
+func TestGateNotGuarded(t *testing.T) {
+	prompter := &fakePrompter{decision: Deny}
+	cs := connect(t, NewGate(prompter, DefaultTimeout), nil)
+	if res := callTool(t, cs, "write", ""); res.IsError {
+		t.Error("Expected call needing no approval to pass")
+	}
+	if len(prompter.requests) != 0 {
+		t.Errorf("Expected call needing no approval not to be prompted, got %+v", prompter.requests)
+	}
+}
+
+func TestGateElicitation(t *testing.T) {
+	prompter := &fakePrompter{decision: Deny}
+	var messages []string
+	cs := connect(t, NewGate(prompter, DefaultTimeout), &mcp.ClientOptions{
+		ElicitationHandler: func(_ context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+			messages = append(messages, req.Params.Message)
+			return &mcp.ElicitResult{Action: "accept", Content: map[string]any{"always_allow": false}}, nil
+		},
+	})
+
+	if res := callTool(t, cs, "write", "hello"); res.IsError {
+		t.Errorf("Expected call approved via elicitation to succeed")
+	}
+	if len(prompter.requests) != 0 {
+		t.Errorf("Expected fallback prompter not to be used")
+	}
+	if len(messages) != 1 || !strings.Contains(messages[0], "write hello") {
+		t.Errorf("Expected elicitation to show the details, got %q", messages)
+	}
+}
+
+func TestGateWithoutPrompter(t *testing.T) {
+	cs := connect(t, NewGate(nil, DefaultTimeout), nil)
+	if res := callTool(t, cs, "write", "hello"); !res.IsError {
+		t.Error("Expected call to be denied if nobody can be asked")
+	}
+}
+
+func TestTerminalPrompter(t *testing.T) {
+	var out bytes.Buffer
+	p := NewTerminalPrompter(strings.NewReader("maybe\na\n"), &out)
+
+	decision, err := p.Prompt(context.Background(), Request{Tool: "make_run", Details: "make test"})
+	if err != nil || decision != AlwaysAllow {
+		t.Errorf("Expected always allow, got %s (%v)", decision, err)
+	}
+	if !strings.Contains(out.String(), "make test") {
+		t.Errorf("Expected details on the terminal, got %q", out.String())
+	}
+
+	decision, err = p.Prompt(context.Background(), Request{Tool: "make_run"})
+	if err == nil || decision != Deny {
+		t.Errorf("Expected closed terminal to deny, got %s (%v)", decision, err)
+	}
+}
@@ -0,0 +1,60 @@
+package approval
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// TerminalPrompter asks for approval on the terminal the server was started from.
+type TerminalPrompter struct {
+	out io.Writer
+
+	// mu serialises prompts, only one question can be answered at a time.
+	mu    sync.Mutex
+	lines chan string
+}
+
+// NewTerminalPrompter reads answers from in and writes questions to out.
+func NewTerminalPrompter(in io.Reader, out io.Writer) *TerminalPrompter {
+	p := &TerminalPrompter{out: out, lines: make(chan string)}
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			p.lines <- scanner.Text()
+		}
+		close(p.lines)
+	}()
+	return p
+}
+
+// Prompt implements [Prompter].
+func (p *TerminalPrompter) Prompt(ctx context.Context, req Request) (Decision, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintf(p.out, "\n=== Approval required: %s (session %s) ===\n%s\n", req.Tool, req.SessionID, strings.TrimRight(req.Details, "\n"))
+	for {
+		fmt.Fprint(p.out, "Allow? [y]es, [n]o, [a]lways in this session: ")
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(p.out, "\nno answer, denied")
+			return Deny, ctx.Err()
+		case line, ok := <-p.lines:
+			if !ok {
+				return Deny, fmt.Errorf("terminal closed")
+			}
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "y", "yes":
+				return Approve, nil
+			case "a", "always":
+				return AlwaysAllow, nil
+			case "n", "no":
+				return Deny, nil
+			}
+		}
+	}
+}
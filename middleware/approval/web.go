@@ -0,0 +1,174 @@
+package approval
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// WebPrompter asks for approval on a small web page which is only reachable from localhost.
+type WebPrompter struct {
+	addr  string
+	token string // protects the decision form against cross-site requests
+
+	mu      sync.Mutex
+	pending map[string]*pendingRequest
+}
+
+type pendingRequest struct {
+	Request
+	decision chan Decision
+}
+
+// NewWebPrompter creates a prompter serving its page on addr, which must be a loopback address.
+func NewWebPrompter(addr string) *WebPrompter {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("could not generate form token: " + err.Error())
+	}
+	return &WebPrompter{
+		addr:    addr,
+		token:   base64.RawURLEncoding.EncodeToString(b),
+		pending: make(map[string]*pendingRequest),
+	}
+}
+
+// ListenAndServe serves the approval page until ctx is done.
+func (p *WebPrompter) ListenAndServe(ctx context.Context) error {
+	host, _, err := net.SplitHostPort(p.addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return &net.AddrError{Err: "approval page must listen on a loopback address", Addr: p.addr}
+	}
+
+	srv := &http.Server{Addr: p.addr, Handler: p}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	log.Printf("Approval page is available at http://%s/", p.addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Prompt implements [Prompter].
+func (p *WebPrompter) Prompt(ctx context.Context, req Request) (Decision, error) {
+	pr := &pendingRequest{Request: req, decision: make(chan Decision, 1)}
+	p.mu.Lock()
+	p.pending[req.ID] = pr
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, req.ID)
+		p.mu.Unlock()
+	}()
+
+	log.Printf("call of %s waits for approval at http://%s/", req.Tool, p.addr)
+	select {
+	case d := <-pr.decision:
+		return d, nil
+	case <-ctx.Done():
+		return Deny, ctx.Err()
+	}
+}
+
+var pageTemplate = template.Must(template.New("approval").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+{{if not .Requests}}<meta http-equiv="refresh" content="2">{{end}}
+<title>MCPilot Pair – Approvals</title>
+<style>
+body { font-family: sans-serif; max-width: 60rem; margin: 2rem auto; padding: 0 1rem; }
+pre { background: #f4f4f4; padding: 1rem; overflow: auto; max-height: 30rem; }
+button { padding: .5rem 1rem; margin-right: .5rem; }
+</style>
+</head>
+<body>
+<h1>Pending approvals</h1>
+{{range .Requests}}
+<section>
+<h2>{{.Tool}} <small>(session {{.SessionID}})</small></h2>
+<pre>{{.Details}}</pre>
+<form method="post" action="/decide">
+<input type="hidden" name="token" value="{{$.Token}}">
+<input type="hidden" name="id" value="{{.ID}}">
+<button type="submit" name="decision" value="approve">Approve</button>
+<button type="submit" name="decision" value="always">Always allow in this session</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</section>
+{{else}}
+<p>Nothing to approve. This page refreshes automatically.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// ServeHTTP serves the list of pending requests and accepts decisions.
+func (p *WebPrompter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Reject DNS rebinding, the page must be addressed by its loopback name.
+	if host, _, err := net.SplitHostPort(r.Host); err != nil || (host != "localhost" && !isLoopback(host)) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/":
+		p.mu.Lock()
+		requests := make([]Request, 0, len(p.pending))
+		for _, pr := range p.pending {
+			requests = append(requests, pr.Request)
+		}
+		p.mu.Unlock()
+		sort.Slice(requests, func(i, j int) bool { return requests[i].ID < requests[j].ID })
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := pageTemplate.Execute(w, map[string]any{"Requests": requests, "Token": p.token}); err != nil {
+			log.Printf("failed to render approval page: %v", err)
+		}
+
+	case r.Method == http.MethodPost && r.URL.Path == "/decide":
+		if subtle.ConstantTimeCompare([]byte(r.PostFormValue("token")), []byte(p.token)) != 1 {
+			http.Error(w, "invalid form token", http.StatusForbidden)
+			return
+		}
+		decision := Deny
+		switch r.PostFormValue("decision") {
+		case "approve":
+			decision = Approve
+		case "always":
+			decision = AlwaysAllow
+		}
+		p.mu.Lock()
+		if pr, ok := p.pending[r.PostFormValue("id")]; ok {
+			select {
+			case pr.decision <- decision:
+			default:
+			}
+		}
+		p.mu.Unlock()
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,297 @@
+// Package audit records every tool call in an append-only JSONL log.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/seb-schulz/mcpilot-pair/middleware/auth"
+)
+
+const (
+	// maxStringLen is the length up to which argument values are recorded verbatim.
+	maxStringLen = 256
+	// maxSummaryLen is the length up to which the result of a call is recorded.
+	maxSummaryLen = 200
+)
+
+// secretKey matches argument names whose values must never be written to the log.
+var secretKey = regexp.MustCompile(`(?i)(token|secret|passw(or)?d|api[_-]?key|authorization|credential|private[_-]?key)`)
+
+// Entry is a single line of the audit log.
+type Entry struct {
+	Time       time.Time       `json:"time"`
+	SessionID  string          `json:"session_id"`
+	KeyLabel   string          `json:"key_label"`
+	Tool       string          `json:"tool"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	IsError    bool            `json:"is_error"`
+	Summary    string          `json:"summary,omitempty"`
+	Files      []FileChange    `json:"files,omitempty"`
+	DurationMS int64           `json:"duration_ms"`
+}
+
+// FileChange records the content hashes of a file before and after a call.
+// An empty hash means the file did not exist. The hash before the call is unknown
+// for files which the tool only reported in its result.
+type FileChange struct {
+	Path          string `json:"path"`
+	Before        string `json:"before,omitempty"`
+	After         string `json:"after,omitempty"`
+	BeforeUnknown bool   `json:"before_unknown,omitempty"`
+}
+
+// FilesFunc returns the absolute paths of the files a call with the given arguments is going to touch.
+type FilesFunc func(ctx context.Context, arguments json.RawMessage) []string
+
+// Files adapts a function taking the typed arguments of a tool to a [FilesFunc].
+func Files[In any](fn func(ctx context.Context, args In) []string) FilesFunc {
+	return func(ctx context.Context, arguments json.RawMessage) []string {
+		var args In
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return nil
+		}
+		return fn(ctx, args)
+	}
+}
+
+// ResultFilesFunc returns the absolute paths of the files a call changed according to its result.
+type ResultFilesFunc func(ctx context.Context, result *mcp.CallToolResult) []string
+
+// ResultFiles adapts a function taking the typed result of a tool to a [ResultFilesFunc].
+func ResultFiles[Out any](fn func(ctx context.Context, result Out) []string) ResultFilesFunc {
+	return func(ctx context.Context, result *mcp.CallToolResult) []string {
+		var out Out
+		data, err := json.Marshal(result.StructuredContent)
+		if err != nil || json.Unmarshal(data, &out) != nil {
+			return nil
+		}
+		return fn(ctx, out)
+	}
+}
+
+// Logger appends an [Entry] for every tool call to a file.
+type Logger struct {
+	mu          sync.Mutex
+	file        *os.File
+	files       map[string]FilesFunc
+	resultFiles map[string]ResultFilesFunc
+}
+
+// DefaultPath returns the XDG-compliant location of the audit log: ~/.local/state/mcpilot-pair/audit.jsonl.
+func DefaultPath() string {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "audit.jsonl"
+		}
+		stateDir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateDir, "mcpilot-pair", "audit.jsonl")
+}
+
+// Open opens the audit log at path for appending, creating it if necessary.
+func Open(path string) (*Logger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("could not create audit log directory: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log: %v", err)
+	}
+	return &Logger{file: f, files: make(map[string]FilesFunc), resultFiles: make(map[string]ResultFilesFunc)}, nil
+}
+
+// Close closes the underlying file.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// TrackFiles records the hashes of the files returned by fn before and after every call of tool.
+func (l *Logger) TrackFiles(tool string, fn FilesFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.files[tool] = fn
+}
+
+// TrackResultFiles records the hashes of the files returned by fn after every successful
+// call of tool. It is meant for tools which only know the files they change when done.
+func (l *Logger) TrackResultFiles(tool string, fn ResultFilesFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resultFiles[tool] = fn
+}
+
+// Middleware is an MCP middleware writing an entry for every tool call.
+func (l *Logger) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || method != "tools/call" {
+			return next(ctx, method, req)
+		}
+
+		l.mu.Lock()
+		filesFunc := l.files[call.Params.Name]
+		resultFilesFunc := l.resultFiles[call.Params.Name]
+		l.mu.Unlock()
+		var files []FileChange
+		if filesFunc != nil {
+			for _, path := range filesFunc(ctx, call.Params.Arguments) {
+				files = append(files, FileChange{Path: path, Before: hashFile(path)})
+			}
+		}
+
+		start := time.Now()
+		res, err := next(ctx, method, req)
+
+		entry := Entry{
+			Time:       start.UTC(),
+			SessionID:  call.Session.ID(),
+			KeyLabel:   auth.KeyLabel(nil),
+			Tool:       call.Params.Name,
+			Arguments:  Redact(call.Params.Arguments),
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if call.Extra != nil {
+			entry.KeyLabel = auth.KeyLabel(call.Extra.TokenInfo)
+		}
+		for i := range files {
+			files[i].After = hashFile(files[i].Path)
+		}
+		if ctr, ok := res.(*mcp.CallToolResult); ok && ctr != nil && !ctr.IsError && err == nil && resultFilesFunc != nil {
+			for _, path := range resultFilesFunc(ctx, ctr) {
+				if !slices.ContainsFunc(files, func(f FileChange) bool { return f.Path == path }) {
+					files = append(files, FileChange{Path: path, After: hashFile(path), BeforeUnknown: true})
+				}
+			}
+		}
+		entry.Files = files
+		entry.IsError, entry.Summary = summarize(res, err)
+
+		if err := l.write(entry); err != nil {
+			log.Printf("failed to write audit log: %v", err)
+		}
+		return res, err
+	}
+}
+
+// write appends entry to the log.
+func (l *Logger) write(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+// summarize describes the outcome of a call in a single short line.
+func summarize(res mcp.Result, err error) (bool, string) {
+	if err != nil {
+		return true, truncate(err.Error(), maxSummaryLen)
+	}
+	ctr, ok := res.(*mcp.CallToolResult)
+	if !ok || ctr == nil {
+		return false, ""
+	}
+	for _, c := range ctr.Content {
+		if text, ok := c.(*mcp.TextContent); ok {
+			return ctr.IsError, truncate(text.Text, maxSummaryLen)
+		}
+	}
+	if ctr.StructuredContent != nil {
+		if data, err := json.Marshal(ctr.StructuredContent); err == nil {
+			return ctr.IsError, truncate(string(data), maxSummaryLen)
+		}
+	}
+	return ctr.IsError, ""
+}
+
+// Redact returns the arguments with secret values replaced and long strings shortened.
+func Redact(arguments json.RawMessage) json.RawMessage {
+	if len(arguments) == 0 {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(arguments, &v); err != nil {
+		return nil
+	}
+	data, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			if secretKey.MatchString(k) {
+				v[k] = "[REDACTED]"
+			} else {
+				v[k] = redactValue(val)
+			}
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+		return v
+	case string:
+		if len(v) > maxStringLen {
+			return fmt.Sprintf("%s… (%d bytes, sha256:%s)", truncate(v, maxStringLen), len(v), hashString(v))
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// truncate shortens s to at most n bytes without splitting UTF-8 sequences.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFile returns the SHA-256 of the file's content, or "" if it cannot be read.
+func hashFile(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
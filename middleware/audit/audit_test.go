@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type writeArgs struct {
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	APIToken string `json:"api_token,omitempty"`
+}
+
+func TestMiddleware(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "state", "audit.jsonl")
+	logger, err := Open(logPath)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer logger.Close()
+
+	srv := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(srv, &mcp.Tool{Name: "write"}, func(ctx context.Context, req *mcp.CallToolRequest, args writeArgs) (*mcp.CallToolResult, any, error) {
+		if err := os.WriteFile(filepath.Join(dir, args.Path), []byte(args.Content), 0644); err != nil {
+			return nil, nil, err
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "written"}}}, nil, nil
+	})
+	mcp.AddTool(srv, &mcp.Tool{Name: "fail"}, func(ctx context.Context, req *mcp.CallToolRequest, args writeArgs) (*mcp.CallToolResult, any, error) {
+		return nil, nil, errors.New("boom")
+	})
+	type renameResult struct {
+		Files []string `json:"files"`
+	}
+	mcp.AddTool(srv, &mcp.Tool{Name: "rename"}, func(ctx context.Context, req *mcp.CallToolRequest, args writeArgs) (*mcp.CallToolResult, renameResult, error) {
+		if err := os.WriteFile(filepath.Join(dir, args.Path), []byte(args.Content), 0644); err != nil {
+			return nil, renameResult{}, err
+		}
+		return &mcp.CallToolResult{}, renameResult{Files: []string{args.Path}}, nil
+	})
+	logger.TrackFiles("write", Files(func(ctx context.Context, args writeArgs) []string {
+		return []string{filepath.Join(dir, args.Path)}
+	}))
+	logger.TrackResultFiles("rename", ResultFiles(func(ctx context.Context, result renameResult) []string {
+		var paths []string
+		for _, f := range result.Files {
+			paths = append(paths, filepath.Join(dir, f))
+		}
+		return paths
+	}))
+	srv.AddReceivingMiddleware(logger.Middleware)
+
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	ss, err := srv.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect server: %v", err)
+	}
+	defer ss.Close()
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil).Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer cs.Close()
+
+	long := strings.Repeat("x", 1000)
+	for _, call := range []struct {
+		tool string
+		args map[string]any
+	}{
+		{"write", map[string]any{"path": "a.txt", "content": long, "api_token": "s3cr3t"}},
+		{"fail", map[string]any{"path": "b.txt", "content": ""}},
+		{"rename", map[string]any{"path": "a.txt", "content": "renamed"}},
+	} {
+		if _, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: call.tool, Arguments: call.args}); err != nil {
+			t.Fatalf("Failed to call %s: %v", call.tool, err)
+		}
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	if strings.Contains(string(data), "s3cr3t") || strings.Contains(string(data), long) {
+		t.Errorf("Audit log contains secret or unabridged content:\n%s", data)
+	}
+
+	entries, err := Query(bytes.NewReader(data), Filter{}, 0)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d (%v)", len(entries), err)
+	}
+
+	write := entries[0]
+	if write.Tool != "write" || write.SessionID != ss.ID() || write.IsError || write.Summary != "written" {
+		t.Errorf("Unexpected entry: %+v", write)
+	}
+	if len(write.Files) != 1 || write.Files[0].Before != "" || write.Files[0].After != hashString(long) {
+		t.Errorf("Unexpected file changes: %+v", write.Files)
+	}
+	var args map[string]string
+	json.Unmarshal(write.Arguments, &args)
+	if args["api_token"] != "[REDACTED]" || args["path"] != "a.txt" {
+		t.Errorf("Unexpected arguments: %s", write.Arguments)
+	}
+
+	if fail := entries[1]; fail.Tool != "fail" || !fail.IsError || !strings.Contains(fail.Summary, "boom") {
+		t.Errorf("Unexpected entry: %+v", fail)
+	}
+
+	// Files reported in the result are recorded after the call
+	rename := entries[2]
+	want := FileChange{Path: filepath.Join(dir, "a.txt"), After: hashString("renamed"), BeforeUnknown: true}
+	if len(rename.Files) != 1 || rename.Files[0] != want {
+		t.Errorf("Unexpected file changes: %+v", rename.Files)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	log := `{"time":"2025-01-01T10:00:00Z","session_id":"s1","tool":"make_run","is_error":true}
+not json
+{"time":"2025-01-01T11:00:00Z","session_id":"s2","tool":"filesystem_write_file"}
+{"time":"2025-01-01T12:00:00Z","session_id":"s1","tool":"filesystem_write_file"}
+`
+	tests := []struct {
+		name     string
+		filter   Filter
+		limit    int
+		expected []string
+	}{
+		{"All", Filter{}, 0, []string{"make_run", "filesystem_write_file", "filesystem_write_file"}},
+		{"Last entry", Filter{}, 1, []string{"filesystem_write_file"}},
+		{"By session", Filter{SessionID: "s1"}, 0, []string{"make_run", "filesystem_write_file"}},
+		{"By tool", Filter{Tool: "make_run"}, 0, []string{"make_run"}},
+		{"Errors only", Filter{ErrorsOnly: true}, 0, []string{"make_run"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := Query(strings.NewReader(log), tc.filter, tc.limit)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var tools []string
+			for _, e := range entries {
+				tools = append(tools, e.Tool)
+			}
+			if strings.Join(tools, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Expected %v, got %v", tc.expected, tools)
+			}
+		})
+	}
+}
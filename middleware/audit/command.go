@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Filter selects entries of the audit log.
+type Filter struct {
+	Tool       string
+	SessionID  string
+	KeyLabel   string
+	Since      time.Time
+	ErrorsOnly bool
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e Entry) bool {
+	switch {
+	case f.Tool != "" && e.Tool != f.Tool:
+		return false
+	case f.SessionID != "" && e.SessionID != f.SessionID:
+		return false
+	case f.KeyLabel != "" && e.KeyLabel != f.KeyLabel:
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case f.ErrorsOnly && !e.IsError:
+		return false
+	}
+	return true
+}
+
+// Query reads the audit log from r and returns the last limit entries matching filter (all if limit <= 0).
+// Lines which cannot be parsed are skipped.
+func Query(r io.Reader, filter Filter, limit int) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if !filter.Match(e) {
+			continue
+		}
+		entries = append(entries, e)
+		if limit > 0 && len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// Format renders e as a single human-readable line.
+func Format(e Entry) string {
+	status := "ok"
+	if e.IsError {
+		status = "ERROR"
+	}
+	line := fmt.Sprintf("%s  %-8s  %-24s  %-22s  %6dms  %-5s  %s",
+		e.Time.Local().Format(time.DateTime), shorten(e.SessionID, 8), e.KeyLabel, e.Tool, e.DurationMS, status, e.Arguments)
+	for _, f := range e.Files {
+		before := shorten(f.Before, 12)
+		if f.BeforeUnknown {
+			before = "?"
+		}
+		line += fmt.Sprintf("\n    %s %s -> %s", f.Path, before, shorten(f.After, 12))
+	}
+	if e.Summary != "" {
+		line += "\n    " + strings.ReplaceAll(e.Summary, "\n", "\n    ")
+	}
+	return line
+}
+
+func shorten(s string, n int) string {
+	if s == "" {
+		return "-"
+	}
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// Command implements the `mcpilot-pair audit` subcommand and returns the exit code.
+func Command(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path := fs.String("file", DefaultPath(), "Path of the audit log")
+	var filter Filter
+	fs.StringVar(&filter.Tool, "tool", "", "Only show calls of this tool")
+	fs.StringVar(&filter.SessionID, "session", "", "Only show calls of this session")
+	fs.StringVar(&filter.KeyLabel, "key", "", "Only show calls authorized with this key label")
+	fs.BoolVar(&filter.ErrorsOnly, "errors", false, "Only show failed calls")
+	since := fs.Duration("since", 0, "Only show calls within this duration (e.g. 1h)")
+	limit := fs.Int("n", 20, "Number of entries to show (0 for all)")
+	follow := fs.Bool("f", false, "Keep running and print new entries as they are written")
+	asJSON := fs.Bool("json", false, "Print entries as JSON lines")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: mcpilot-pair audit [flags]\n\nQuery and tail the audit log of tool calls.\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *since > 0 {
+		filter.Since = time.Now().Add(-*since)
+	}
+
+	show := func(e Entry) {
+		if *asJSON {
+			data, _ := json.Marshal(e)
+			fmt.Fprintln(stdout, string(data))
+		} else {
+			fmt.Fprintln(stdout, Format(e))
+		}
+	}
+
+	f, err := os.Open(*path)
+	if err != nil {
+		fmt.Fprintf(stderr, "could not open audit log: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	entries, err := Query(f, filter, *limit)
+	if err != nil {
+		fmt.Fprintf(stderr, "could not read audit log: %v\n", err)
+		return 1
+	}
+	for _, e := range entries {
+		show(e)
+	}
+	if !*follow {
+		return 0
+	}
+
+	// Query consumed the file, new lines are appended after the current offset.
+	reader := bufio.NewReader(f)
+	var partial []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		partial = append(partial, line...)
+		if errors.Is(err, io.EOF) {
+			time.Sleep(500 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "could not read audit log: %v\n", err)
+			return 1
+		}
+		var e Entry
+		if json.Unmarshal(partial, &e) == nil && filter.Match(e) {
+			show(e)
+		}
+		partial = partial[:0]
+	}
+}
@@ -1,46 +1,87 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	sdkauth "github.com/modelcontextprotocol/go-sdk/auth"
 )
 
+// keyLabelExtra is the [sdkauth.TokenInfo] extra field holding the label of the credential.
+const keyLabelExtra = "key_label"
+
+// KeyLabel returns a printable label of the credential a request was authorized with,
+// e.g. `apikey:sha256:…` or `oauth:<client name>/<client id prefix>`. It never contains the secret itself.
+func KeyLabel(info *sdkauth.TokenInfo) string {
+	if info == nil {
+		return "anonymous"
+	}
+	if label, ok := info.Extra[keyLabelExtra].(string); ok {
+		return label
+	}
+	return "unknown"
+}
+
 // APIKeyMiddleware verifies the API key in the `Authorization` header.
-func APIKeyMiddleware(next http.Handler) http.Handler {
+// The key is only printed in clear text if showKey is set, see [LoadAPIKey].
+func APIKeyMiddleware(showKey bool) func(http.Handler) http.Handler {
+	return requireAPIKey(LoadAPIKey(showKey))
+}
+
+// LoadAPIKey reads or generates the API key and announces it on startup.
+// The key is only printed in clear text if showKey is set. Otherwise a redacted
+// fingerprint is logged, which is enough to tell keys apart without leaking them.
+func LoadAPIKey(showKey bool) string {
 	apiKey, err := getOrGenerateAPIKey()
-	fmt.Printf("\n=== MCPilot-Pair API KEY GENERATED ===\n%s\n=== COPY THIS KEY ===\n\n", apiKey)
 	if err != nil {
 		panic("API key not configured")
 	}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header missing", http.StatusUnauthorized)
-			return
-		}
+	if showKey {
+		fmt.Printf("\n=== MCPilot-Pair API KEY ===\n%s\n=== COPY THIS KEY ===\n\n", apiKey)
+	} else {
+		log.Printf("API key loaded (fingerprint %s), start with --show-key to print it", Fingerprint(apiKey))
+	}
+	return apiKey
+}
 
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			log.Printf("invalid bearer token: %s", authHeader)
-			http.Error(w, "Invalid authorization format: expected 'Bearer <api_key>'", http.StatusUnauthorized)
-			return
+// requireAPIKey returns a middleware that only lets requests pass which present apiKey as bearer token.
+// Accepted requests carry a [sdkauth.TokenInfo] labelled with the key's fingerprint, see [KeyLabel].
+func requireAPIKey(apiKey string) func(http.Handler) http.Handler {
+	label := "apikey:" + Fingerprint(apiKey)
+	return sdkauth.RequireBearerToken(func(_ context.Context, token string, r *http.Request) (*sdkauth.TokenInfo, error) {
+		if !verifyAPIKey(token, apiKey) {
+			log.Printf("failed to verify API key %s from %s", Fingerprint(token), r.RemoteAddr)
+			return nil, fmt.Errorf("invalid API key: %w", sdkauth.ErrInvalidToken)
 		}
+		// The key never expires, but the SDK requires an expiration for every token.
+		return &sdkauth.TokenInfo{
+			Expiration: time.Now().Add(time.Hour),
+			Extra:      map[string]any{keyLabelExtra: label},
+		}, nil
+	}, nil)
+}
 
-		if parts[1] != apiKey {
-			log.Printf("failed to verify %s != %s", parts[1], apiKey)
-			http.Error(w, "Invalid API key", http.StatusUnauthorized)
-			return
-		}
+// verifyAPIKey compares the presented key with the expected one in constant time.
+func verifyAPIKey(presented, apiKey string) bool {
+	return subtle.ConstantTimeCompare([]byte(presented), []byte(apiKey)) == 1
+}
 
-		next.ServeHTTP(w, r)
-	})
+// Fingerprint returns a short, non-reversible identifier of a secret that is safe to log.
+func Fingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:6])
 }
 
 // getOrGenerateAPIKey reads the API key from the XDG-compliant config directory or generates a new one.
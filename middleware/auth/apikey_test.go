@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects the standard logger into a buffer for the duration of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// captureStdout runs fn and returns everything it printed to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to read stdout: %v", err)
+	}
+	return string(out)
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	const apiKey = "c2VjcmV0LWtleS1mb3ItdGVzdHM="
+	logs := captureLog(t)
+
+	handler := requireAPIKey(apiKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+	}{
+		{"Missing header", "", http.StatusUnauthorized},
+		{"Wrong scheme", "Basic " + apiKey, http.StatusUnauthorized},
+		{"Wrong key", "Bearer guessed-key", http.StatusUnauthorized},
+		{"Key prefix", "Bearer " + apiKey[:10], http.StatusUnauthorized},
+		{"Valid key", "Bearer " + apiKey, http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/mcp/", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+			if strings.Contains(rec.Body.String(), apiKey) {
+				t.Errorf("Response body leaks the API key: %q", rec.Body.String())
+			}
+		})
+	}
+
+	for _, secret := range []string{apiKey, "guessed-key", apiKey[:10]} {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("Log output contains secret %q:\n%s", secret, logs.String())
+		}
+	}
+	if !strings.Contains(logs.String(), Fingerprint("guessed-key")) {
+		t.Errorf("Expected log output to contain the fingerprint of the rejected key:\n%s", logs.String())
+	}
+}
+
+func TestAPIKeyMiddlewareRedactsKey(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	apiKey, err := getOrGenerateAPIKey()
+	if err != nil {
+		t.Fatalf("Failed to generate API key: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		showKey   bool
+		wantPrint bool
+	}{
+		{"Redacted by default", false, false},
+		{"Printed on request", true, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := captureLog(t)
+			out := captureStdout(t, func() {
+				APIKeyMiddleware(tc.showKey)
+			})
+
+			if got := strings.Contains(out, apiKey); got != tc.wantPrint {
+				t.Errorf("Expected key printed to stdout = %v, got %v", tc.wantPrint, got)
+			}
+			if strings.Contains(logs.String(), apiKey) {
+				t.Errorf("Log output contains the API key:\n%s", logs.String())
+			}
+			if !tc.showKey && !strings.Contains(logs.String(), Fingerprint(apiKey)) {
+				t.Errorf("Expected log output to contain the key fingerprint:\n%s", logs.String())
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	if Fingerprint("a") == Fingerprint("b") {
+		t.Error("Expected different secrets to have different fingerprints")
+	}
+	if Fingerprint("a") != Fingerprint("a") {
+		t.Error("Expected fingerprint to be stable")
+	}
+	if fp := Fingerprint("secret"); strings.Contains(fp, "secret") {
+		t.Errorf("Fingerprint leaks the secret: %s", fp)
+	}
+}
@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var (
+	// metrics exposes the state of the brute-force protection and rate limits via expvar (`/debug/vars`).
+	metrics = expvar.NewMap("auth")
+	// trackedClients is the number of client IPs with recent failed attempts.
+	trackedClients expvar.Int
+)
+
+func init() {
+	metrics.Set("tracked_clients", &trackedClients)
+}
+
+// GuardConfig configures the brute-force protection of [Guard].
+type GuardConfig struct {
+	// MaxFailures is the number of failed attempts per client IP before it is locked out.
+	MaxFailures int
+	// GlobalMaxFailures is the number of failed attempts across all clients within
+	// GlobalWindow before every client is locked out.
+	GlobalMaxFailures int
+	GlobalWindow      time.Duration
+	// BaseLockout is the duration of the first lockout. It doubles with every further
+	// failure until MaxLockout is reached.
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// TrustedProxies are the proxies whose `X-Forwarded-For` header is used to determine the client IP.
+	TrustedProxies []netip.Prefix
+}
+
+// DefaultGuardConfig returns the limits used by the server unless configured otherwise.
+func DefaultGuardConfig() GuardConfig {
+	return GuardConfig{
+		MaxFailures:       5,
+		GlobalMaxFailures: 50,
+		GlobalWindow:      time.Minute,
+		BaseLockout:       time.Minute,
+		MaxLockout:        time.Hour,
+	}
+}
+
+// failureRecord tracks failed attempts of a single client, or of all clients combined.
+type failureRecord struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Guard protects authorization middlewares against brute-force attacks. It counts failed
+// attempts (401 responses) per client IP and globally, and locks clients out with an
+// exponentially growing lockout once the limits are exceeded.
+type Guard struct {
+	cfg GuardConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*failureRecord
+	global  failureRecord
+	// recent are the times of the failed attempts of all clients within the global window, oldest first.
+	recent []time.Time
+}
+
+// NewGuard creates a guard with the given limits.
+func NewGuard(cfg GuardConfig) *Guard {
+	return &Guard{
+		cfg:     cfg,
+		now:     time.Now,
+		clients: make(map[string]*failureRecord),
+	}
+}
+
+// Middleware rejects requests of locked out clients with 429 and records the outcome
+// of all other requests. It has to be installed in front of the authorization middleware.
+func (g *Guard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := g.ClientIP(r)
+		if wait := g.lockedFor(ip); wait > 0 {
+			metrics.Add("rejected_locked", 1)
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+			http.Error(w, "Too many failed authorization attempts", http.StatusTooManyRequests)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		switch {
+		case sw.status == http.StatusUnauthorized:
+			g.fail(ip)
+		case sw.status < http.StatusBadRequest && r.Header.Get("Authorization") != "":
+			// Only requests which presented valid credentials prove the client legitimate.
+			g.succeed(ip)
+		}
+	})
+}
+
+// ClientIP returns the IP of the client that sent r. `X-Forwarded-For` is only
+// taken into account if the request was received from a trusted proxy.
+func (g *Guard) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !g.trusted(host) {
+		return host
+	}
+
+	// Walk the chain from the nearest hop and return the first address not belonging to a trusted proxy.
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		if !g.trusted(hop) {
+			return hop
+		}
+	}
+	return host
+}
+
+// trusted reports whether ip belongs to a trusted proxy.
+func (g *Guard) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range g.cfg.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockedFor returns how long ip is still locked out, considering the global lockout as well.
+func (g *Guard) lockedFor(ip string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	until := g.global.lockedUntil
+	if rec, ok := g.clients[ip]; ok && rec.lockedUntil.After(until) {
+		until = rec.lockedUntil
+	}
+	return until.Sub(now)
+}
+
+// fail records a failed attempt of ip and locks it out if the limits are exceeded.
+func (g *Guard) fail(ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	metrics.Add("failures", 1)
+	g.expire(now)
+
+	rec, ok := g.clients[ip]
+	if !ok {
+		rec = &failureRecord{}
+		g.clients[ip] = rec
+	}
+	rec.failures++
+	rec.lastFailure = now
+	if rec.failures >= g.cfg.MaxFailures {
+		rec.lockedUntil = now.Add(g.lockout(rec.failures - g.cfg.MaxFailures))
+		metrics.Add("lockouts", 1)
+		log.Printf("client %s locked out until %s after %d failed attempts", ip, rec.lockedUntil.Format(time.RFC3339), rec.failures)
+	}
+
+	// Only the failures within the sliding window count towards the global limit
+	expired := 0
+	for expired < len(g.recent) && now.Sub(g.recent[expired]) >= g.cfg.GlobalWindow {
+		expired++
+	}
+	g.recent = append(g.recent[expired:], now)
+	g.global.failures = len(g.recent)
+	g.global.lastFailure = now
+	if g.global.failures >= g.cfg.GlobalMaxFailures {
+		g.global.lockedUntil = now.Add(g.lockout(g.global.failures - g.cfg.GlobalMaxFailures))
+		metrics.Add("global_lockouts", 1)
+		log.Printf("all clients locked out until %s after %d failed attempts", g.global.lockedUntil.Format(time.RFC3339), g.global.failures)
+	}
+	trackedClients.Set(int64(len(g.clients)))
+}
+
+// succeed resets the failure count of ip after a successful authorization.
+func (g *Guard) succeed(ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.clients[ip]; ok {
+		delete(g.clients, ip)
+		trackedClients.Set(int64(len(g.clients)))
+	}
+}
+
+// lockout returns the lockout duration after the given number of failures beyond the limit.
+func (g *Guard) lockout(excess int) time.Duration {
+	d := g.cfg.BaseLockout
+	for i := 0; i < excess && d < g.cfg.MaxLockout; i++ {
+		d *= 2
+	}
+	return min(d, g.cfg.MaxLockout)
+}
+
+// expire forgets clients whose last failure is longer ago than the maximum lockout.
+// The caller must hold g.mu.
+func (g *Guard) expire(now time.Time) {
+	for ip, rec := range g.clients {
+		if now.After(rec.lockedUntil) && now.Sub(rec.lastFailure) > g.cfg.MaxLockout {
+			delete(g.clients, ip)
+		}
+	}
+}
+
+// statusWriter records the status code written by the wrapped handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush supports streaming responses of the MCP handler.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives [http.ResponseController] access to the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// tokenBucket is the state of a single key in [RateLimiter].
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter limits the number of tool calls per credential with a token bucket.
+type RateLimiter struct {
+	perMinute float64
+	burst     float64
+	now       func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewRateLimiter allows perMinute tool calls per credential on average and up to burst calls at once.
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	return &RateLimiter{
+		perMinute: float64(perMinute),
+		burst:     float64(max(burst, 1)),
+		now:       time.Now,
+		buckets:   make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the bucket of key. If none is left, it returns how long to wait for the next one.
+func (l *RateLimiter) allow(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Minutes()*l.perMinute)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.perMinute * float64(time.Minute)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// Middleware is an MCP middleware rejecting tool calls of credentials which exceeded their rate.
+func (l *RateLimiter) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if method != "tools/call" {
+			return next(ctx, method, req)
+		}
+
+		label := KeyLabel(nil)
+		if extra := req.GetExtra(); extra != nil {
+			label = KeyLabel(extra.TokenInfo)
+		}
+		if wait, ok := l.allow(label); !ok {
+			metrics.Add("rate_limited", 1)
+			return nil, fmt.Errorf("rate limit of %.0f tool calls per minute exceeded, retry in %s", l.perMinute, wait.Round(time.Second))
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// ParsePrefixes parses a comma-separated list of IP addresses and CIDR prefixes.
+func ParsePrefixes(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if p, err := netip.ParsePrefix(field); err == nil {
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address or prefix %q", field)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
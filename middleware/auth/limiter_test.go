@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for the guard and rate limiter.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestGuard(t *testing.T, cfg GuardConfig) (*Guard, *fakeClock, http.Handler) {
+	t.Helper()
+	captureLog(t)
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	g := NewGuard(cfg)
+	g.now = clock.now
+	handler := g.Middleware(requireAPIKey("secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	return g, clock, handler
+}
+
+func doRequest(handler http.Handler, remoteAddr, key string) int {
+	req := httptest.NewRequest(http.MethodPost, "/mcp/", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("Authorization", "Bearer "+key)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestGuardLockout(t *testing.T) {
+	cfg := DefaultGuardConfig()
+	cfg.MaxFailures = 3
+	_, clock, handler := newTestGuard(t, cfg)
+	const attacker, developer = "192.0.2.1:1234", "192.0.2.2:1234"
+
+	for i := 0; i < cfg.MaxFailures; i++ {
+		if code := doRequest(handler, attacker, "guess"); code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected status %d, got %d", i, http.StatusUnauthorized, code)
+		}
+	}
+	if code := doRequest(handler, attacker, "secret"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected locked out client to be rejected even with valid key, got %d", code)
+	}
+	if code := doRequest(handler, developer, "secret"); code != http.StatusOK {
+		t.Errorf("Expected other clients to be unaffected, got %d", code)
+	}
+
+	// The lockout doubles with every further failure
+	clock.advance(cfg.BaseLockout + time.Second)
+	doRequest(handler, attacker, "guess")
+	clock.advance(cfg.BaseLockout + time.Second)
+	if code := doRequest(handler, attacker, "secret"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected second lockout to last longer, got %d", code)
+	}
+	clock.advance(cfg.BaseLockout)
+	if code := doRequest(handler, attacker, "secret"); code != http.StatusOK {
+		t.Errorf("Expected lockout to expire, got %d", code)
+	}
+	if code := doRequest(handler, attacker, "guess"); code != http.StatusUnauthorized {
+		t.Errorf("Expected failures to be reset after success, got %d", code)
+	}
+}
+
+func TestGuardGlobalLockout(t *testing.T) {
+	cfg := DefaultGuardConfig()
+	cfg.GlobalMaxFailures = 5
+	g, clock, handler := newTestGuard(t, cfg)
+
+	for i := 0; i < cfg.GlobalMaxFailures; i++ {
+		doRequest(handler, netip.AddrFrom4([4]byte{198, 51, 100, byte(i)}).String()+":1234", "guess")
+	}
+	if code := doRequest(handler, "192.0.2.2:1234", "secret"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected global lockout, got %d", code)
+	}
+	clock.advance(g.lockout(0) + time.Second)
+	if code := doRequest(handler, "192.0.2.2:1234", "secret"); code != http.StatusOK {
+		t.Errorf("Expected global lockout to expire, got %d", code)
+	}
+}
+
+// TestGuardGlobalWindow tests that failures across all clients are counted within a sliding window.
+func TestGuardGlobalWindow(t *testing.T) {
+	cfg := DefaultGuardConfig()
+	cfg.GlobalMaxFailures = 5
+	_, clock, handler := newTestGuard(t, cfg)
+	attacker := func(i int) string {
+		return netip.AddrFrom4([4]byte{198, 51, 100, byte(i)}).String() + ":1234"
+	}
+
+	// Failures spaced just under the window never accumulate to the limit
+	for i := 0; i < 2*cfg.GlobalMaxFailures; i++ {
+		if code := doRequest(handler, attacker(i), "guess"); code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected no global lockout for one failure per window, got %d", i, code)
+		}
+		clock.advance(cfg.GlobalWindow - time.Second)
+	}
+	clock.advance(cfg.GlobalWindow)
+
+	// The limit is reached when the failures fall into one window
+	spacing := cfg.GlobalWindow/time.Duration(cfg.GlobalMaxFailures-1) - time.Second
+	for i := 0; i < cfg.GlobalMaxFailures-1; i++ {
+		doRequest(handler, attacker(i), "guess")
+		clock.advance(spacing)
+	}
+	if code := doRequest(handler, "192.0.2.2:1234", "secret"); code != http.StatusOK {
+		t.Fatalf("Expected no global lockout below the limit, got %d", code)
+	}
+	doRequest(handler, attacker(cfg.GlobalMaxFailures), "guess")
+	if code := doRequest(handler, "192.0.2.2:1234", "secret"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected global lockout after %d failures within the window, got %d", cfg.GlobalMaxFailures, code)
+	}
+}
+
+func TestGuardClientIP(t *testing.T) {
+	proxies, err := ParsePrefixes("127.0.0.1, 10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("Failed to parse prefixes: %v", err)
+	}
+	g := NewGuard(GuardConfig{TrustedProxies: proxies})
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		xForwardedFor string
+		want          string
+	}{
+		{"Direct client", "192.0.2.1:1234", "", "192.0.2.1"},
+		{"Spoofed header from untrusted client", "192.0.2.1:1234", "203.0.113.7", "192.0.2.1"},
+		{"Trusted proxy", "127.0.0.1:1234", "203.0.113.7", "203.0.113.7"},
+		{"Chain of trusted proxies", "127.0.0.1:1234", "203.0.113.7, 10.1.2.3", "203.0.113.7"},
+		{"Spoofed entry before real client", "127.0.0.1:1234", "1.1.1.1, 203.0.113.7", "203.0.113.7"},
+		{"Trusted proxy without header", "127.0.0.1:1234", "", "127.0.0.1"},
+		{"Garbage header", "127.0.0.1:1234", "not-an-ip", "127.0.0.1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.xForwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tc.xForwardedFor)
+			}
+			if got := g.ClientIP(req); got != tc.want {
+				t.Errorf("Expected client IP %s, got %s", tc.want, got)
+			}
+		})
+	}
+
+	if _, err := ParsePrefixes("10.0.0.0/33"); err == nil {
+		t.Error("Expected invalid prefix to be rejected")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	l := NewRateLimiter(60, 2)
+	l.now = clock.now
+
+	for i := 0; i < 2; i++ {
+		if _, ok := l.allow("a"); !ok {
+			t.Fatalf("Call %d: expected burst to be allowed", i)
+		}
+	}
+	wait, ok := l.allow("a")
+	if ok || wait <= 0 || wait > time.Second {
+		t.Errorf("Expected call to be limited for up to a second, got ok=%v wait=%s", ok, wait)
+	}
+	if _, ok := l.allow("b"); !ok {
+		t.Error("Expected other keys to have their own bucket")
+	}
+	clock.advance(time.Second)
+	if _, ok := l.allow("a"); !ok {
+		t.Error("Expected bucket to refill")
+	}
+}
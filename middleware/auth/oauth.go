@@ -0,0 +1,685 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	sdkauth "github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/oauthex"
+)
+
+const (
+	// oauthScope is the only scope handed out; it grants access to all MCP tools.
+	oauthScope = "mcp"
+
+	authCodeTTL     = time.Minute
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = 30 * 24 * time.Hour
+
+	// maxOAuthClients limits dynamic client registration, which is unauthenticated by design.
+	maxOAuthClients = 256
+	// unauthorizedClientTTL is how long a client is kept without exchanging an authorization code.
+	unauthorizedClientTTL = 10 * time.Minute
+)
+
+// oauthClient is a client registered through dynamic client registration (RFC 7591).
+// Only public clients are supported, they authenticate via PKCE.
+type oauthClient struct {
+	ID           string   `json:"client_id"`
+	Name         string   `json:"client_name,omitempty"`
+	RedirectURIs []string `json:"redirect_uris"`
+	IssuedAt     int64    `json:"client_id_issued_at"`
+
+	// authorized is set once the client exchanged an authorization code.
+	authorized bool
+	// lastUsed is the time of the registration or the last authorization request.
+	lastUsed time.Time
+}
+
+// authCode is a pending authorization code waiting to be exchanged at the token endpoint.
+type authCode struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	expiresAt     time.Time
+}
+
+// oauthGrant is an issued access or refresh token.
+type oauthGrant struct {
+	clientID  string
+	expiresAt time.Time
+}
+
+// OAuthServer is a minimal OAuth 2.1 authorization server following the MCP authorization spec.
+// It serves the protected resource and authorization server metadata, supports dynamic client
+// registration and the authorization code flow with PKCE, and issues short-lived access tokens
+// plus rotating refresh tokens. Requests are approved on a consent page by entering the API key,
+// so only the developer running the server can grant access.
+//
+// All state is kept in memory, clients have to authorize again after a restart.
+type OAuthServer struct {
+	apiKey    string
+	publicURL string
+
+	mu            sync.Mutex
+	clients       map[string]*oauthClient
+	codes         map[string]*authCode
+	accessTokens  map[string]*oauthGrant
+	refreshTokens map[string]*oauthGrant
+}
+
+// NewOAuthServer creates an authorization server whose consent page is unlocked by apiKey.
+// publicURL is the externally visible base URL of the server (e.g. https://rand-sub.example.com).
+// If empty, it is derived from each request.
+func NewOAuthServer(apiKey, publicURL string) *OAuthServer {
+	return &OAuthServer{
+		apiKey:        apiKey,
+		publicURL:     strings.TrimSuffix(publicURL, "/"),
+		clients:       make(map[string]*oauthClient),
+		codes:         make(map[string]*authCode),
+		accessTokens:  make(map[string]*oauthGrant),
+		refreshTokens: make(map[string]*oauthGrant),
+	}
+}
+
+// Mount registers the metadata and OAuth endpoints on r.
+// The consent page is protected by guard against guessing the API key, if set.
+func (s *OAuthServer) Mount(r chi.Router, guard *Guard) {
+	r.Group(func(r chi.Router) {
+		r.Use(allowCORS)
+		for pattern, handler := range map[string]http.HandlerFunc{
+			"/.well-known/oauth-protected-resource":     s.handleResourceMetadata,
+			"/.well-known/oauth-protected-resource/*":   s.handleResourceMetadata,
+			"/.well-known/oauth-authorization-server":   s.handleServerMetadata,
+			"/.well-known/oauth-authorization-server/*": s.handleServerMetadata,
+		} {
+			r.Get(pattern, handler)
+			r.Options(pattern, handlePreflight)
+		}
+		r.Post("/oauth/register", s.handleRegister)
+		r.Options("/oauth/register", handlePreflight)
+		r.Post("/oauth/token", s.handleToken)
+		r.Options("/oauth/token", handlePreflight)
+	})
+	r.Get("/oauth/authorize", s.handleAuthorize)
+	if guard != nil {
+		r.With(guard.Middleware).Post("/oauth/authorize", s.handleConsent)
+	} else {
+		r.Post("/oauth/authorize", s.handleConsent)
+	}
+}
+
+// Middleware verifies access tokens issued by s. Rejected requests carry a
+// `WWW-Authenticate` header pointing clients to the protected resource metadata.
+func (s *OAuthServer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sdkauth.RequireBearerToken(s.verifyAccessToken, &sdkauth.RequireBearerTokenOptions{
+			ResourceMetadataURL: s.baseURL(r) + "/.well-known/oauth-protected-resource",
+			Scopes:              []string{oauthScope},
+		})(next).ServeHTTP(w, r)
+	})
+}
+
+// verifyAccessToken is a [sdkauth.TokenVerifier] for access tokens issued by s.
+func (s *OAuthServer) verifyAccessToken(_ context.Context, token string, r *http.Request) (*sdkauth.TokenInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := hashToken(token)
+	grant, ok := s.accessTokens[key]
+	if !ok || time.Now().After(grant.expiresAt) {
+		delete(s.accessTokens, key)
+		log.Printf("failed to verify access token %s from %s", Fingerprint(token), r.RemoteAddr)
+		return nil, sdkauth.ErrInvalidToken
+	}
+
+	info := &sdkauth.TokenInfo{
+		Scopes:     []string{oauthScope},
+		Expiration: grant.expiresAt,
+		Extra:      map[string]any{"client_id": grant.clientID},
+	}
+	// Client names are chosen by the client, the ID prefix keeps labels unique.
+	label := "oauth:" + grant.clientID[:8]
+	if client, ok := s.clients[grant.clientID]; ok && client.Name != "" {
+		info.Extra["client_name"] = client.Name
+		label = "oauth:" + client.Name + "/" + grant.clientID[:8]
+	}
+	info.Extra[keyLabelExtra] = label
+	return info, nil
+}
+
+// baseURL returns the externally visible URL of the server without trailing slash.
+func (s *OAuthServer) baseURL(r *http.Request) string {
+	if s.publicURL != "" {
+		return s.publicURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// handleResourceMetadata serves the protected resource metadata (RFC 9728).
+func (s *OAuthServer) handleResourceMetadata(w http.ResponseWriter, r *http.Request) {
+	base := s.baseURL(r)
+	writeJSON(w, http.StatusOK, &oauthex.ProtectedResourceMetadata{
+		Resource:               base + "/mcp",
+		AuthorizationServers:   []string{base},
+		ScopesSupported:        []string{oauthScope},
+		BearerMethodsSupported: []string{"header"},
+		ResourceName:           "MCPilot Pair",
+	})
+}
+
+// authServerMetadata is the authorization server metadata defined in RFC 8414.
+type authServerMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	RegistrationEndpoint              string   `json:"registration_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+// handleServerMetadata serves the authorization server metadata (RFC 8414).
+func (s *OAuthServer) handleServerMetadata(w http.ResponseWriter, r *http.Request) {
+	base := s.baseURL(r)
+	writeJSON(w, http.StatusOK, &authServerMetadata{
+		Issuer:                            base,
+		AuthorizationEndpoint:             base + "/oauth/authorize",
+		TokenEndpoint:                     base + "/oauth/token",
+		RegistrationEndpoint:              base + "/oauth/register",
+		ScopesSupported:                   []string{oauthScope},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token"},
+		TokenEndpointAuthMethodsSupported: []string{"none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+	})
+}
+
+// registrationRequest is the client metadata sent to the registration endpoint (RFC 7591).
+type registrationRequest struct {
+	RedirectURIs            []string `json:"redirect_uris"`
+	ClientName              string   `json:"client_name"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+}
+
+// registrationResponse is the answer of the registration endpoint.
+type registrationResponse struct {
+	oauthClient
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+}
+
+// handleRegister implements dynamic client registration for public clients.
+func (s *OAuthServer) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var req registrationRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "could not decode client metadata")
+		return
+	}
+	if req.TokenEndpointAuthMethod != "" && req.TokenEndpointAuthMethod != "none" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "only public clients (token_endpoint_auth_method=none) are supported")
+		return
+	}
+	if len(req.RedirectURIs) == 0 {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_redirect_uri", "at least one redirect_uri is required")
+		return
+	}
+	for _, uri := range req.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_redirect_uri", err.Error())
+			return
+		}
+	}
+
+	now := time.Now()
+	client := &oauthClient{
+		ID:           randomToken(),
+		Name:         req.ClientName,
+		RedirectURIs: req.RedirectURIs,
+		IssuedAt:     now.Unix(),
+		lastUsed:     now,
+	}
+	// Other requests update the client once it is registered
+	registered := *client
+
+	s.mu.Lock()
+	s.expireClients()
+	if len(s.clients) >= maxOAuthClients && !s.evictClient() {
+		s.mu.Unlock()
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "too many registered clients")
+		return
+	}
+	s.clients[client.ID] = client
+	s.mu.Unlock()
+
+	log.Printf("registered OAuth client %q (%s)", client.Name, client.ID)
+	writeJSON(w, http.StatusCreated, &registrationResponse{
+		oauthClient:             registered,
+		TokenEndpointAuthMethod: "none",
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		ResponseTypes:           []string{"code"},
+	})
+}
+
+// expireClients removes the clients which did not exchange an authorization code within
+// unauthorizedClientTTL of their last use. The caller must hold s.mu.
+func (s *OAuthServer) expireClients() {
+	now := time.Now()
+	for id, c := range s.clients {
+		if !c.authorized && now.Sub(c.lastUsed) > unauthorizedClientTTL {
+			s.removeClient(id)
+		}
+	}
+}
+
+// evictClient removes the least recently used client which never exchanged an
+// authorization code, so registrations cannot lock out new clients. It reports false
+// if all clients are authorized. The caller must hold s.mu.
+func (s *OAuthServer) evictClient() bool {
+	var oldest *oauthClient
+	for _, c := range s.clients {
+		if !c.authorized && (oldest == nil || c.lastUsed.Before(oldest.lastUsed)) {
+			oldest = c
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	log.Printf("evicted unauthorized OAuth client %q (%s)", oldest.Name, oldest.ID)
+	s.removeClient(oldest.ID)
+	return true
+}
+
+// removeClient removes a client and its pending authorization codes. The caller must hold s.mu.
+func (s *OAuthServer) removeClient(id string) {
+	delete(s.clients, id)
+	for k, c := range s.codes {
+		if c.clientID == id {
+			delete(s.codes, k)
+		}
+	}
+}
+
+// validateRedirectURI accepts absolute https URLs and http URLs pointing to the loopback interface.
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("redirect_uri %q is not an absolute URL", uri)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect_uri %q must not contain a fragment", uri)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || host == "127.0.0.1" || host == "::1" {
+			return nil
+		}
+	}
+	return fmt.Errorf("redirect_uri %q must use https or point to localhost", uri)
+}
+
+// authorizeRequest holds the validated parameters of an authorization request.
+type authorizeRequest struct {
+	Client        *oauthClient
+	RedirectURI   string
+	State         string
+	CodeChallenge string
+}
+
+// parseAuthorizeRequest validates the authorization request parameters in form.
+// Errors which cannot be reported to the client's redirect URI yield redirect == "".
+func (s *OAuthServer) parseAuthorizeRequest(form url.Values) (req authorizeRequest, redirect string, err error) {
+	s.mu.Lock()
+	client, ok := s.clients[form.Get("client_id")]
+	if ok {
+		client.lastUsed = time.Now()
+	}
+	s.mu.Unlock()
+	if !ok {
+		return req, "", fmt.Errorf("unknown client_id")
+	}
+
+	redirectURI := form.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	registered := false
+	for _, uri := range client.RedirectURIs {
+		registered = registered || uri == redirectURI
+	}
+	if !registered {
+		return req, "", fmt.Errorf("redirect_uri is not registered for this client")
+	}
+
+	req = authorizeRequest{
+		Client:        client,
+		RedirectURI:   redirectURI,
+		State:         form.Get("state"),
+		CodeChallenge: form.Get("code_challenge"),
+	}
+	if form.Get("response_type") != "code" {
+		return req, redirectURI, fmt.Errorf("unsupported_response_type")
+	}
+	if req.CodeChallenge == "" || form.Get("code_challenge_method") != "S256" {
+		return req, redirectURI, fmt.Errorf("invalid_request")
+	}
+	if scope := form.Get("scope"); scope != "" && scope != oauthScope {
+		return req, redirectURI, fmt.Errorf("invalid_scope")
+	}
+	return req, redirectURI, nil
+}
+
+// handleAuthorize renders the consent page for a valid authorization request.
+func (s *OAuthServer) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	req, redirect, err := s.parseAuthorizeRequest(r.URL.Query())
+	if err != nil {
+		s.rejectAuthorize(w, r, redirect, req.State, err)
+		return
+	}
+	s.renderConsent(w, http.StatusOK, req, "")
+}
+
+// handleConsent processes the developer's decision on the consent page.
+func (s *OAuthServer) handleConsent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	form := r.PostForm
+	req, redirect, err := s.parseAuthorizeRequest(form)
+	if err != nil {
+		s.rejectAuthorize(w, r, redirect, req.State, err)
+		return
+	}
+
+	if form.Get("action") != "approve" {
+		log.Printf("authorization for OAuth client %q denied", req.Client.Name)
+		s.redirectWithParams(w, r, req.RedirectURI, url.Values{"error": {"access_denied"}, "state": {req.State}})
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(form.Get("api_key")), []byte(s.apiKey)) != 1 {
+		log.Printf("failed to verify API key %s on consent page from %s", Fingerprint(form.Get("api_key")), r.RemoteAddr)
+		s.renderConsent(w, http.StatusUnauthorized, req, "Invalid API key.")
+		return
+	}
+
+	code := randomToken()
+	s.mu.Lock()
+	s.codes[hashToken(code)] = &authCode{
+		clientID:      req.Client.ID,
+		redirectURI:   req.RedirectURI,
+		codeChallenge: req.CodeChallenge,
+		expiresAt:     time.Now().Add(authCodeTTL),
+	}
+	s.mu.Unlock()
+
+	log.Printf("authorization for OAuth client %q approved", req.Client.Name)
+	s.redirectWithParams(w, r, req.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {req.State},
+		"iss":   {s.baseURL(r)},
+	})
+}
+
+// rejectAuthorize reports an invalid authorization request either to the redirect URI or,
+// if that cannot be trusted, directly to the user agent.
+func (s *OAuthServer) rejectAuthorize(w http.ResponseWriter, r *http.Request, redirect, state string, err error) {
+	if redirect == "" {
+		http.Error(w, "Invalid authorization request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.redirectWithParams(w, r, redirect, url.Values{"error": {err.Error()}, "state": {state}})
+}
+
+// redirectWithParams redirects to uri with params merged into its query.
+func (s *OAuthServer) redirectWithParams(w http.ResponseWriter, r *http.Request, uri string, params url.Values) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	q := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			q.Set(k, v[0])
+		}
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Authorize {{.ClientName}} – MCPilot Pair</title>
+<style>
+body { font-family: sans-serif; max-width: 32rem; margin: 4rem auto; padding: 0 1rem; }
+input[type=password] { width: 100%; padding: .5rem; margin: .5rem 0 1rem; box-sizing: border-box; }
+button { padding: .5rem 1rem; margin-right: .5rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Authorize access</h1>
+<p><strong>{{.ClientName}}</strong> wants to access MCPilot Pair. It will be able to read and write files and run commands in your working directory.</p>
+<p>After approval you will be redirected to <code>{{.RedirectHost}}</code>.</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+{{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{$v}}">
+{{end}}<label for="api_key">Enter the API key from <code>~/.config/mcpilot-pair/api-key.txt</code> to approve:</label>
+<input type="password" id="api_key" name="api_key" autocomplete="off" autofocus>
+<button type="submit" name="action" value="approve">Approve</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+// renderConsent renders the consent page for req.
+func (s *OAuthServer) renderConsent(w http.ResponseWriter, status int, req authorizeRequest, errMsg string) {
+	name := req.Client.Name
+	if name == "" {
+		name = req.Client.ID
+	}
+	redirectHost := req.RedirectURI
+	if u, err := url.Parse(req.RedirectURI); err == nil {
+		redirectHost = u.Host
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+	err := consentTemplate.Execute(w, map[string]any{
+		"ClientName":   name,
+		"RedirectHost": redirectHost,
+		"Error":        errMsg,
+		"Params": map[string]string{
+			"client_id":             req.Client.ID,
+			"redirect_uri":          req.RedirectURI,
+			"state":                 req.State,
+			"code_challenge":        req.CodeChallenge,
+			"code_challenge_method": "S256",
+			"response_type":         "code",
+		},
+	})
+	if err != nil {
+		log.Printf("failed to render consent page: %v", err)
+	}
+}
+
+// tokenResponse is the successful answer of the token endpoint.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// handleToken exchanges authorization codes and refresh tokens for new tokens.
+func (s *OAuthServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "invalid form")
+		return
+	}
+	form := r.PostForm
+	clientID := form.Get("client_id")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch form.Get("grant_type") {
+	case "authorization_code":
+		key := hashToken(form.Get("code"))
+		code, ok := s.codes[key]
+		delete(s.codes, key) // codes are single use, even if the exchange fails
+		if !ok || time.Now().After(code.expiresAt) || code.clientID != clientID {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+			return
+		}
+		if redirectURI := form.Get("redirect_uri"); redirectURI != "" && redirectURI != code.redirectURI {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+			return
+		}
+		if !verifyPKCE(form.Get("code_verifier"), code.codeChallenge) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "PKCE verification failed")
+			return
+		}
+		// The client may have been evicted while it was authorized
+		client, ok := s.clients[clientID]
+		if !ok {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "unknown client_id")
+			return
+		}
+		client.authorized = true
+
+	case "refresh_token":
+		key := hashToken(form.Get("refresh_token"))
+		grant, ok := s.refreshTokens[key]
+		delete(s.refreshTokens, key) // refresh tokens are rotated on every use
+		if !ok || time.Now().After(grant.expiresAt) || grant.clientID != clientID {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired refresh token")
+			return
+		}
+
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		return
+	}
+
+	s.expireGrants()
+	accessToken, refreshToken := randomToken(), randomToken()
+	now := time.Now()
+	s.accessTokens[hashToken(accessToken)] = &oauthGrant{clientID: clientID, expiresAt: now.Add(accessTokenTTL)}
+	s.refreshTokens[hashToken(refreshToken)] = &oauthGrant{clientID: clientID, expiresAt: now.Add(refreshTokenTTL)}
+
+	writeJSON(w, http.StatusOK, &tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        oauthScope,
+	})
+}
+
+// expireGrants removes expired codes and tokens. The caller must hold s.mu.
+func (s *OAuthServer) expireGrants() {
+	now := time.Now()
+	for k, c := range s.codes {
+		if now.After(c.expiresAt) {
+			delete(s.codes, k)
+		}
+	}
+	for _, grants := range []map[string]*oauthGrant{s.accessTokens, s.refreshTokens} {
+		for k, g := range grants {
+			if now.After(g.expiresAt) {
+				delete(grants, k)
+			}
+		}
+	}
+}
+
+// verifyPKCE checks the code verifier against an S256 code challenge (RFC 7636).
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// randomToken returns a random, URL-safe token with 256 bits of entropy.
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("could not generate random token: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hashToken returns the key under which a token is stored, so that tokens are never kept in clear text.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return string(sum[:])
+}
+
+// allowCORS lets browser based MCP clients discover and use the OAuth endpoints.
+func allowCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, MCP-Protocol-Version")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handlePreflight answers CORS preflight requests, the headers are set by [allowCORS].
+func handlePreflight(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON writes v as JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write JSON response: %v", err)
+	}
+}
+
+// writeOAuthError writes an OAuth error response (RFC 6749, section 5.2).
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
@@ -0,0 +1,339 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const testVerifier = "dBjftJeZ4CVP-mJ92K27uhbUJU1p1r_wW1gFWFOEjXk-test-verifier"
+
+// newOAuthTestServer starts an HTTP server with the OAuth endpoints and a protected /mcp/ route.
+func newOAuthTestServer(t *testing.T, apiKey string) *httptest.Server {
+	t.Helper()
+	captureLog(t)
+
+	oauth := NewOAuthServer(apiKey, "")
+	r := chi.NewRouter()
+	oauth.Mount(r, nil)
+	r.With(oauth.Middleware).Handle("/mcp/*", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// noRedirectClient returns a client which does not follow redirects so that the authorization response can be inspected.
+func noRedirectClient() *http.Client {
+	return &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+}
+
+func registerClient(t *testing.T, ts *httptest.Server, redirectURI string) string {
+	t.Helper()
+	body := `{"client_name":"Test Client","redirect_uris":["` + redirectURI + `"]}`
+	resp, err := http.Post(ts.URL+"/oauth/register", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to register client: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+	var reg registrationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&reg); err != nil {
+		t.Fatalf("Failed to decode registration response: %v", err)
+	}
+	return reg.ID
+}
+
+// authorize approves an authorization request on the consent page and returns the redirect location.
+func authorize(t *testing.T, ts *httptest.Server, clientID, redirectURI, apiKey string) *http.Response {
+	t.Helper()
+	sum := sha256.Sum256([]byte(testVerifier))
+	form := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {redirectURI},
+		"state":                 {"xyz"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	resp, err := http.Get(ts.URL + "/oauth/authorize?" + form.Encode())
+	if err != nil {
+		t.Fatalf("Failed to request consent page: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected consent page with status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	form.Set("action", "approve")
+	form.Set("api_key", apiKey)
+	resp, err = noRedirectClient().PostForm(ts.URL+"/oauth/authorize", form)
+	if err != nil {
+		t.Fatalf("Failed to submit consent: %v", err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func requestToken(t *testing.T, ts *httptest.Server, form url.Values) (int, tokenResponse) {
+	t.Helper()
+	resp, err := http.PostForm(ts.URL+"/oauth/token", form)
+	if err != nil {
+		t.Fatalf("Failed to request token: %v", err)
+	}
+	defer resp.Body.Close()
+	var tok tokenResponse
+	json.NewDecoder(resp.Body).Decode(&tok)
+	return resp.StatusCode, tok
+}
+
+func callMCP(t *testing.T, ts *httptest.Server, token string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/mcp/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to call MCP endpoint: %v", err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestOAuthMetadata(t *testing.T) {
+	ts := newOAuthTestServer(t, "api-key")
+
+	resp := callMCP(t, ts, "")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+	wantHeader := "Bearer resource_metadata=" + ts.URL + "/.well-known/oauth-protected-resource"
+	if got := resp.Header.Get("WWW-Authenticate"); got != wantHeader {
+		t.Errorf("Expected WWW-Authenticate %q, got %q", wantHeader, got)
+	}
+
+	resp, err := http.Get(ts.URL + "/.well-known/oauth-protected-resource/mcp")
+	if err != nil {
+		t.Fatalf("Failed to fetch resource metadata: %v", err)
+	}
+	var prm struct {
+		Resource             string   `json:"resource"`
+		AuthorizationServers []string `json:"authorization_servers"`
+	}
+	json.NewDecoder(resp.Body).Decode(&prm)
+	resp.Body.Close()
+	if prm.Resource != ts.URL+"/mcp" || len(prm.AuthorizationServers) != 1 || prm.AuthorizationServers[0] != ts.URL {
+		t.Errorf("Unexpected resource metadata: %+v", prm)
+	}
+
+	resp, err = http.Get(ts.URL + "/.well-known/oauth-authorization-server")
+	if err != nil {
+		t.Fatalf("Failed to fetch server metadata: %v", err)
+	}
+	var asm authServerMetadata
+	json.NewDecoder(resp.Body).Decode(&asm)
+	resp.Body.Close()
+	if asm.Issuer != ts.URL || asm.RegistrationEndpoint != ts.URL+"/oauth/register" || asm.CodeChallengeMethodsSupported[0] != "S256" {
+		t.Errorf("Unexpected server metadata: %+v", asm)
+	}
+}
+
+func TestOAuthFlow(t *testing.T) {
+	const apiKey = "developer-api-key"
+	const redirectURI = "https://client.example.com/callback"
+	ts := newOAuthTestServer(t, apiKey)
+	clientID := registerClient(t, ts, redirectURI)
+
+	resp := authorize(t, ts, clientID, redirectURI, apiKey)
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected redirect, got status %d", resp.StatusCode)
+	}
+	loc, _ := url.Parse(resp.Header.Get("Location"))
+	if !strings.HasPrefix(loc.String(), redirectURI) || loc.Query().Get("state") != "xyz" {
+		t.Fatalf("Unexpected redirect location: %s", loc)
+	}
+	code := loc.Query().Get("code")
+
+	// Wrong verifier consumes the code
+	status, _ := requestToken(t, ts, url.Values{
+		"grant_type": {"authorization_code"}, "code": {code}, "client_id": {clientID},
+		"redirect_uri": {redirectURI}, "code_verifier": {strings.Repeat("x", 43)},
+	})
+	if status != http.StatusBadRequest {
+		t.Fatalf("Expected PKCE failure with status %d, got %d", http.StatusBadRequest, status)
+	}
+	status, _ = requestToken(t, ts, url.Values{
+		"grant_type": {"authorization_code"}, "code": {code}, "client_id": {clientID},
+		"redirect_uri": {redirectURI}, "code_verifier": {testVerifier},
+	})
+	if status != http.StatusBadRequest {
+		t.Fatalf("Expected reused code to be rejected, got status %d", status)
+	}
+
+	loc, _ = url.Parse(authorize(t, ts, clientID, redirectURI, apiKey).Header.Get("Location"))
+	status, tok := requestToken(t, ts, url.Values{
+		"grant_type": {"authorization_code"}, "code": {loc.Query().Get("code")}, "client_id": {clientID},
+		"redirect_uri": {redirectURI}, "code_verifier": {testVerifier},
+	})
+	if status != http.StatusOK || tok.AccessToken == "" || tok.RefreshToken == "" {
+		t.Fatalf("Expected tokens, got status %d: %+v", status, tok)
+	}
+
+	if resp := callMCP(t, ts, tok.AccessToken); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected access token to be accepted, got status %d", resp.StatusCode)
+	}
+	if resp := callMCP(t, ts, apiKey); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected API key to be rejected as access token, got status %d", resp.StatusCode)
+	}
+
+	// Refresh tokens rotate
+	status, refreshed := requestToken(t, ts, url.Values{
+		"grant_type": {"refresh_token"}, "refresh_token": {tok.RefreshToken}, "client_id": {clientID},
+	})
+	if status != http.StatusOK || refreshed.AccessToken == tok.AccessToken {
+		t.Fatalf("Expected new tokens, got status %d: %+v", status, refreshed)
+	}
+	status, _ = requestToken(t, ts, url.Values{
+		"grant_type": {"refresh_token"}, "refresh_token": {tok.RefreshToken}, "client_id": {clientID},
+	})
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected used refresh token to be rejected, got status %d", status)
+	}
+	if resp := callMCP(t, ts, refreshed.AccessToken); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected refreshed access token to be accepted, got status %d", resp.StatusCode)
+	}
+}
+
+// TestOAuthClientEviction tests that registrations expire or evict clients which never
+// exchanged an authorization code, but keep authorized ones.
+func TestOAuthClientEviction(t *testing.T) {
+	const apiKey = "developer-api-key"
+	const redirectURI = "https://client.example.com/callback"
+	captureLog(t)
+	oauth := NewOAuthServer(apiKey, "")
+	r := chi.NewRouter()
+	oauth.Mount(r, nil)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	authorizedID := registerClient(t, ts, redirectURI)
+	loc, _ := url.Parse(authorize(t, ts, authorizedID, redirectURI, apiKey).Header.Get("Location"))
+	status, _ := requestToken(t, ts, url.Values{
+		"grant_type": {"authorization_code"}, "code": {loc.Query().Get("code")}, "client_id": {authorizedID},
+		"redirect_uri": {redirectURI}, "code_verifier": {testVerifier},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Expected tokens, got status %d", status)
+	}
+
+	var ids []string
+	for len(ids) < maxOAuthClients {
+		ids = append(ids, registerClient(t, ts, redirectURI))
+	}
+	// The oldest unauthorized client made room for the last registration
+	oauth.mu.Lock()
+	_, first := oauth.clients[ids[0]]
+	_, authorized := oauth.clients[authorizedID]
+	count := len(oauth.clients)
+	oauth.mu.Unlock()
+	if first || !authorized || count != maxOAuthClients {
+		t.Errorf("Expected the first unauthorized client to be evicted, got first=%v authorized=%v count=%d", first, authorized, count)
+	}
+	resp, err := http.Get(ts.URL + "/oauth/authorize?" + url.Values{"client_id": {ids[0]}, "redirect_uri": {redirectURI}}.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected the evicted client to be unknown, got status %d", resp.StatusCode)
+	}
+
+	// Clients expire without an authorization
+	oauth.mu.Lock()
+	oauth.clients[ids[1]].lastUsed = time.Now().Add(-unauthorizedClientTTL - time.Minute)
+	oauth.mu.Unlock()
+	registerClient(t, ts, redirectURI)
+	oauth.mu.Lock()
+	_, expired := oauth.clients[ids[1]]
+	_, kept := oauth.clients[ids[2]]
+	oauth.mu.Unlock()
+	if expired || !kept {
+		t.Errorf("Expected only the expired client to be removed, got expired=%v kept=%v", expired, kept)
+	}
+}
+
+func TestOAuthConsent(t *testing.T) {
+	const apiKey = "developer-api-key"
+	const redirectURI = "http://localhost:1234/callback"
+	ts := newOAuthTestServer(t, apiKey)
+	clientID := registerClient(t, ts, redirectURI)
+
+	resp := authorize(t, ts, clientID, redirectURI, "wrong-key")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected wrong API key to be rejected with status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	form := url.Values{"client_id": {clientID}, "redirect_uri": {"https://evil.example.com/callback"}, "response_type": {"code"}}
+	resp, err := noRedirectClient().Get(ts.URL + "/oauth/authorize?" + form.Encode())
+	if err != nil {
+		t.Fatalf("Failed to request consent page: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || resp.Header.Get("Location") != "" {
+		t.Errorf("Expected unregistered redirect_uri to be rejected without redirect, got status %d", resp.StatusCode)
+	}
+
+	form = url.Values{"client_id": {clientID}, "redirect_uri": {redirectURI}, "state": {"s"}, "action": {"deny"}}
+	resp, err = noRedirectClient().PostForm(ts.URL+"/oauth/authorize", form)
+	if err != nil {
+		t.Fatalf("Failed to deny consent: %v", err)
+	}
+	resp.Body.Close()
+	loc, _ := url.Parse(resp.Header.Get("Location"))
+	if loc.Query().Get("error") == "" || loc.Query().Get("code") != "" {
+		t.Errorf("Expected error redirect without code, got %s", loc)
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri         string
+		expectError bool
+	}{
+		{"https://claude.ai/api/mcp/auth_callback", false},
+		{"http://localhost:8080/callback", false},
+		{"http://127.0.0.1/callback", false},
+		{"http://example.com/callback", true},
+		{"https://example.com/callback#fragment", true},
+		{"/relative", true},
+		{"javascript:alert(1)", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.uri, func(t *testing.T) {
+			err := validateRedirectURI(tc.uri)
+			if tc.expectError && err == nil {
+				t.Errorf("Expected error for %s, got nil", tc.uri)
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("Unexpected error for %s: %v", tc.uri, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// Package lock serialises tool calls working on the same directory or file, so
+// parallel calls of one or several MCP sessions cannot corrupt the workspace.
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// DefaultWait is the time a call waits for a lock before it is rejected.
+const DefaultWait = 30 * time.Second
+
+// Holder describes who holds a lock.
+type Holder struct {
+	SessionID string
+	// Operation is e.g. the name of the tool or job holding the lock.
+	Operation string
+	Since     time.Time
+}
+
+// BusyError is returned if a lock could not be acquired in time.
+type BusyError struct {
+	Key    string
+	Holder Holder
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("%s is locked by %s of session %s since %s (%s ago), try again later",
+		e.Key, e.Holder.Operation, e.Holder.SessionID, e.Holder.Since.Format(time.TimeOnly), time.Since(e.Holder.Since).Round(time.Second))
+}
+
+// KeysFunc returns the keys a call with the given arguments has to lock, usually absolute paths.
+type KeysFunc func(ctx context.Context, arguments json.RawMessage) []string
+
+// Keys adapts a function taking the typed arguments of a tool to a [KeysFunc].
+func Keys[In any](fn func(ctx context.Context, args In) []string) KeysFunc {
+	return func(ctx context.Context, arguments json.RawMessage) []string {
+		var args In
+		if len(arguments) > 0 {
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return nil
+			}
+		}
+		return fn(ctx, args)
+	}
+}
+
+// Manager hands out exclusive locks on keys. A key conflicts with itself, its ancestors
+// and its descendants, so a write of a file waits for a build of its directory.
+// Waiting calls retry whenever a lock is released, until the wait time expires.
+type Manager struct {
+	wait time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*entry
+	tools map[string]KeysFunc
+}
+
+// entry is shared by all keys locked by one call.
+type entry struct {
+	holder Holder
+	// released is closed once the keys are unlocked
+	released chan struct{}
+}
+
+// NewManager returns a Manager letting calls wait up to wait for a lock. With a wait of 0,
+// calls finding a key locked are rejected right away.
+func NewManager(wait time.Duration) *Manager {
+	return &Manager{wait: wait, locks: make(map[string]*entry), tools: make(map[string]KeysFunc)}
+}
+
+// Guard makes every call of tool hold the locks of the keys returned by fn while it runs.
+func (m *Manager) Guard(tool string, fn KeysFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tools[tool] = fn
+}
+
+// Acquire locks all keys for holder, waiting up to the configured wait time for them.
+// The returned function releases the locks. A nil Manager does not lock anything.
+func (m *Manager) Acquire(ctx context.Context, keys []string, holder Holder) (release func(), err error) {
+	return m.acquire(ctx, keys, holder, m.waitTime())
+}
+
+// TryAcquire is like [Manager.Acquire] but fails right away if a key is locked.
+func (m *Manager) TryAcquire(keys []string, holder Holder) (release func(), err error) {
+	return m.acquire(context.Background(), keys, holder, 0)
+}
+
+func (m *Manager) waitTime() time.Duration {
+	if m == nil {
+		return 0
+	}
+	return m.wait
+}
+
+func (m *Manager) acquire(ctx context.Context, keys []string, holder Holder, wait time.Duration) (func(), error) {
+	if m == nil {
+		return func() {}, nil
+	}
+	if holder.Since.IsZero() {
+		holder.Since = time.Now()
+	}
+	keys = slices.Compact(slices.Sorted(slices.Values(keys)))
+
+	var timeout <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	// All keys are locked at once, so calls never wait while holding a part of their locks
+	// and cannot deadlock each other.
+	for {
+		m.mu.Lock()
+		key, held := m.conflict(keys)
+		if held == nil {
+			e := &entry{holder: holder, released: make(chan struct{})}
+			for _, key := range keys {
+				m.locks[key] = e
+			}
+			m.mu.Unlock()
+			return sync.OnceFunc(func() { m.unlock(keys, e) }), nil
+		}
+		busy := &BusyError{Key: key, Holder: held.holder}
+		m.mu.Unlock()
+
+		if timeout == nil {
+			return nil, busy
+		}
+		select {
+		case <-held.released:
+		case <-timeout:
+			return nil, busy
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// conflict returns a locked key overlapping one of keys and its entry, or nil if there is none.
+// m.mu must be held.
+func (m *Manager) conflict(keys []string) (string, *entry) {
+	for locked, e := range m.locks {
+		for _, key := range keys {
+			if overlaps(key, locked) {
+				return locked, e
+			}
+		}
+	}
+	return "", nil
+}
+
+func (m *Manager) unlock(keys []string, e *entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.locks, key)
+	}
+	close(e.released)
+}
+
+// overlaps reports whether a and b are the same path or one is within the other.
+func overlaps(a, b string) bool {
+	return a == b || within(a, b) || within(b, a)
+}
+
+func within(path, dir string) bool {
+	rest, ok := strings.CutPrefix(path, dir)
+	sep := string(filepath.Separator)
+	return ok && (strings.HasPrefix(rest, sep) || strings.HasSuffix(dir, sep))
+}
+
+// Middleware is an MCP middleware holding the locks of guarded tools while they run.
+// Calls which cannot get their locks in time return a tool error naming the holder.
+func (m *Manager) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || method != "tools/call" {
+			return next(ctx, method, req)
+		}
+		m.mu.Lock()
+		keysFunc := m.tools[call.Params.Name]
+		m.mu.Unlock()
+		if keysFunc == nil {
+			return next(ctx, method, req)
+		}
+
+		release, err := m.Acquire(ctx, keysFunc(ctx, call.Params.Arguments), Holder{SessionID: call.Session.ID(), Operation: call.Params.Name})
+		if err != nil {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("The call of %s could not be started: %v", call.Params.Name, err)}},
+			}, nil
+		}
+		defer release()
+		return next(ctx, method, req)
+	}
+}
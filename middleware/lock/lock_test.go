@@ -0,0 +1,185 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestAcquire(t *testing.T) {
+	m := NewManager(time.Second)
+	ctx := context.Background()
+
+	release, err := m.Acquire(ctx, []string{"/ws/a", "/ws/a/b.go"}, Holder{SessionID: "s1", Operation: "make_run"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Keys outside of the locked ones are not affected
+	for _, key := range []string{"/ws/b.go", "/ws/ab", "/ws/a.go"} {
+		other, err := m.TryAcquire([]string{key}, Holder{SessionID: "s2", Operation: "write"})
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", key, err)
+		}
+		other()
+	}
+
+	// The locked keys, their ancestors and their descendants are busy
+	for _, key := range []string{"/ws/a/b.go", "/ws/a", "/ws/a/c/d.go", "/ws", "/"} {
+		var busy *BusyError
+		_, err = m.TryAcquire([]string{"/other", key}, Holder{SessionID: "s2", Operation: "write"})
+		if !errors.As(err, &busy) || busy.Holder.SessionID != "s1" || busy.Holder.Operation != "make_run" {
+			t.Fatalf("Expected busy error naming the holder for %s, got %v", key, err)
+		}
+		if !strings.Contains(err.Error(), "make_run of session s1") {
+			t.Errorf("Unexpected error message: %v", err)
+		}
+	}
+	if _, ok := m.locks["/other"]; ok {
+		t.Errorf("Expected a failed call not to hold any key")
+	}
+
+	// A waiting call gets the lock once it is released
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		release()
+	}()
+	queued, err := m.Acquire(ctx, []string{"/ws"}, Holder{SessionID: "s2", Operation: "make_run"})
+	if err != nil {
+		t.Fatalf("Queued call failed: %v", err)
+	}
+	queued()
+	release() // releasing twice is harmless
+
+	if len(m.locks) != 0 {
+		t.Errorf("Expected all locks to be dropped, got %v", m.locks)
+	}
+}
+
+func TestAcquireTimeout(t *testing.T) {
+	m := NewManager(50 * time.Millisecond)
+	release, _ := m.TryAcquire([]string{"/ws"}, Holder{SessionID: "s1", Operation: "make_run"})
+	defer release()
+
+	var busy *BusyError
+	if _, err := m.Acquire(context.Background(), []string{"/ws"}, Holder{SessionID: "s2"}); !errors.As(err, &busy) {
+		t.Errorf("Expected busy error, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewManager(time.Minute).Acquire(ctx, nil, Holder{}); err != nil {
+		t.Errorf("Locking nothing failed: %v", err)
+	}
+}
+
+func TestAcquireConcurrent(t *testing.T) {
+	m := NewManager(10 * time.Second)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inside := 0
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Different key orders must not deadlock
+			keys := []string{"a", "b"}
+			if i%2 == 1 {
+				keys = []string{"b", "a"}
+			}
+			release, err := m.Acquire(context.Background(), keys, Holder{})
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			mu.Lock()
+			inside++
+			if inside > 1 {
+				t.Errorf("Lock held by %d calls", inside)
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			inside--
+			mu.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+}
+
+type pathArgs struct {
+	Path string `json:"path"`
+}
+
+func TestMiddleware(t *testing.T) {
+	m := NewManager(0)
+	started := make(chan struct{})
+	finish := make(chan struct{})
+
+	srv := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(srv, &mcp.Tool{Name: "build"}, func(ctx context.Context, req *mcp.CallToolRequest, args pathArgs) (*mcp.CallToolResult, any, error) {
+		close(started)
+		<-finish
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "built"}}}, nil, nil
+	})
+	var writes atomic.Int32
+	mcp.AddTool(srv, &mcp.Tool{Name: "write"}, func(ctx context.Context, req *mcp.CallToolRequest, args pathArgs) (*mcp.CallToolResult, any, error) {
+		writes.Add(1)
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "written"}}}, nil, nil
+	})
+	keys := Keys(func(ctx context.Context, args pathArgs) []string { return []string{args.Path} })
+	m.Guard("build", keys)
+	m.Guard("write", keys)
+	srv.AddReceivingMiddleware(m.Middleware)
+
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	ss, err := srv.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect server: %v", err)
+	}
+	defer ss.Close()
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil).Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer cs.Close()
+
+	done := make(chan *mcp.CallToolResult)
+	go func() {
+		res, _ := cs.CallTool(ctx, &mcp.CallToolParams{Name: "build", Arguments: map[string]any{"path": "/ws"}})
+		done <- res
+	}()
+	<-started
+
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "build", Arguments: map[string]any{"path": "/ws"}})
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	if !res.IsError || !strings.Contains(res.Content[0].(*mcp.TextContent).Text, "locked by build of session "+ss.ID()) {
+		t.Errorf("Expected lock error, got %+v", res.Content[0])
+	}
+
+	// A write of a file in the directory being built must not land in between
+	res, err = cs.CallTool(ctx, &mcp.CallToolParams{Name: "write", Arguments: map[string]any{"path": "/ws/a/b.go"}})
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	if !res.IsError || !strings.Contains(res.Content[0].(*mcp.TextContent).Text, "/ws is locked by build") || writes.Load() != 0 {
+		t.Errorf("Expected lock error, got %+v", res.Content[0])
+	}
+
+	close(finish)
+	if res := <-done; res == nil || res.IsError {
+		t.Errorf("First call failed: %+v", res)
+	}
+	if res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "write", Arguments: map[string]any{"path": "/ws/a/b.go"}}); err != nil || res.IsError || writes.Load() != 1 {
+		t.Errorf("Expected the write to succeed after the build, got %+v (%v)", res, err)
+	}
+}
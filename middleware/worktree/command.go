@@ -0,0 +1,100 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// Command implements the `mcpilot-pair session` subcommand and returns the exit code.
+func Command(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("session", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	repo := fs.String("C", ".", "Top-level directory of the repository the server ran in")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, `Usage: mcpilot-pair session [flags] list|show|merge|discard [branch]
+
+Review the worktrees of sessions started with --session-worktrees.
+
+  list     list the session branches with their commits and uncommitted changes
+  show     print the commits and changes of a session branch
+  merge    merge a session branch into the checked out branch and remove it
+  discard  remove a session worktree and its branch with all changes
+
+The branch may be given without the "mcpilot/" prefix and may be left out if
+there is only one session.
+
+Flags:`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	action, branch := fs.Arg(0), fs.Arg(1)
+	if fs.NArg() > 2 || action == "" {
+		fs.Usage()
+		return 2
+	}
+
+	ctx := context.Background()
+	m, err := NewManager(ctx, *repo)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if action == "list" {
+		worktrees, err := m.List(ctx)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		for _, wt := range worktrees {
+			state := "clean"
+			if wt.Dirty {
+				state = "uncommitted changes"
+			}
+			fmt.Fprintf(stdout, "%-40s  %3d commits  %-19s  %s\n", wt.Branch, wt.Ahead, state, wt.Path)
+		}
+		return 0
+	}
+
+	wt, err := m.Find(ctx, branch)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	switch action {
+	case "show":
+		out, err := m.Show(ctx, wt)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprint(stdout, out)
+	case "merge":
+		out, err := m.Merge(ctx, wt)
+		fmt.Fprint(stdout, out)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Merged and removed %s\n", wt.Branch)
+	case "discard":
+		if err := m.Discard(ctx, wt); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Discarded %s\n", wt.Branch)
+	default:
+		fmt.Fprintf(stderr, "unknown action %q\n", action)
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
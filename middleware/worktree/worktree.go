@@ -0,0 +1,326 @@
+// Package worktree gives every MCP session its own git worktree on a fresh branch, so
+// the tools of a session never touch the checkout the server was started in.
+package worktree
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/seb-schulz/mcpilot-pair/internal/gitsafe"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+// BranchPrefix is the prefix of the branches of sessions.
+const BranchPrefix = "mcpilot/"
+
+// Worktree is the worktree of a session.
+type Worktree struct {
+	Branch string `json:"branch"`
+	Path   string `json:"path"`
+	// Ahead is the number of commits of the branch which are not in the checked out branch.
+	Ahead int `json:"ahead"`
+	// Dirty indicates whether the worktree has uncommitted changes or untracked files.
+	Dirty bool `json:"dirty"`
+}
+
+// session is a worktree created by the running server.
+type session struct {
+	branch string
+	path   string
+	// base is the commit the branch started at.
+	base string
+}
+
+// Manager creates the worktrees of sessions below the git directory of a repository.
+type Manager struct {
+	repo string
+	dir  string
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewManager returns a Manager for the repository whose top-level directory is dir. The
+// worktrees are kept in the git directory, so they are neither part of the checkout nor
+// outside of it.
+func NewManager(ctx context.Context, dir string) (*Manager, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	top, err := git(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("%s is not in a git repository", dir)
+	}
+	if !sameDir(dir, strings.TrimSpace(top)) {
+		return nil, fmt.Errorf("%s is not the top-level directory of the repository %s", dir, strings.TrimSpace(top))
+	}
+	common, err := git(ctx, dir, "rev-parse", "--path-format=absolute", "--git-common-dir")
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{
+		repo:     dir,
+		dir:      filepath.Join(strings.TrimSpace(common), "mcpilot-pair", "worktrees"),
+		sessions: make(map[string]*session),
+	}, nil
+}
+
+// Dir returns the directory containing the worktrees of the sessions.
+func (m *Manager) Dir() string {
+	return m.dir
+}
+
+// sameDir reports whether a and b are the same directory after resolving symlinks.
+func sameDir(a, b string) bool {
+	a, errA := filepath.EvalSymlinks(a)
+	b, errB := filepath.EvalSymlinks(b)
+	return errA == nil && errB == nil && a == b
+}
+
+// Open returns the worktree of a session. The first call creates a branch at the commit
+// checked out in the repository and a worktree for it.
+func (m *Manager) Open(ctx context.Context, sessionID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.sessions[sessionID]; ok {
+		return s.path, nil
+	}
+
+	name := time.Now().Format("20060102-150405")
+	if id := sanitize(sessionID); id != "" {
+		name += "-" + id
+	}
+	// Sessions started within the same second may share the name
+	unique := name
+	for i := 2; m.exists(ctx, unique); i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	name = unique
+	s := &session{branch: BranchPrefix + name, path: filepath.Join(m.dir, name)}
+	if _, err := git(ctx, m.repo, "worktree", "add", "--quiet", "-b", s.branch, s.path, "HEAD"); err != nil {
+		return "", err
+	}
+	base, err := git(ctx, s.path, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	s.base = strings.TrimSpace(base)
+	m.sessions[sessionID] = s
+	log.Printf("Session %s works in %s on branch %s", sessionID, s.path, s.branch)
+	return s.path, nil
+}
+
+// exists reports whether the branch or the worktree directory of name already exist.
+func (m *Manager) exists(ctx context.Context, name string) bool {
+	if _, err := os.Stat(filepath.Join(m.dir, name)); err == nil {
+		return true
+	}
+	_, err := git(ctx, m.repo, "rev-parse", "--verify", "--quiet", "refs/heads/"+BranchPrefix+name)
+	return err == nil
+}
+
+// sanitize returns the first 8 letters and digits of a session ID.
+func sanitize(sessionID string) string {
+	var b strings.Builder
+	for _, r := range sessionID {
+		if b.Len() == 8 {
+			break
+		}
+		if r < 128 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// EndSession forgets the worktree of a session. Worktrees without commits or changes
+// are removed together with their branch, all others are kept for review.
+func (m *Manager) EndSession(sessionID string) {
+	m.mu.Lock()
+	s, ok := m.sessions[sessionID]
+	delete(m.sessions, sessionID)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	head, err := git(ctx, s.path, "rev-parse", "HEAD")
+	if err != nil {
+		log.Printf("Keeping worktree %s: %v", s.path, err)
+		return
+	}
+	status, err := git(ctx, s.path, "status", "--porcelain")
+	if err != nil || strings.TrimSpace(head) != s.base || status != "" {
+		log.Printf("Session %s left its work on branch %s, see `mcpilot-pair session show %s`", sessionID, s.branch, s.branch)
+		return
+	}
+	if err := m.remove(ctx, Worktree{Branch: s.branch, Path: s.path}, true); err != nil {
+		log.Printf("Failed to remove the unused worktree %s: %v", s.path, err)
+	}
+}
+
+// Middleware is an MCP middleware running every tool call in the worktree of its session.
+// It has to be the outermost middleware, so the others resolve paths in the worktree too.
+func (m *Manager) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || method != "tools/call" {
+			return next(ctx, method, req)
+		}
+		path, err := m.Open(ctx, call.Session.ID())
+		if err != nil {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("The call of %s could not be started: no worktree for the session: %v", call.Params.Name, err)}},
+			}, nil
+		}
+		return next(filesystem.WithRoot(ctx, path), method, req)
+	}
+}
+
+// List returns the worktrees of sessions, including those of earlier runs of the server.
+func (m *Manager) List(ctx context.Context) ([]Worktree, error) {
+	out, err := git(ctx, m.repo, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	var worktrees []Worktree
+	for _, block := range strings.Split(out, "\n\n") {
+		var wt Worktree
+		for _, line := range strings.Split(block, "\n") {
+			if path, ok := strings.CutPrefix(line, "worktree "); ok {
+				wt.Path = path
+			} else if ref, ok := strings.CutPrefix(line, "branch refs/heads/"); ok {
+				wt.Branch = ref
+			}
+		}
+		if wt.Path == "" || !strings.HasPrefix(wt.Branch, BranchPrefix) {
+			continue
+		}
+		if ahead, err := git(ctx, m.repo, "rev-list", "--count", "HEAD.."+wt.Branch); err == nil {
+			wt.Ahead, _ = strconv.Atoi(strings.TrimSpace(ahead))
+		}
+		if status, err := git(ctx, wt.Path, "status", "--porcelain"); err != nil || status != "" {
+			wt.Dirty = true
+		}
+		worktrees = append(worktrees, wt)
+	}
+	return worktrees, nil
+}
+
+// Find returns the worktree of branch, which may be given without [BranchPrefix]. An empty
+// branch selects the only worktree.
+func (m *Manager) Find(ctx context.Context, branch string) (Worktree, error) {
+	worktrees, err := m.List(ctx)
+	if err != nil {
+		return Worktree{}, err
+	}
+	if branch == "" {
+		if len(worktrees) != 1 {
+			return Worktree{}, fmt.Errorf("there are %d session worktrees, name the branch", len(worktrees))
+		}
+		return worktrees[0], nil
+	}
+	for _, wt := range worktrees {
+		if wt.Branch == branch || wt.Branch == BranchPrefix+branch {
+			return wt, nil
+		}
+	}
+	return Worktree{}, fmt.Errorf("no session worktree for branch '%s'", branch)
+}
+
+// Show returns the commits of a worktree not in the checked out branch, their changes, and
+// the uncommitted changes of the worktree.
+func (m *Manager) Show(ctx context.Context, wt Worktree) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Branch %s in %s\n\n", wt.Branch, wt.Path)
+	commits, err := git(ctx, m.repo, "log", "--format=%h %s", "HEAD.."+wt.Branch, "--")
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&b, "Commits:\n%s\n", cmp.Or(commits, "(none)\n"))
+	// Changes since the branch started, like a pull request would show them
+	patch, err := git(ctx, m.repo, "diff", "--no-ext-diff", "--no-textconv", "HEAD..."+wt.Branch, "--")
+	if err != nil {
+		return "", err
+	}
+	b.WriteString(patch)
+	status, err := git(ctx, wt.Path, "status", "--short", "--untracked-files=all")
+	if err != nil {
+		return "", err
+	}
+	if status != "" {
+		fmt.Fprintf(&b, "\nUncommitted changes:\n%s", status)
+		uncommitted, err := git(ctx, wt.Path, "diff", "--no-ext-diff", "--no-textconv", "HEAD", "--")
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(uncommitted)
+	}
+	return b.String(), nil
+}
+
+// Merge merges the branch of a worktree into the checked out branch and removes the
+// worktree and the branch afterwards. Uncommitted changes in the worktree are refused.
+func (m *Manager) Merge(ctx context.Context, wt Worktree) (string, error) {
+	if wt.Dirty {
+		return "", fmt.Errorf("%s has uncommitted changes, commit them in %s or discard the session", wt.Branch, wt.Path)
+	}
+	out, err := git(ctx, m.repo, "merge", "--no-ff", "--no-edit", wt.Branch)
+	if err != nil {
+		return "", err
+	}
+	return out, m.remove(ctx, wt, false)
+}
+
+// Discard removes a worktree with all its changes and deletes its branch.
+func (m *Manager) Discard(ctx context.Context, wt Worktree) error {
+	return m.remove(ctx, wt, true)
+}
+
+// remove removes a worktree and its branch. Unless force is set, both have to be clean
+// or merged.
+func (m *Manager) remove(ctx context.Context, wt Worktree, force bool) error {
+	removeArgs := []string{"worktree", "remove", wt.Path}
+	deleteArgs := []string{"branch", "--delete", wt.Branch}
+	if force {
+		removeArgs = []string{"worktree", "remove", "--force", wt.Path}
+		deleteArgs = []string{"branch", "--delete", "--force", wt.Branch}
+	}
+	if _, err := git(ctx, m.repo, removeArgs...); err != nil {
+		return err
+	}
+	_, err := git(ctx, m.repo, deleteArgs...)
+	return err
+}
+
+// git runs git with args in dir and returns its standard output. A failure is returned
+// as error containing the standard error output. Hooks and filters of the repository are
+// not run, sandboxed commands may have changed them.
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd := exec.CommandContext(ctx, "git", slices.Concat(gitsafe.NoHooks, gitsafe.Args(ctx, dir, env), args)...)
+	cmd.Dir = dir
+	cmd.Env = env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %s", args[0], cmp.Or(strings.TrimSpace(stderr.String()), err.Error()))
+	}
+	return string(out), nil
+}
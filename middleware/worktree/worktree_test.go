@@ -0,0 +1,167 @@
+package worktree
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+// setupRepo creates a git repository with an initial commit and returns its directory.
+func setupRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("readme\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, "init", "-q", "-b", "main")
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "commit", "-q", "-m", "Initial commit")
+	return dir
+}
+
+func gitCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+	return string(out)
+}
+
+func TestNewManager(t *testing.T) {
+	dir := setupRepo(t)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewManager(context.Background(), filepath.Join(dir, "sub")); err == nil {
+		t.Error("Expected an error for a subdirectory of the repository")
+	}
+	if _, err := NewManager(context.Background(), t.TempDir()); err == nil {
+		t.Error("Expected an error outside of a repository")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	dir := setupRepo(t)
+	m, err := NewManager(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	srv := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(srv, &mcp.Tool{Name: "write"}, func(ctx context.Context, req *mcp.CallToolRequest, args filesystem.WriteFileArgs) (*mcp.CallToolResult, any, error) {
+		if _, err := filesystem.WriteFile(ctx, args); err != nil {
+			return nil, nil, err
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "written"}}}, nil, nil
+	})
+	srv.AddReceivingMiddleware(m.Middleware)
+
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	ss, err := srv.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect server: %v", err)
+	}
+	defer ss.Close()
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil).Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer cs.Close()
+
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "write", Arguments: map[string]any{"path": "new.txt", "content": "new\n"}})
+	if err != nil || res.IsError {
+		t.Fatalf("Failed to call tool: %v %+v", err, res)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkout to be untouched, got %v", err)
+	}
+
+	wt, err := m.Find(ctx, "")
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if !strings.HasPrefix(wt.Branch, BranchPrefix) || !wt.Dirty || wt.Ahead != 0 {
+		t.Errorf("Unexpected worktree: %+v", wt)
+	}
+	if content, err := os.ReadFile(filepath.Join(wt.Path, "new.txt")); err != nil || string(content) != "new\n" {
+		t.Errorf("Expected new.txt in the worktree, got %q, %v", content, err)
+	}
+	if path, err := m.Open(ctx, ss.ID()); err != nil || path != wt.Path {
+		t.Errorf("Expected the same worktree for the session, got %s, %v", path, err)
+	}
+
+	if _, err := m.Merge(ctx, wt); err == nil {
+		t.Error("Expected merge to refuse uncommitted changes")
+	}
+	gitCmd(t, wt.Path, "add", "new.txt")
+	gitCmd(t, wt.Path, "commit", "-q", "-m", "Add new.txt")
+	if wt, err = m.Find(ctx, strings.TrimPrefix(wt.Branch, BranchPrefix)); err != nil || wt.Dirty || wt.Ahead != 1 {
+		t.Fatalf("Unexpected worktree after commit: %+v, %v", wt, err)
+	}
+	out, err := m.Show(ctx, wt)
+	if err != nil || !strings.Contains(out, "Add new.txt") || !strings.Contains(out, "+new") {
+		t.Errorf("Unexpected show output: %v\n%s", err, out)
+	}
+
+	if _, err := m.Merge(ctx, wt); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); err != nil {
+		t.Errorf("Expected new.txt in the checkout after merge: %v", err)
+	}
+	if worktrees, _ := m.List(ctx); len(worktrees) != 0 {
+		t.Errorf("Expected the worktree to be removed, got %+v", worktrees)
+	}
+}
+
+func TestEndSession(t *testing.T) {
+	dir := setupRepo(t)
+	ctx := context.Background()
+	m, err := NewManager(ctx, dir)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	if _, err := m.Open(ctx, "unused"); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	path, err := m.Open(ctx, "changed")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "README"), []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m.EndSession("unused")
+	m.EndSession("changed")
+	worktrees, err := m.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(worktrees) != 1 || worktrees[0].Path != path {
+		t.Fatalf("Expected only the changed worktree to be kept, got %+v", worktrees)
+	}
+
+	if err := m.Discard(ctx, worktrees[0]); err != nil {
+		t.Fatalf("Discard failed: %v", err)
+	}
+	if branches := gitCmd(t, dir, "branch", "--list", BranchPrefix+"*"); branches != "" {
+		t.Errorf("Expected the branches to be deleted, got %q", branches)
+	}
+}
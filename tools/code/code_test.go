@@ -0,0 +1,318 @@
+package code
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupModule creates a temporary Go module from files and changes into it.
+func setupModule(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	oldwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current working directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(oldwd) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change working directory: %v", err)
+	}
+
+	files["go.mod"] = "module example.com/m\n\ngo 1.22\n"
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+}
+
+var testFiles = map[string]string{
+	"store/store.go": `// Package store keeps values.
+package store
+
+import "strings"
+
+// Store keeps values by key.
+type Store struct {
+	// Values are the stored values.
+	Values map[string]string
+}
+
+// DefaultKey is used if no key is given.
+const DefaultKey = "default"
+
+var (
+	// hits counts the lookups.
+	hits int
+)
+
+// Get returns the value of key.
+func (s *Store) Get(key string) string {
+	hits++
+	return s.Values[strings.ToLower(key)]
+}
+
+func New() *Store {
+	return &Store{Values: map[string]string{}}
+}
+`,
+	"store/store_test.go": `package store
+
+import "testing"
+
+func TestGet(t *testing.T) {}
+`,
+	"main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/m/store"
+)
+
+// Get is not the method of Store.
+func Get() string {
+	return store.New().Get(store.DefaultKey)
+}
+
+func main() {
+	fmt.Println(Get())
+}
+`,
+}
+
+func TestOutline(t *testing.T) {
+	setupModule(t, testFiles)
+
+	result, err := Outline(context.Background(), OutlineArgs{Path: "store"})
+	if err != nil {
+		t.Fatalf("Outline failed: %v", err)
+	}
+	if result.Package != "store" {
+		t.Errorf("Expected package store, got %s", result.Package)
+	}
+	want := []Declaration{
+		{Name: "Store", Kind: "type", Signature: "type Store struct", File: "store/store.go", Line: 6, EndLine: 10, Doc: "Store keeps values by key."},
+		{Name: "DefaultKey", Kind: "const", Signature: `const DefaultKey = "default"`, File: "store/store.go", Line: 12, EndLine: 13, Doc: "DefaultKey is used if no key is given."},
+		{Name: "hits", Kind: "var", Signature: "var hits int", File: "store/store.go", Line: 16, EndLine: 17, Doc: "hits counts the lookups."},
+		{Name: "Store.Get", Kind: "method", Signature: "func (s *Store) Get(key string) string", File: "store/store.go", Line: 20, EndLine: 24, Doc: "Get returns the value of key."},
+		{Name: "New", Kind: "func", Signature: "func New() *Store", File: "store/store.go", Line: 26, EndLine: 28},
+	}
+	if len(result.Declarations) != len(want) {
+		t.Fatalf("Expected %d declarations, got %+v", len(want), result.Declarations)
+	}
+	for i, d := range result.Declarations {
+		if d != want[i] {
+			t.Errorf("Declaration %d:\n got %+v\nwant %+v", i, d, want[i])
+		}
+	}
+
+	result, err = Outline(context.Background(), OutlineArgs{Path: "store", IncludeTests: true, ExportedOnly: true})
+	if err != nil {
+		t.Fatalf("Outline failed: %v", err)
+	}
+	if len(result.Declarations) != 5 || result.Declarations[4].Name != "TestGet" {
+		t.Errorf("Expected exported declarations including tests, got %+v", result.Declarations)
+	}
+
+	if _, err := Outline(context.Background(), OutlineArgs{Path: "go.mod"}); err == nil {
+		t.Error("Expected an error for a file which is not Go")
+	}
+}
+
+func TestFindSymbol(t *testing.T) {
+	setupModule(t, testFiles)
+
+	tests := []struct {
+		name  string
+		want  []string
+		files []string
+	}{
+		{"Get", []string{"main.Get", "store.Store.Get"}, []string{"main.go", "store/store.go"}},
+		{"Store.Get", []string{"store.Store.Get"}, []string{"store/store.go"}},
+		{"store.Store.Values", []string{"store.Store.Values"}, []string{"store/store.go"}},
+		{"DefaultKey", []string{"store.DefaultKey"}, []string{"store/store.go"}},
+		{"Missing", nil, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := FindSymbol(context.Background(), FindSymbolArgs{Name: tc.name})
+			if err != nil {
+				t.Fatalf("FindSymbol failed: %v", err)
+			}
+			if len(result.Symbols) != len(tc.want) {
+				t.Fatalf("Expected %v, got %+v", tc.want, result.Symbols)
+			}
+			for i, s := range result.Symbols {
+				if s.Name != tc.want[i] || s.File != tc.files[i] {
+					t.Errorf("Expected %s in %s, got %+v", tc.want[i], tc.files[i], s)
+				}
+			}
+		})
+	}
+
+	result, err := FindSymbol(context.Background(), FindSymbolArgs{Name: "Store.Get", Directory: "store"})
+	if err != nil {
+		t.Fatalf("FindSymbol failed: %v", err)
+	}
+	want := Symbol{
+		Name:      "store.Store.Get",
+		Kind:      "method",
+		Package:   "example.com/m/store",
+		Signature: "func (*Store).Get(key string) string",
+		File:      "store/store.go",
+		Line:      21,
+		Column:    17,
+		Doc:       "Get returns the value of key.",
+	}
+	if result.Symbols[0] != want {
+		t.Errorf("Unexpected symbol:\n got %+v\nwant %+v", result.Symbols[0], want)
+	}
+
+	if _, err := FindSymbol(context.Background(), FindSymbolArgs{Name: "a..b"}); err == nil {
+		t.Error("Expected an error for an invalid name")
+	}
+}
+
+func TestReferences(t *testing.T) {
+	setupModule(t, testFiles)
+
+	result, err := References(context.Background(), ReferencesArgs{Name: "Store.Values"})
+	if err != nil {
+		t.Fatalf("References failed: %v", err)
+	}
+	want := []Reference{
+		{File: "store/store.go", Line: 23, Column: 11, Function: "store.Store.Get", Text: "return s.Values[strings.ToLower(key)]"},
+		{File: "store/store.go", Line: 27, Column: 16, Function: "store.New", Text: "return &Store{Values: map[string]string{}}"},
+	}
+	if result.Symbol.Name != "store.Store.Values" || len(result.References) != len(want) {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	for i, r := range result.References {
+		if r != want[i] {
+			t.Errorf("Reference %d:\n got %+v\nwant %+v", i, r, want[i])
+		}
+	}
+
+	if _, err := References(context.Background(), ReferencesArgs{Name: "Get"}); err == nil || !strings.Contains(err.Error(), "main.Get, store.Store.Get") {
+		t.Errorf("Expected an ambiguity error, got %v", err)
+	}
+}
+
+func TestCallHierarchy(t *testing.T) {
+	setupModule(t, testFiles)
+
+	callers, err := Callers(context.Background(), CallHierarchyArgs{Name: "store.New"})
+	if err != nil {
+		t.Fatalf("Callers failed: %v", err)
+	}
+	if len(callers.Calls) != 1 || callers.Calls[0].Function != "main.Get" || callers.Calls[0].Line != 11 {
+		t.Errorf("Unexpected callers: %+v", callers.Calls)
+	}
+	// A type is used but not called
+	if _, err := Callers(context.Background(), CallHierarchyArgs{Name: "Store"}); err == nil {
+		t.Error("Expected an error for a type")
+	}
+
+	callees, err := Callees(context.Background(), CallHierarchyArgs{Name: "main.Get"})
+	if err != nil {
+		t.Fatalf("Callees failed: %v", err)
+	}
+	var names []string
+	for _, c := range callees.Calls {
+		names = append(names, c.Name)
+	}
+	if strings.Join(names, ",") != "store.New,store.Store.Get" {
+		t.Errorf("Unexpected callees: %+v", callees.Calls)
+	}
+	if c := callees.Calls[1]; c.Package != "example.com/m/store" || c.DefinitionFile != "store/store.go" || c.DefinitionLine != 21 {
+		t.Errorf("Unexpected callee: %+v", c)
+	}
+
+	callees, err = Callees(context.Background(), CallHierarchyArgs{Name: "main.main"})
+	if err != nil {
+		t.Fatalf("Callees failed: %v", err)
+	}
+	if len(callees.Calls) != 2 || callees.Calls[0].Name != "fmt.Println" || callees.Calls[0].DefinitionFile != "" || callees.Calls[1].Name != "main.Get" {
+		t.Errorf("Unexpected callees: %+v", callees.Calls)
+	}
+}
+
+func TestRename(t *testing.T) {
+	setupModule(t, testFiles)
+
+	result, err := Rename(context.Background(), RenameArgs{Name: "Store.Values", NewName: "Entries"})
+	if err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if result.Applied || result.Edits != 3 || strings.Join(result.Files, ",") != "store/store.go" {
+		t.Errorf("Unexpected preview: %+v", result)
+	}
+	if !strings.Contains(result.Diff, "+\tEntries map[string]string\n") || !strings.Contains(result.Diff, "+\treturn s.Entries[strings.ToLower(key)]\n") {
+		t.Errorf("Unexpected diff:\n%s", result.Diff)
+	}
+	if data, _ := os.ReadFile("store/store.go"); string(data) != testFiles["store/store.go"] {
+		t.Error("The preview changed the file")
+	}
+
+	result, err = Rename(context.Background(), RenameArgs{Name: "store.New", NewName: "NewStore", Apply: true})
+	if err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if !result.Applied || strings.Join(result.Files, ",") != "main.go,store/store.go" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if data, _ := os.ReadFile("main.go"); !strings.Contains(string(data), "store.NewStore().Get(store.DefaultKey)") {
+		t.Errorf("main.go was not renamed:\n%s", data)
+	}
+	if data, _ := os.ReadFile("store/store.go"); !strings.Contains(string(data), "func NewStore() *Store {") {
+		t.Errorf("store.go was not renamed:\n%s", data)
+	}
+
+	tests := []struct {
+		name, newName, err string
+	}{
+		{"hits", "key", "the use of hits at store/store.go:22 would refer to key declared at store/store.go:21"},
+		{"DefaultKey", "NewStore", "package store already declares NewStore at store/store.go:26"},
+		{"Store.Get", "Values", "store.Store already has a field Values"},
+		{"main.Get", "func", "invalid new name"},
+		// Unexported names cannot be used by main
+		{"store.NewStore", "newStore", "main.go:11:15: name newStore not exported by package store"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Rename(context.Background(), RenameArgs{Name: tc.name, NewName: tc.newName, Apply: true})
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+	if data, _ := os.ReadFile("main.go"); !strings.Contains(string(data), "store.NewStore()") {
+		t.Errorf("A refused rename changed main.go:\n%s", data)
+	}
+}
+
+// TestRenameExcluded tests that names used in files excluded by build constraints are not renamed.
+func TestRenameExcluded(t *testing.T) {
+	setupModule(t, map[string]string{
+		"a.go":        "package a\n\nfunc helper() int { return 1 }\n\nfunc Exported() int { return helper() }\n\nfunc other() int { return 2 }\n",
+		"a_plan9.go":  "package a\n\nfunc plan9() int { return helper() }\n",
+		"int_test.go": "//go:build integration\n\npackage a_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/m\"\n)\n\nfunc TestExported(t *testing.T) { a.Exported() }\n",
+	})
+
+	for _, name := range []string{"helper", "Exported"} {
+		_, err := Rename(context.Background(), RenameArgs{Name: name, NewName: "renamed", Apply: true})
+		if err == nil || !strings.Contains(err.Error(), "rename it by hand") {
+			t.Errorf("Expected the rename of %s to be refused, got %v", name, err)
+		}
+	}
+	if _, err := Rename(context.Background(), RenameArgs{Name: "other", NewName: "renamed", Apply: true}); err != nil {
+		t.Errorf("Rename failed: %v", err)
+	}
+}
@@ -0,0 +1,384 @@
+// Package code analyses Go source code with go/parser and go/types, without running
+// the go command or other binaries.
+package code
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+// buildContext selects the files of packages. Without cgo, packages like net are
+// type-checked from their pure Go files.
+var buildContext = func() build.Context {
+	c := build.Default
+	c.CgoEnabled = false
+	return c
+}()
+
+// deps caches the packages of the standard library and the module cache, which do not
+// change while the server runs. Only their exported API is type-checked.
+var deps = struct {
+	sync.Mutex
+	fset     *token.FileSet
+	packages map[string]*types.Package
+}{fset: token.NewFileSet(), packages: make(map[string]*types.Package)}
+
+// Package is a package of the module.
+type Package struct {
+	Path  string
+	Name  string
+	Dir   string
+	Files []*ast.File
+	Types *types.Package
+	Info  *types.Info
+	// Errors are the type errors found by [module.check].
+	Errors []types.Error
+
+	checking bool
+}
+
+// module is a Go module parsed from source.
+type module struct {
+	root     string
+	dir      string
+	path     string
+	requires map[string]string
+	fset     *token.FileSet
+	packages map[string]*Package
+	// overlay replaces the content of files by absolute path when they are parsed.
+	overlay map[string][]byte
+	// excluded are the absolute paths of the Go files which are not parsed, as build
+	// constraints exclude them for the host or they use cgo.
+	excluded []string
+}
+
+// loadModule parses the packages of the module containing dir, which must be inside the
+// working directory of ctx. Packages are type-checked by [module.checkAll].
+func loadModule(ctx context.Context, directory string) (*module, error) {
+	root, err := filesystem.ResolvePath(ctx, ".")
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filesystem.ResolveDirectory(ctx, directory)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			break
+		}
+		if dir == root || filepath.Dir(dir) == dir {
+			return nil, fmt.Errorf("no go.mod found in %s or its parents within the working directory", cmp.Or(directory, "."))
+		}
+		dir = filepath.Dir(dir)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+	m := &module{root: root, dir: dir, fset: token.NewFileSet(), packages: make(map[string]*Package)}
+	m.path, m.requires = parseGoMod(data)
+	if m.path == "" {
+		return nil, fmt.Errorf("no module path in %s", filepath.Join(dir, "go.mod"))
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir {
+			name := d.Name()
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata" {
+				return filepath.SkipDir
+			}
+			// Nested modules are not part of this one
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		return m.parseDir(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseGoMod returns the module path and the required modules of a go.mod file.
+func parseGoMod(data []byte) (string, map[string]string) {
+	var path string
+	requires := make(map[string]string)
+	inRequire := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case inRequire && fields[0] == ")":
+			inRequire = false
+		case inRequire && len(fields) >= 2:
+			requires[strings.Trim(fields[0], `"`)] = fields[1]
+		case fields[0] == "module" && len(fields) >= 2:
+			path = strings.Trim(fields[1], `"`)
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inRequire = true
+		case fields[0] == "require" && len(fields) >= 3:
+			requires[strings.Trim(fields[1], `"`)] = fields[2]
+		}
+	}
+	return path, requires
+}
+
+// parseDir parses the package in dir, including its tests. External test packages are
+// added with the suffix "_test".
+func (m *module) parseDir(dir string) error {
+	bp, err := buildContext.ImportDir(dir, 0)
+	if bp != nil {
+		for _, name := range slices.Concat(bp.IgnoredGoFiles, bp.CgoFiles) {
+			m.excluded = append(m.excluded, filepath.Join(dir, name))
+		}
+	}
+	if err != nil {
+		// Directories without Go files or with several packages are skipped
+		return nil
+	}
+	rel, err := filepath.Rel(m.dir, dir)
+	if err != nil {
+		return err
+	}
+	path := m.path
+	if rel != "." {
+		path += "/" + filepath.ToSlash(rel)
+	}
+	for _, p := range []struct {
+		path, name string
+		files      []string
+	}{
+		{path, bp.Name, append(bp.GoFiles, bp.TestGoFiles...)},
+		{path + "_test", bp.Name + "_test", bp.XTestGoFiles},
+	} {
+		if len(p.files) == 0 {
+			continue
+		}
+		pkg := &Package{Path: p.path, Name: p.name, Dir: dir}
+		for _, name := range p.files {
+			var src any
+			if data, ok := m.overlay[filepath.Join(dir, name)]; ok {
+				src = data
+			}
+			f, err := parser.ParseFile(m.fset, filepath.Join(dir, name), src, parser.ParseComments|parser.SkipObjectResolution)
+			if f == nil {
+				return err
+			}
+			pkg.Files = append(pkg.Files, f)
+		}
+		m.packages[p.path] = pkg
+	}
+	return nil
+}
+
+// sorted returns the packages of the module sorted by import path.
+func (m *module) sorted() []*Package {
+	packages := make([]*Package, 0, len(m.packages))
+	for _, p := range m.packages {
+		packages = append(packages, p)
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Path < packages[j].Path })
+	return packages
+}
+
+// checkAll type-checks all packages of the module. Type errors are collected in
+// [Package.Errors] instead of stopping the check, so broken code is analysed as far as possible.
+func (m *module) checkAll(ctx context.Context) error {
+	deps.Lock()
+	defer deps.Unlock()
+	for _, p := range m.sorted() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		m.check(p)
+	}
+	return nil
+}
+
+// check type-checks p and the packages it imports.
+func (m *module) check(p *Package) (*types.Package, error) {
+	if p.Types != nil {
+		return p.Types, nil
+	}
+	if p.checking {
+		return nil, fmt.Errorf("import cycle through %s", p.Path)
+	}
+	p.checking = true
+	defer func() { p.checking = false }()
+
+	p.Info = &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	conf := types.Config{Importer: m, FakeImportC: true, Error: func(err error) {
+		if e, ok := err.(types.Error); ok {
+			p.Errors = append(p.Errors, e)
+		}
+	}}
+	p.Types, _ = conf.Check(p.Path, m.fset, p.Files, p.Info)
+	return p.Types, nil
+}
+
+// Import implements [types.Importer].
+func (m *module) Import(path string) (*types.Package, error) {
+	return m.ImportFrom(path, "", 0)
+}
+
+// ImportFrom implements [types.ImporterFrom]: packages of the module are type-checked
+// completely, the standard library and required modules from the module cache only
+// for their API.
+func (m *module) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if p, ok := m.packages[path]; ok {
+		return m.check(p)
+	}
+	depDir, err := m.resolve(path, dir)
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := deps.packages[depDir]; ok {
+		if p == nil {
+			return nil, fmt.Errorf("import cycle through %s", path)
+		}
+		return p, nil
+	}
+	bp, err := buildContext.ImportDir(depDir, 0)
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		f, err := parser.ParseFile(deps.fset, filepath.Join(depDir, name), nil, parser.SkipObjectResolution)
+		if f == nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	deps.packages[depDir] = nil
+	conf := types.Config{Importer: m, Error: func(error) {}, FakeImportC: true, IgnoreFuncBodies: true}
+	p, _ := conf.Check(path, deps.fset, files, nil)
+	deps.packages[depDir] = p
+	return p, nil
+}
+
+// resolve returns the directory of a package outside of the module.
+func (m *module) resolve(path, fromDir string) (string, error) {
+	goroot := goRoot()
+	if first, _, _ := strings.Cut(path, "/"); !strings.Contains(first, ".") {
+		return isDir(filepath.Join(goroot, "src", path))
+	}
+	// The standard library vendors its dependencies
+	if goroot != "" && strings.HasPrefix(fromDir, filepath.Join(goroot, "src")+string(filepath.Separator)) {
+		if dir, err := isDir(filepath.Join(goroot, "src", "vendor", path)); err == nil {
+			return dir, nil
+		}
+	}
+	// The longest required module containing the package
+	var modPath string
+	for p := range m.requires {
+		if (path == p || strings.HasPrefix(path, p+"/")) && len(p) > len(modPath) {
+			modPath = p
+		}
+	}
+	if modPath == "" {
+		return "", fmt.Errorf("package %s is not provided by a required module", path)
+	}
+	escaped, err := escapePath(modPath + "@" + m.requires[modPath])
+	if err != nil {
+		return "", err
+	}
+	return isDir(filepath.Join(modCache(), escaped, strings.TrimPrefix(path, modPath)))
+}
+
+func isDir(dir string) (string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	return dir, nil
+}
+
+// goRoot returns the root of the Go installation.
+func goRoot() string {
+	if root := os.Getenv("GOROOT"); root != "" {
+		return root
+	}
+	if buildContext.GOROOT != "" {
+		return buildContext.GOROOT
+	}
+	return runtime.GOROOT()
+}
+
+// modCache returns the directory of the module cache.
+func modCache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath, _, _ := strings.Cut(buildContext.GOPATH, string(filepath.ListSeparator))
+	return filepath.Join(gopath, "pkg", "mod")
+}
+
+// escapePath escapes upper-case letters like the module cache does: "A" becomes "!a".
+func escapePath(path string) (string, error) {
+	var b strings.Builder
+	for _, r := range path {
+		if r >= unicode.MaxASCII {
+			return "", fmt.Errorf("invalid module path %s", path)
+		}
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), nil
+}
+
+// position returns the file of pos relative to the working directory, its line and column.
+func (m *module) position(pos token.Pos) (string, int, int) {
+	p := m.fset.Position(pos)
+	file := p.Filename
+	if rel, err := filepath.Rel(m.root, file); err == nil && !strings.HasPrefix(rel, "..") {
+		file = filepath.ToSlash(rel)
+	}
+	return file, p.Line, p.Column
+}
@@ -0,0 +1,203 @@
+package code
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+// maxSignature is the length at which signatures, e.g. of long var initialisations, are cut.
+const maxSignature = 200
+
+// Outline returns the top-level declarations of a Go file or of the package in a directory.
+// It only parses the files, so it works on code which does not compile.
+func Outline(ctx context.Context, args OutlineArgs) (OutlineResult, error) {
+	root, err := filesystem.ResolvePath(ctx, ".")
+	if err != nil {
+		return OutlineResult{}, err
+	}
+	path, err := filesystem.ResolvePath(ctx, args.Path)
+	if err != nil {
+		return OutlineResult{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return OutlineResult{}, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return OutlineResult{}, err
+		}
+		files = nil
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasPrefix(name, ".") {
+				continue
+			}
+			if strings.HasSuffix(name, "_test.go") && !args.IncludeTests {
+				continue
+			}
+			files = append(files, filepath.Join(path, name))
+		}
+		if len(files) == 0 {
+			return OutlineResult{}, fmt.Errorf("no Go files in %s", args.Path)
+		}
+	} else if !strings.HasSuffix(path, ".go") {
+		return OutlineResult{}, fmt.Errorf("%s is not a Go file", args.Path)
+	}
+
+	fset := token.NewFileSet()
+	result := OutlineResult{Declarations: []Declaration{}}
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if f == nil {
+			return OutlineResult{}, err
+		}
+		// The external test package does not name the directory's package
+		if result.Package == "" || strings.HasSuffix(result.Package, "_test") {
+			result.Package = f.Name.Name
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return OutlineResult{}, err
+		}
+		for _, d := range outlineFile(fset, f) {
+			if args.ExportedOnly && !isExported(d.Name) {
+				continue
+			}
+			d.File = filepath.ToSlash(rel)
+			result.Declarations = append(result.Declarations, d)
+		}
+	}
+	return result, nil
+}
+
+// isExported reports whether a declaration and, for methods, its receiver type are exported.
+func isExported(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if !ast.IsExported(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// outlineFile returns the declarations of f in source order.
+func outlineFile(fset *token.FileSet, f *ast.File) []Declaration {
+	var decls []Declaration
+	add := func(name, kind string, node ast.Node, doc *ast.CommentGroup, signature string) {
+		start := node.Pos()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		decls = append(decls, Declaration{
+			Name:      name,
+			Kind:      kind,
+			Signature: shorten(signature),
+			Line:      fset.Position(start).Line,
+			EndLine:   fset.Position(node.End()).Line,
+			Doc:       strings.TrimSpace(doc.Text()),
+		})
+	}
+
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			name, kind := decl.Name.Name, "func"
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				name, kind = receiverName(decl.Recv.List[0].Type)+"."+name, "method"
+			}
+			signature := *decl
+			signature.Doc, signature.Body = nil, nil
+			add(name, kind, decl, decl.Doc, render(fset, &signature))
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				// A doc comment of an ungrouped declaration belongs to the declaration
+				node, doc := ast.Node(spec), decl.Doc
+				if decl.Lparen.IsValid() {
+					doc = nil
+				} else {
+					node = decl
+				}
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					add(spec.Name.Name, "type", node, cmp.Or(spec.Doc, doc), "type "+typeSignature(fset, spec))
+				case *ast.ValueSpec:
+					s := *spec
+					s.Doc, s.Comment = nil, nil
+					for _, name := range spec.Names {
+						add(name.Name, decl.Tok.String(), node, cmp.Or(spec.Doc, doc), decl.Tok.String()+" "+render(fset, &s))
+					}
+				}
+			}
+		}
+	}
+	return decls
+}
+
+// receiverName returns the type name of a method receiver, without pointer and type parameters.
+func receiverName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return "?"
+		}
+	}
+}
+
+// typeSignature renders a type spec; the members of struct and interface types are left out.
+func typeSignature(fset *token.FileSet, spec *ast.TypeSpec) string {
+	s := *spec
+	s.Doc, s.Comment = nil, nil
+	switch spec.Type.(type) {
+	case *ast.StructType:
+		s.Type = &ast.StructType{Fields: &ast.FieldList{}}
+		return strings.TrimSuffix(render(fset, &s), " { }")
+	case *ast.InterfaceType:
+		s.Type = &ast.InterfaceType{Methods: &ast.FieldList{}}
+		return strings.TrimSuffix(render(fset, &s), " { }")
+	}
+	return render(fset, &s)
+}
+
+// render prints node on a single line.
+func render(fset *token.FileSet, node any) string {
+	var b strings.Builder
+	if err := (&printer.Config{Mode: printer.RawFormat}).Fprint(&b, fset, node); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// shorten cuts s to [maxSignature] bytes.
+func shorten(s string) string {
+	if len(s) <= maxSignature {
+		return s
+	}
+	return strings.ToValidUTF8(s[:maxSignature], "") + "…"
+}
@@ -0,0 +1,307 @@
+package code
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"os"
+	"slices"
+	"strings"
+)
+
+// maxReferences is the number of references, callers or callees returned at most.
+const maxReferences = 500
+
+// resolve loads the module of directory and returns the only definition matching name.
+func resolve(ctx context.Context, name, directory string) (*module, Symbol, types.Object, error) {
+	query, err := parseQuery(name)
+	if err != nil {
+		return nil, Symbol{}, nil, err
+	}
+	m, err := loadModule(ctx, directory)
+	if err != nil {
+		return nil, Symbol{}, nil, err
+	}
+	if err := m.checkAll(ctx); err != nil {
+		return nil, Symbol{}, nil, err
+	}
+	symbols, objects, _ := m.find(query)
+	switch {
+	case len(symbols) == 0:
+		return nil, Symbol{}, nil, fmt.Errorf("no definition of '%s' found in the module", name)
+	case len(symbols) > 1:
+		var names []string
+		for _, s := range symbols {
+			names = append(names, s.Name)
+		}
+		return nil, Symbol{}, nil, fmt.Errorf("'%s' is ambiguous, qualify it as one of %s", name, strings.Join(names, ", "))
+	}
+	return m, symbols[0], objects[0], nil
+}
+
+// origin returns the generic object an instantiated function or field stems from.
+func origin(obj types.Object) types.Object {
+	switch obj := obj.(type) {
+	case *types.Func:
+		return obj.Origin()
+	case *types.Var:
+		return obj.Origin()
+	}
+	return obj
+}
+
+// funcName returns the qualified name of a function or method, like pkg.Type.Method.
+func funcName(fn *types.Func) string {
+	name := fn.Name()
+	if sig, ok := fn.Type().(*types.Signature); ok && sig.Recv() != nil {
+		t := sig.Recv().Type()
+		if ptr, ok := t.(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		if named, ok := t.(*types.Named); ok {
+			name = named.Obj().Name() + "." + name
+		}
+	}
+	if fn.Pkg() == nil {
+		return name
+	}
+	return fn.Pkg().Name() + "." + name
+}
+
+// sourceLines reads the lines of files, caching them by name.
+type sourceLines map[string][]string
+
+func (s sourceLines) line(file string, n int) string {
+	lines, ok := s[file]
+	if !ok {
+		data, _ := os.ReadFile(file)
+		lines = strings.Split(string(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))), "\n")
+		s[file] = lines
+	}
+	if n < 1 || n > len(lines) {
+		return ""
+	}
+	return shorten(strings.TrimSpace(lines[n-1]))
+}
+
+// enclosing returns the function declaration of f containing ident, nil at package level.
+func enclosing(f *ast.File, ident *ast.Ident) *ast.FuncDecl {
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Pos() <= ident.Pos() && ident.End() <= fn.End() {
+			return fn
+		}
+	}
+	return nil
+}
+
+// declName returns the qualified name of a function declaration of p.
+func declName(p *Package, fn *ast.FuncDecl) string {
+	if fn == nil {
+		return ""
+	}
+	if fn.Recv != nil && len(fn.Recv.List) > 0 {
+		return p.Name + "." + receiverName(fn.Recv.List[0].Type) + "." + fn.Name.Name
+	}
+	return p.Name + "." + fn.Name.Name
+}
+
+// callees returns the identifiers of f in the function position of a call.
+func callees(f *ast.File) map[*ast.Ident]bool {
+	idents := make(map[*ast.Ident]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if ident := calledIdent(call.Fun); ident != nil {
+				idents[ident] = true
+			}
+		}
+		return true
+	})
+	return idents
+}
+
+// calledIdent returns the identifier naming the function of a call expression, if any.
+func calledIdent(fun ast.Expr) *ast.Ident {
+	for {
+		switch e := fun.(type) {
+		case *ast.ParenExpr:
+			fun = e.X
+		case *ast.IndexExpr:
+			fun = e.X
+		case *ast.IndexListExpr:
+			fun = e.X
+		case *ast.SelectorExpr:
+			return e.Sel
+		case *ast.Ident:
+			return e
+		default:
+			return nil
+		}
+	}
+}
+
+// uses calls yield for every use of obj in the module, in the order of packages and files.
+func (m *module) uses(obj types.Object, yield func(p *Package, f *ast.File, ident *ast.Ident) bool) {
+	obj = origin(obj)
+	for _, p := range m.sorted() {
+		if p.Info == nil {
+			continue
+		}
+		for _, f := range p.Files {
+			var idents []*ast.Ident
+			ast.Inspect(f, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Ident); ok {
+					if used, ok := p.Info.Uses[ident]; ok && origin(used) == obj {
+						idents = append(idents, ident)
+					}
+				}
+				return true
+			})
+			for _, ident := range idents {
+				if !yield(p, f, ident) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// reference describes the use of an identifier.
+func (m *module) reference(lines sourceLines, p *Package, f *ast.File, ident *ast.Ident) Reference {
+	file, line, column := m.position(ident.Pos())
+	return Reference{
+		File:     file,
+		Line:     line,
+		Column:   column,
+		Function: declName(p, enclosing(f, ident)),
+		Text:     lines.line(m.fset.Position(ident.Pos()).Filename, line),
+	}
+}
+
+// References returns every use of a symbol in the module with its enclosing function.
+func References(ctx context.Context, args ReferencesArgs) (ReferencesResult, error) {
+	m, symbol, obj, err := resolve(ctx, args.Name, args.Directory)
+	if err != nil {
+		return ReferencesResult{}, err
+	}
+	result := ReferencesResult{Symbol: symbol, References: []Reference{}}
+	lines := make(sourceLines)
+	m.uses(obj, func(p *Package, f *ast.File, ident *ast.Ident) bool {
+		if len(result.References) == maxReferences {
+			result.Truncated = true
+			return false
+		}
+		result.References = append(result.References, m.reference(lines, p, f, ident))
+		return true
+	})
+	return result, nil
+}
+
+// Callers returns the calls of a function or method in the module. Calls through
+// interfaces and function values are not found.
+func Callers(ctx context.Context, args CallHierarchyArgs) (CallersResult, error) {
+	m, symbol, obj, err := resolve(ctx, args.Name, args.Directory)
+	if err != nil {
+		return CallersResult{}, err
+	}
+	if _, ok := obj.(*types.Func); !ok {
+		return CallersResult{}, fmt.Errorf("%s is a %s, not a function or method", symbol.Name, symbol.Kind)
+	}
+	result := CallersResult{Symbol: symbol, Calls: []Reference{}}
+	lines := make(sourceLines)
+	calls := make(map[*ast.File]map[*ast.Ident]bool)
+	m.uses(obj, func(p *Package, f *ast.File, ident *ast.Ident) bool {
+		if calls[f] == nil {
+			calls[f] = callees(f)
+		}
+		if !calls[f][ident] {
+			return true
+		}
+		if len(result.Calls) == maxReferences {
+			result.Truncated = true
+			return false
+		}
+		result.Calls = append(result.Calls, m.reference(lines, p, f, ident))
+		return true
+	})
+	return result, nil
+}
+
+// Callees returns the functions and methods called by the body of a function or method.
+func Callees(ctx context.Context, args CallHierarchyArgs) (CalleesResult, error) {
+	m, symbol, obj, err := resolve(ctx, args.Name, args.Directory)
+	if err != nil {
+		return CalleesResult{}, err
+	}
+	if _, ok := obj.(*types.Func); !ok {
+		return CalleesResult{}, fmt.Errorf("%s is a %s, not a function or method", symbol.Name, symbol.Kind)
+	}
+
+	// The declaration is the function whose name defines obj
+	var decl *ast.FuncDecl
+	var pkg *Package
+	for _, p := range m.sorted() {
+		for _, f := range p.Files {
+			for _, d := range f.Decls {
+				if fn, ok := d.(*ast.FuncDecl); ok && p.Info != nil && p.Info.Defs[fn.Name] == obj {
+					decl, pkg = fn, p
+				}
+			}
+		}
+	}
+	result := CalleesResult{Symbol: symbol, Calls: []Call{}}
+	if decl == nil || decl.Body == nil {
+		return result, nil
+	}
+
+	// Outer calls are visited before the calls in their receiver, so sort them by position
+	var idents []*ast.Ident
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if ident := calledIdent(call.Fun); ident != nil {
+				idents = append(idents, ident)
+			}
+		}
+		return true
+	})
+	slices.SortFunc(idents, func(a, b *ast.Ident) int { return int(a.Pos() - b.Pos()) })
+
+	lines := make(sourceLines)
+	for _, ident := range idents {
+		fn, ok := pkg.Info.Uses[ident].(*types.Func)
+		if !ok {
+			continue
+		}
+		if len(result.Calls) == maxReferences {
+			result.Truncated = true
+			break
+		}
+		fn = fn.Origin()
+		file, line, column := m.position(ident.Pos())
+		c := Call{
+			Name:    funcName(fn),
+			File:    file,
+			Line:    line,
+			Column:  column,
+			Text:    lines.line(m.fset.Position(ident.Pos()).Filename, line),
+			Dynamic: isInterfaceMethod(fn),
+		}
+		if fn.Pkg() != nil {
+			c.Package = fn.Pkg().Path()
+			// Only definitions inside the module have a position worth reporting
+			if _, ok := m.packages[c.Package]; ok {
+				c.DefinitionFile, c.DefinitionLine, _ = m.position(fn.Pos())
+			}
+		}
+		result.Calls = append(result.Calls, c)
+	}
+	return result, nil
+}
+
+// isInterfaceMethod reports whether fn is a method of an interface, so the called
+// implementation is only known at run time.
+func isInterfaceMethod(fn *types.Func) bool {
+	sig, ok := fn.Type().(*types.Signature)
+	return ok && sig.Recv() != nil && types.IsInterface(sig.Recv().Type())
+}
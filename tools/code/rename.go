@@ -0,0 +1,309 @@
+package code
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/seb-schulz/mcpilot-pair/internal/textdiff"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+// maxRenameErrors is the number of type errors reported for a refused rename.
+const maxRenameErrors = 10
+
+// Rename renames a symbol with its definition and all uses in the module, including
+// tests. The renamed module is type-checked before any file is written: renames which
+// introduce type errors or which would make an identifier refer to another declaration
+// are refused, as are renames of names found in files excluded by build constraints.
+// Without args.Apply only the diff is returned.
+func Rename(ctx context.Context, args RenameArgs) (RenameResult, error) {
+	if !token.IsIdentifier(args.NewName) || args.NewName == "_" {
+		return RenameResult{}, fmt.Errorf("invalid new name '%s', use a Go identifier", args.NewName)
+	}
+	m, symbol, obj, err := resolve(ctx, args.Name, args.Directory)
+	if err != nil {
+		return RenameResult{}, err
+	}
+	if obj.Name() == args.NewName {
+		return RenameResult{}, fmt.Errorf("%s is already named %s", symbol.Name, args.NewName)
+	}
+
+	idents := m.occurrences(obj)
+	if err := m.conflicts(obj, symbol, idents, args.NewName); err != nil {
+		return RenameResult{}, err
+	}
+	if err := m.checkExcluded(obj); err != nil {
+		return RenameResult{}, err
+	}
+	originals, changes, err := m.rewrite(idents, obj.Name(), args.NewName)
+	if err != nil {
+		return RenameResult{}, err
+	}
+	if err := m.verify(ctx, changes); err != nil {
+		return RenameResult{}, err
+	}
+
+	result := RenameResult{Symbol: symbol, Files: []string{}}
+	var diff strings.Builder
+	for _, file := range slices.Sorted(maps.Keys(changes)) {
+		rel, _, _ := m.position(idents[file][0].Pos())
+		result.Files = append(result.Files, rel)
+		result.Edits += len(idents[file])
+		diff.WriteString(textdiff.Unified("a/"+rel, "b/"+rel, string(originals[file]), string(changes[file])))
+	}
+	result.Diff = diff.String()
+	if !args.Apply {
+		return result, nil
+	}
+	if err := filesystem.ReplaceFiles(originals, changes); err != nil {
+		return RenameResult{}, err
+	}
+	result.Applied = true
+	return result, nil
+}
+
+// PreviewRename returns the unified diff Rename would apply for args.
+func PreviewRename(ctx context.Context, args RenameArgs) (string, error) {
+	args.Apply = false
+	result, err := Rename(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Rename %s to %s in %d places:\n\n%s", result.Symbol.Name, args.NewName, result.Edits, result.Diff), nil
+}
+
+// occurrences returns the identifiers naming obj by file: its definition and all uses.
+// Renaming a type also renames the fields embedding it.
+func (m *module) occurrences(obj types.Object) map[string][]*ast.Ident {
+	obj = origin(obj)
+	seen := make(map[token.Pos]bool)
+	idents := make(map[string][]*ast.Ident)
+	add := func(ident *ast.Ident) {
+		if !seen[ident.Pos()] {
+			seen[ident.Pos()] = true
+			file := m.fset.Position(ident.Pos()).Filename
+			idents[file] = append(idents[file], ident)
+		}
+	}
+	var embedded []types.Object
+	for _, p := range m.sorted() {
+		if p.Info == nil {
+			continue
+		}
+		for ident, def := range p.Info.Defs {
+			if def == nil {
+				continue
+			}
+			if origin(def) == obj {
+				add(ident)
+			}
+			if v, ok := def.(*types.Var); ok && v.Embedded() && embeds(v, obj) {
+				embedded = append(embedded, v)
+			}
+		}
+	}
+	for _, target := range append([]types.Object{obj}, embedded...) {
+		m.uses(target, func(p *Package, f *ast.File, ident *ast.Ident) bool {
+			add(ident)
+			return true
+		})
+	}
+	return idents
+}
+
+// embeds reports whether the embedded field v is of the type named by obj.
+func embeds(v *types.Var, obj types.Object) bool {
+	t := v.Type()
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	return ok && named.Origin().Obj() == obj
+}
+
+// conflicts checks that newName is not declared next to obj yet and that no use of obj
+// would refer to a declaration in an inner scope after the rename.
+func (m *module) conflicts(obj types.Object, symbol Symbol, idents map[string][]*ast.Ident, newName string) error {
+	pkg := obj.Pkg()
+	if pkg == nil {
+		return fmt.Errorf("%s cannot be renamed", symbol.Name)
+	}
+	if parts := strings.Split(symbol.Name, "."); len(parts) == 3 {
+		// Methods and fields share the method set of their type
+		tn, ok := pkg.Scope().Lookup(parts[1]).(*types.TypeName)
+		if !ok {
+			return fmt.Errorf("%s cannot be renamed", symbol.Name)
+		}
+		if other, _, _ := types.LookupFieldOrMethod(tn.Type(), true, pkg, newName); other != nil {
+			return fmt.Errorf("%s.%s already has a %s %s", parts[0], parts[1], kind(other), newName)
+		}
+		return nil
+	}
+
+	if other := pkg.Scope().Lookup(newName); other != nil {
+		file, line, _ := m.position(other.Pos())
+		return fmt.Errorf("package %s already declares %s at %s:%d", pkg.Name(), newName, file, line)
+	}
+	for _, list := range idents {
+		for _, ident := range list {
+			// The definition was checked against the package scope, the name of a function
+			// is inside the scope of its parameters though
+			if ident.Pos() == obj.Pos() {
+				continue
+			}
+			// Other packages refer to obj qualified by the package name, their files are
+			// not in the scope of pkg
+			scope := pkg.Scope().Innermost(ident.Pos())
+			if scope == nil {
+				continue
+			}
+			// Shadowing predeclared identifiers is allowed, the type check catches broken uses
+			if _, other := scope.LookupParent(newName, ident.Pos()); other != nil && other.Parent() != pkg.Scope() && other.Parent() != types.Universe {
+				file, line, _ := m.position(ident.Pos())
+				otherFile, otherLine, _ := m.position(other.Pos())
+				return fmt.Errorf("the use of %s at %s:%d would refer to %s declared at %s:%d", obj.Name(), file, line, newName, otherFile, otherLine)
+			}
+		}
+	}
+	return nil
+}
+
+// checkExcluded refuses the rename if a file which is not parsed, as build constraints
+// exclude it or it uses cgo, contains the name of obj: its uses would be left unrenamed.
+// Unexported names are only looked for in the files of their package.
+func (m *module) checkExcluded(obj types.Object) error {
+	var dir string
+	if !obj.Exported() {
+		if p, ok := m.packages[obj.Pkg().Path()]; ok {
+			dir = p.Dir
+		}
+	}
+	for _, file := range m.excluded {
+		if dir != "" && filepath.Dir(file) != dir {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if !mentions(data, obj.Name()) {
+			continue
+		}
+		rel := file
+		if r, err := filepath.Rel(m.root, file); err == nil && !strings.HasPrefix(r, "..") {
+			rel = filepath.ToSlash(r)
+		}
+		return fmt.Errorf("%s mentions %s, but is not type-checked as build constraints exclude it on %s/%s or it uses cgo; rename it by hand, no files were changed", rel, obj.Name(), buildContext.GOOS, buildContext.GOARCH)
+	}
+	return nil
+}
+
+// mentions reports whether the Go source src contains the identifier name.
+func mentions(src []byte, name string) bool {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(src)), src, nil, 0)
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return false
+		}
+		if tok == token.IDENT && lit == name {
+			return true
+		}
+	}
+}
+
+// rewrite returns the original and the renamed content of the files containing idents.
+func (m *module) rewrite(idents map[string][]*ast.Ident, oldName, newName string) (map[string][]byte, map[string][]byte, error) {
+	originals := make(map[string][]byte)
+	changes := make(map[string][]byte)
+	for file, list := range idents {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		offsets := make([]int, 0, len(list))
+		for _, ident := range list {
+			offsets = append(offsets, m.fset.Position(ident.Pos()).Offset)
+		}
+		slices.Sort(offsets)
+
+		var b bytes.Buffer
+		last := 0
+		for _, offset := range offsets {
+			if offset+len(oldName) > len(data) || string(data[offset:offset+len(oldName)]) != oldName {
+				rel, _, _ := m.position(list[0].Pos())
+				return nil, nil, fmt.Errorf("%s changed while renaming, try again", rel)
+			}
+			b.Write(data[last:offset])
+			b.WriteString(newName)
+			last = offset + len(oldName)
+		}
+		b.Write(data[last:])
+		originals[file] = data
+		changes[file] = b.Bytes()
+	}
+	return originals, changes, nil
+}
+
+// verify type-checks the module with the changed files and fails if there are type
+// errors which did not exist before.
+func (m *module) verify(ctx context.Context, changes map[string][]byte) error {
+	renamed := &module{
+		root:     m.root,
+		dir:      m.dir,
+		path:     m.path,
+		requires: m.requires,
+		fset:     token.NewFileSet(),
+		packages: make(map[string]*Package),
+		overlay:  changes,
+	}
+	dirs := make(map[string]bool)
+	for _, p := range m.packages {
+		if !dirs[p.Dir] {
+			dirs[p.Dir] = true
+			if err := renamed.parseDir(p.Dir); err != nil {
+				return err
+			}
+		}
+	}
+	if err := renamed.checkAll(ctx); err != nil {
+		return err
+	}
+
+	// Errors are compared by message, positions shift with the rename
+	existing := make(map[string]int)
+	for _, p := range m.packages {
+		for _, e := range p.Errors {
+			existing[e.Msg]++
+		}
+	}
+	var errs []string
+	for _, p := range renamed.sorted() {
+		for _, e := range p.Errors {
+			if existing[e.Msg] > 0 {
+				existing[e.Msg]--
+				continue
+			}
+			if len(errs) < maxRenameErrors {
+				file, line, column := renamed.position(e.Pos)
+				errs = append(errs, fmt.Sprintf("%s:%d:%d: %s", file, line, column, e.Msg))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("the rename would break the type check, no files were changed:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
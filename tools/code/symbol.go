@@ -0,0 +1,192 @@
+package code
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+	"strings"
+)
+
+// maxSymbols is the number of definitions code_find_symbol returns at most.
+const maxSymbols = 50
+
+// FindSymbol locates the definitions of an identifier in the module containing the directory.
+// Package-level declarations, methods and struct fields are searched.
+func FindSymbol(ctx context.Context, args FindSymbolArgs) (FindSymbolResult, error) {
+	query, err := parseQuery(args.Name)
+	if err != nil {
+		return FindSymbolResult{}, err
+	}
+	m, err := loadModule(ctx, args.Directory)
+	if err != nil {
+		return FindSymbolResult{}, err
+	}
+	if err := m.checkAll(ctx); err != nil {
+		return FindSymbolResult{}, err
+	}
+	symbols, _, truncated := m.find(query)
+	return FindSymbolResult{Symbols: symbols, Truncated: truncated}, nil
+}
+
+// parseQuery splits a possibly qualified name into its parts.
+func parseQuery(name string) ([]string, error) {
+	query := strings.Split(name, ".")
+	if name == "" || slices.Contains(query, "") || len(query) > 3 {
+		return nil, fmt.Errorf("invalid name '%s', use Name, Type.Method or pkg.Type.Method", name)
+	}
+	return query, nil
+}
+
+// find returns up to [maxSymbols] definitions matching query and their objects.
+func (m *module) find(query []string) ([]Symbol, []types.Object, bool) {
+	symbols := []Symbol{}
+	var objects []types.Object
+	truncated := false
+	for _, p := range m.sorted() {
+		docs := docComments(p.Files)
+		m.definitions(p, func(name []string, obj types.Object) bool {
+			if !matches(query, name) {
+				return true
+			}
+			if len(symbols) == maxSymbols {
+				truncated = true
+				return false
+			}
+			symbols = append(symbols, m.symbol(p, name, obj, docs[obj.Pos()]))
+			objects = append(objects, obj)
+			return true
+		})
+		if truncated {
+			break
+		}
+	}
+	return symbols, objects, truncated
+}
+
+// matches reports whether query equals the trailing parts of the qualified name.
+func matches(query, name []string) bool {
+	return len(query) <= len(name) && slices.Equal(query, name[len(name)-len(query):])
+}
+
+// definitions calls yield with the qualified name of every package-level object, method and
+// struct field of p, like ["pkg", "Type", "Method"], until it returns false.
+func (m *module) definitions(p *Package, yield func(name []string, obj types.Object) bool) {
+	if p.Types == nil {
+		return
+	}
+	scope := p.Types.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !yield([]string{p.Name, name}, obj) {
+			return
+		}
+		tn, ok := obj.(*types.TypeName)
+		if !ok || tn.IsAlias() {
+			continue
+		}
+		named, ok := tn.Type().(*types.Named)
+		if !ok {
+			continue
+		}
+		for i := range named.NumMethods() {
+			method := named.Method(i)
+			if !yield([]string{p.Name, name, method.Name()}, method) {
+				return
+			}
+		}
+		switch u := named.Underlying().(type) {
+		case *types.Struct:
+			for i := range u.NumFields() {
+				if !yield([]string{p.Name, name, u.Field(i).Name()}, u.Field(i)) {
+					return
+				}
+			}
+		case *types.Interface:
+			for i := range u.NumExplicitMethods() {
+				if !yield([]string{p.Name, name, u.ExplicitMethod(i).Name()}, u.ExplicitMethod(i)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// symbol describes the definition of obj.
+func (m *module) symbol(p *Package, name []string, obj types.Object, doc string) Symbol {
+	file, line, column := m.position(obj.Pos())
+	return Symbol{
+		Name:      strings.Join(name, "."),
+		Kind:      kind(obj),
+		Package:   p.Path,
+		Signature: shorten(types.ObjectString(obj, types.RelativeTo(p.Types))),
+		File:      file,
+		Line:      line,
+		Column:    column,
+		Doc:       doc,
+	}
+}
+
+// kind returns the kind of obj as reported by the code tools.
+func kind(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.Func:
+		if sig, ok := obj.Type().(*types.Signature); ok && sig.Recv() != nil {
+			return "method"
+		}
+		return "func"
+	case *types.TypeName:
+		return "type"
+	case *types.Const:
+		return "const"
+	case *types.Var:
+		if obj.IsField() {
+			return "field"
+		}
+		return "var"
+	}
+	return "other"
+}
+
+// docComments maps the positions of declared names to their doc comments.
+func docComments(files []*ast.File) map[token.Pos]string {
+	docs := make(map[token.Pos]string)
+	add := func(idents []*ast.Ident, groups ...*ast.CommentGroup) {
+		for _, g := range groups {
+			if text := strings.TrimSpace(g.Text()); text != "" {
+				for _, ident := range idents {
+					docs[ident.Pos()] = text
+				}
+				return
+			}
+		}
+	}
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				add([]*ast.Ident{n.Name}, n.Doc)
+				return false
+			case *ast.GenDecl:
+				for _, spec := range n.Specs {
+					var doc *ast.CommentGroup
+					if !n.Lparen.IsValid() {
+						doc = n.Doc
+					}
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						add([]*ast.Ident{spec.Name}, spec.Doc, doc)
+					case *ast.ValueSpec:
+						add(spec.Names, spec.Doc, doc)
+					}
+				}
+			case *ast.Field:
+				add(n.Names, n.Doc, n.Comment)
+			}
+			return true
+		})
+	}
+	return docs
+}
@@ -0,0 +1,121 @@
+package code
+
+// OutlineArgs are the arguments for the code_outline tool.
+type OutlineArgs struct {
+	Path         string `json:"path" jsonschema:"the relative path of a Go file, or of a directory to outline its package"`
+	IncludeTests bool   `json:"include_tests,omitempty" jsonschema:"include the _test.go files of a directory"`
+	ExportedOnly bool   `json:"exported_only,omitempty" jsonschema:"only list exported declarations and methods"`
+}
+
+// Declaration is a top-level declaration of a file.
+type Declaration struct {
+	Name      string `json:"name" jsonschema:"the name; methods are named Type.Method"`
+	Kind      string `json:"kind" jsonschema:"func, method, type, const or var"`
+	Signature string `json:"signature" jsonschema:"the declaration without body; struct and interface types without their members"`
+	File      string `json:"file" jsonschema:"the file relative to the working directory"`
+	Line      int    `json:"line" jsonschema:"the first line of the declaration, including its doc comment"`
+	EndLine   int    `json:"end_line" jsonschema:"the last line of the declaration"`
+	Doc       string `json:"doc,omitempty" jsonschema:"the doc comment"`
+}
+
+// OutlineResult is the result of the code_outline tool.
+type OutlineResult struct {
+	Package      string        `json:"package" jsonschema:"the package name"`
+	Declarations []Declaration `json:"declarations" jsonschema:"the declarations in source order, file by file"`
+}
+
+// FindSymbolArgs are the arguments for the code_find_symbol tool.
+type FindSymbolArgs struct {
+	Name      string `json:"name" jsonschema:"the identifier to look up, optionally qualified: Name, Type.Method, Type.Field, pkg.Name or pkg.Type.Method"`
+	Directory string `json:"directory,omitempty" jsonschema:"a relative directory inside the module to search (default the working directory); the whole module is searched"`
+}
+
+// Symbol is the definition of an identifier.
+type Symbol struct {
+	Name      string `json:"name" jsonschema:"the qualified name, e.g. filesystem.ReadFile or git.Runner.Commit"`
+	Kind      string `json:"kind" jsonschema:"func, method, type, const, var or field"`
+	Package   string `json:"package" jsonschema:"the import path of the package"`
+	Signature string `json:"signature" jsonschema:"the type or signature of the symbol"`
+	File      string `json:"file" jsonschema:"the file relative to the working directory"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	Doc       string `json:"doc,omitempty" jsonschema:"the doc comment"`
+}
+
+// FindSymbolResult is the result of the code_find_symbol tool.
+type FindSymbolResult struct {
+	Symbols   []Symbol `json:"symbols" jsonschema:"the matching definitions"`
+	Truncated bool     `json:"truncated,omitempty" jsonschema:"indicates whether there are more matches; qualify the name"`
+}
+
+// ReferencesArgs are the arguments for the code_references tool.
+type ReferencesArgs struct {
+	Name      string `json:"name" jsonschema:"the symbol, qualified as needed to be unique: Name, Type.Method, Type.Field, pkg.Name or pkg.Type.Method"`
+	Directory string `json:"directory,omitempty" jsonschema:"a relative directory inside the module (default the working directory); the whole module is searched"`
+}
+
+// Reference is the use of a symbol.
+type Reference struct {
+	File     string `json:"file" jsonschema:"the file relative to the working directory"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Function string `json:"function,omitempty" jsonschema:"the enclosing function, e.g. pkg.Type.Method; empty at package level"`
+	Text     string `json:"text" jsonschema:"the source line"`
+}
+
+// ReferencesResult is the result of the code_references tool.
+type ReferencesResult struct {
+	Symbol     Symbol      `json:"symbol" jsonschema:"the definition of the symbol"`
+	References []Reference `json:"references" jsonschema:"the uses of the symbol, not including its definition"`
+	Truncated  bool        `json:"truncated,omitempty" jsonschema:"indicates whether there are more than 500 references"`
+}
+
+// CallHierarchyArgs are the arguments for the code_callers and code_callees tools.
+type CallHierarchyArgs struct {
+	Name      string `json:"name" jsonschema:"the function or method, qualified as needed to be unique: Func, Type.Method, pkg.Func or pkg.Type.Method"`
+	Directory string `json:"directory,omitempty" jsonschema:"a relative directory inside the module (default the working directory); the whole module is searched"`
+}
+
+// CallersResult is the result of the code_callers tool.
+type CallersResult struct {
+	Symbol    Symbol      `json:"symbol" jsonschema:"the definition of the function"`
+	Calls     []Reference `json:"calls" jsonschema:"the call sites with their enclosing function"`
+	Truncated bool        `json:"truncated,omitempty" jsonschema:"indicates whether there are more than 500 calls"`
+}
+
+// Call is a call made by a function.
+type Call struct {
+	Name           string `json:"name" jsonschema:"the called function, e.g. fmt.Println or pkg.Type.Method"`
+	Package        string `json:"package,omitempty" jsonschema:"the import path of the called function"`
+	File           string `json:"file" jsonschema:"the file of the call relative to the working directory"`
+	Line           int    `json:"line"`
+	Column         int    `json:"column"`
+	Text           string `json:"text" jsonschema:"the source line of the call"`
+	Dynamic        bool   `json:"dynamic,omitempty" jsonschema:"indicates a call of an interface method, whose implementation is chosen at run time"`
+	DefinitionFile string `json:"definition_file,omitempty" jsonschema:"the file defining the called function, if it is in the module"`
+	DefinitionLine int    `json:"definition_line,omitempty"`
+}
+
+// CalleesResult is the result of the code_callees tool.
+type CalleesResult struct {
+	Symbol    Symbol `json:"symbol" jsonschema:"the definition of the function"`
+	Calls     []Call `json:"calls" jsonschema:"the calls in the body of the function in source order"`
+	Truncated bool   `json:"truncated,omitempty" jsonschema:"indicates whether there are more than 500 calls"`
+}
+
+// RenameArgs are the arguments for the code_rename tool.
+type RenameArgs struct {
+	Name      string `json:"name" jsonschema:"the symbol to rename, qualified as needed to be unique: Name, Type.Method, Type.Field, pkg.Name or pkg.Type.Method"`
+	NewName   string `json:"new_name" jsonschema:"the new identifier, without qualification"`
+	Directory string `json:"directory,omitempty" jsonschema:"a relative directory inside the module (default the working directory); the whole module is renamed"`
+	Apply     bool   `json:"apply,omitempty" jsonschema:"write the changes; by default only the diff is returned"`
+}
+
+// RenameResult is the result of the code_rename tool.
+type RenameResult struct {
+	Symbol  Symbol   `json:"symbol" jsonschema:"the definition of the symbol before the rename"`
+	Files   []string `json:"files" jsonschema:"the changed files relative to the working directory"`
+	Edits   int      `json:"edits" jsonschema:"the number of renamed identifiers"`
+	Diff    string   `json:"diff" jsonschema:"the unified diff of the rename"`
+	Applied bool     `json:"applied" jsonschema:"indicates whether the files were written"`
+}
@@ -0,0 +1,106 @@
+// Package command runs executables permitted by a policy, giving projects
+// without a Makefile a safe way to run their tools.
+package command
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/seb-schulz/mcpilot-pair/internal/runner"
+	"github.com/seb-schulz/mcpilot-pair/internal/sandbox"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+// DefaultTimeout is the time a command may take unless configured otherwise.
+const DefaultTimeout = 10 * time.Minute
+
+// Runner runs commands permitted by its policy.
+type Runner struct {
+	Policy Policy
+	// Timeout is the maximum duration of a command. Calls may ask for a shorter one.
+	Timeout time.Duration
+	// Env decides the environment of commands.
+	Env runner.EnvPolicy
+	// Sandbox confines the commands if not nil.
+	Sandbox *sandbox.Config
+}
+
+// NewRunner returns a Runner enforcing policy with the default timeout and environment.
+func NewRunner(policy Policy) *Runner {
+	return &Runner{Policy: policy, Timeout: DefaultTimeout, Env: runner.DefaultEnvPolicy()}
+}
+
+// Run executes args.Command directly, without a shell, in a directory confined to the working directory.
+// The command has to be allowed by the policy. It is killed with all its child processes when the
+// timeout expires or ctx is cancelled. If output is not nil, it receives each line while the command is running.
+func (r *Runner) Run(ctx context.Context, args RunArgs, output func(stream, line string)) (RunResult, error) {
+	if len(args.Command) == 0 {
+		return RunResult{}, fmt.Errorf("empty command")
+	}
+	if !r.Policy.Allowed(args.Command) {
+		return RunResult{}, fmt.Errorf("command '%s' is not allowed, allowed commands: %s", strings.Join(args.Command, " "), r.Policy.String())
+	}
+	dir, err := filesystem.ResolveDirectory(ctx, args.Directory)
+	if err != nil {
+		return RunResult{}, err
+	}
+
+	env, err := r.Env.Environ(os.Environ(), args.Env)
+	if err != nil {
+		return RunResult{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout(args.TimeoutSeconds))
+	defer cancel()
+
+	cmd := runner.Command(ctx, args.Command[0], args.Command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	if err := r.Sandbox.Wrap(cmd); err != nil {
+		return RunResult{}, err
+	}
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
+	flush := func() {}
+	if output != nil {
+		stdoutLines := runner.NewLineWriter(func(line string) { output("stdout", line) })
+		stderrLines := runner.NewLineWriter(func(line string) { output("stderr", line) })
+		cmd.Stdout = io.MultiWriter(&stdoutBuf, stdoutLines)
+		cmd.Stderr = io.MultiWriter(&stderrBuf, stderrLines)
+		flush = func() {
+			stdoutLines.Flush()
+			stderrLines.Flush()
+		}
+	}
+
+	status, err := runner.Run(ctx, cmd)
+	flush()
+	if err != nil {
+		return RunResult{}, err
+	}
+	return RunResult{
+		Stdout:   stdoutBuf.String(),
+		Stderr:   stderrBuf.String(),
+		Success:  status.ExitCode == 0,
+		ExitCode: status.ExitCode,
+		TimedOut: status.TimedOut,
+		Canceled: status.Canceled,
+	}, nil
+}
+
+// timeout returns the timeout of a run, limited to the configured one.
+func (r *Runner) timeout(seconds int) time.Duration {
+	timeout := cmp.Or(r.Timeout, DefaultTimeout)
+	if requested := time.Duration(seconds) * time.Second; requested > 0 && requested < timeout {
+		return requested
+	}
+	return timeout
+}
@@ -0,0 +1,89 @@
+package command
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// setupWorkspace changes into a temporary working directory.
+func setupWorkspace(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	oldwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current working directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(oldwd) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change working directory: %v", err)
+	}
+	if err := os.Mkdir("sub", 0755); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+}
+
+func newTestRunner(t *testing.T, rules ...string) *Runner {
+	t.Helper()
+	var policy Policy
+	for _, rule := range rules {
+		if err := policy.Add(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+	return NewRunner(policy)
+}
+
+func TestRun(t *testing.T) {
+	setupWorkspace(t)
+	r := newTestRunner(t, "echo ...", "pwd", "env", "sh -c exit*")
+
+	result, err := r.Run(context.Background(), RunArgs{Command: []string{"echo", "hello", "; touch pwned", "$(touch pwned)"}}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Success || result.Stdout != "hello ; touch pwned $(touch pwned)\n" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if _, err := os.Stat("pwned"); err == nil {
+		t.Fatalf("Arguments were interpreted by a shell")
+	}
+
+	result, err = r.Run(context.Background(), RunArgs{Command: []string{"pwd"}, Directory: "sub"}, nil)
+	if err != nil || !strings.HasSuffix(strings.TrimSpace(result.Stdout), "/sub") {
+		t.Errorf("Unexpected result: %+v (%v)", result, err)
+	}
+
+	result, err = r.Run(context.Background(), RunArgs{Command: []string{"sh", "-c", "exit 3"}}, nil)
+	if err != nil || result.Success || result.ExitCode != 3 {
+		t.Errorf("Unexpected result: %+v (%v)", result, err)
+	}
+
+	// Only allowed environment variables are passed on
+	t.Setenv("MCPILOT_TEST_SECRET", "s3cr3t")
+	result, err = r.Run(context.Background(), RunArgs{Command: []string{"env"}}, nil)
+	if err != nil || strings.Contains(result.Stdout, "s3cr3t") || !strings.Contains(result.Stdout, "PATH=") {
+		t.Errorf("Unexpected environment: %+v (%v)", result, err)
+	}
+}
+
+func TestRunRejected(t *testing.T) {
+	setupWorkspace(t)
+	r := newTestRunner(t, "echo ...", "sh -c exit*")
+
+	for _, args := range []RunArgs{
+		{},
+		{Command: []string{"touch", "pwned"}},
+		{Command: []string{"sh", "-c", "touch pwned"}},
+		{Command: []string{"/bin/echo", "hi"}},
+		{Command: []string{"echo", "hi"}, Directory: ".."},
+	} {
+		if _, err := r.Run(context.Background(), args, nil); err == nil {
+			t.Errorf("Expected error for %+v", args)
+		}
+	}
+	if _, err := os.Stat("pwned"); err == nil {
+		t.Fatalf("Rejected command was executed")
+	}
+}
@@ -0,0 +1,152 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// anyArgs as last word of a rule allows any further arguments.
+const anyArgs = "..."
+
+// Rule allows an executable with arguments matching patterns, e.g. `pytest -k *`.
+// In patterns, * matches any sequence of characters and ? a single character.
+type Rule struct {
+	Executable string
+	Args       []string
+	// Variadic allows further arguments after those matched by Args.
+	Variadic bool
+}
+
+// ParseRule parses a rule like `go test ./...` or `npm run ...`. Words are separated by white space.
+func ParseRule(s string) (Rule, error) {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return Rule{}, fmt.Errorf("empty command rule")
+	}
+	if strings.ContainsAny(words[0], `/\*?`) || words[0] == anyArgs {
+		return Rule{}, fmt.Errorf("invalid executable '%s' in rule '%s': use a plain name found in PATH", words[0], s)
+	}
+	r := Rule{Executable: words[0], Args: words[1:]}
+	if n := len(r.Args); n > 0 && r.Args[n-1] == anyArgs {
+		r.Args, r.Variadic = r.Args[:n-1], true
+	}
+	return r, nil
+}
+
+func (r Rule) String() string {
+	words := append([]string{r.Executable}, r.Args...)
+	if r.Variadic {
+		words = append(words, anyArgs)
+	}
+	return strings.Join(words, " ")
+}
+
+// Match reports whether the command line argv is allowed by the rule.
+func (r Rule) Match(argv []string) bool {
+	if len(argv) == 0 || argv[0] != r.Executable {
+		return false
+	}
+	args := argv[1:]
+	if len(args) < len(r.Args) || !r.Variadic && len(args) != len(r.Args) {
+		return false
+	}
+	for i, pattern := range r.Args {
+		if !matchGlob(pattern, args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchGlob matches s against pattern, where * matches any sequence and ? any single character.
+func matchGlob(pattern, s string) bool {
+	p, str := []rune(pattern), []rune(s)
+	// Position to resume from after the last *
+	star, next := -1, 0
+	i, j := 0, 0
+	for j < len(str) {
+		switch {
+		case i < len(p) && (p[i] == '?' || p[i] == str[j]):
+			i++
+			j++
+		case i < len(p) && p[i] == '*':
+			star, next = i, j
+			i++
+		case star >= 0:
+			next++
+			i, j = star+1, next
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// Policy is the list of allowed commands. An empty policy allows nothing.
+type Policy struct {
+	Rules []Rule
+}
+
+// Allowed reports whether any rule allows argv.
+func (p Policy) Allowed(argv []string) bool {
+	for _, r := range p.Rules {
+		if r.Match(argv) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add parses and appends a rule.
+func (p *Policy) Add(s string) error {
+	r, err := ParseRule(s)
+	if err != nil {
+		return err
+	}
+	p.Rules = append(p.Rules, r)
+	return nil
+}
+
+// Load appends the rules of a file with one rule per line. Empty lines and lines starting with # are ignored.
+func (p *Policy) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return p.read(f)
+}
+
+func (p *Policy) read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := p.Add(line); err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// String lists the rules separated by semicolons.
+func (p *Policy) String() string {
+	rules := make([]string, len(p.Rules))
+	for i, r := range p.Rules {
+		rules[i] = r.String()
+	}
+	return strings.Join(rules, "; ")
+}
+
+// Set implements flag.Value, so rules can be given by a repeatable flag.
+func (p *Policy) Set(s string) error {
+	return p.Add(s)
+}
@@ -0,0 +1,59 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRuleMatch(t *testing.T) {
+	tests := []struct {
+		rule     string
+		argv     []string
+		expected bool
+	}{
+		{"npm test", []string{"npm", "test"}, true},
+		{"npm test", []string{"npm", "test", "--watch"}, false},
+		{"npm test", []string{"npm", "install"}, false},
+		{"npm test", []string{"npx", "test"}, false},
+		{"pytest -k *", []string{"pytest", "-k", "tests/test_api.py and not slow"}, true},
+		{"pytest -k *", []string{"pytest", "-k"}, false},
+		{"cargo check ...", []string{"cargo", "check"}, true},
+		{"cargo check ...", []string{"cargo", "check", "--all-targets", "-p", "core"}, true},
+		{"go test -run=Test* ./...", []string{"go", "test", "-run=TestFoo", "./..."}, true},
+		{"go test -run=Test* ./...", []string{"go", "test", "-exec=sh", "./..."}, false},
+		{"eslint src/?.js", []string{"eslint", "src/a.js"}, true},
+		{"eslint src/?.js", []string{"eslint", "src/ab.js"}, false},
+	}
+
+	for _, tc := range tests {
+		rule, err := ParseRule(tc.rule)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tc.rule, err)
+		}
+		if got := rule.Match(tc.argv); got != tc.expected {
+			t.Errorf("%q matching %q: expected %v, got %v", tc.rule, tc.argv, tc.expected, got)
+		}
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	for _, invalid := range []string{"", "   ", "/bin/sh -c *", "./run.sh", "* ...", "..."} {
+		if _, err := ParseRule(invalid); err == nil {
+			t.Errorf("Expected error for rule %q", invalid)
+		}
+	}
+}
+
+func TestPolicyRead(t *testing.T) {
+	var p Policy
+	err := p.read(strings.NewReader("# JavaScript\nnpm test\n\n  npm run lint  \ncargo check ...\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s := p.String(); s != "npm test; npm run lint; cargo check ..." {
+		t.Errorf("Unexpected rules: %s", s)
+	}
+	if err := p.read(strings.NewReader("npm test\n/bin/sh\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected error for line 2, got %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+package command
+
+// RunArgs are the arguments for the run_command tool.
+type RunArgs struct {
+	Command        []string          `json:"command" jsonschema:"the executable and its arguments, e.g. [\"npm\", \"test\"]; no shell is involved, so quoting, pipes and variables are not interpreted"`
+	Directory      string            `json:"directory,omitempty" jsonschema:"The optional relative path to run the command in. If omitted, the root directory is used"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty" jsonschema:"The optional timeout in seconds after which the command is killed. It cannot exceed the timeout configured on the server"`
+	Env            map[string]string `json:"env,omitempty" jsonschema:"the optional environment variables to set, e.g. {\"GOFLAGS\": \"-v\"}; only variables approved by the server are accepted"`
+}
+
+// RunResult is the result of the run_command tool.
+type RunResult struct {
+	Stdout   string `json:"stdout" jsonschema:"the standard output of the command"`
+	Stderr   string `json:"stderr" jsonschema:"the standard error output of the command"`
+	Success  bool   `json:"success" jsonschema:"indicates whether the command executed successfully"`
+	ExitCode int    `json:"exit_code" jsonschema:"the exit code of the command, -1 if it was killed"`
+	TimedOut bool   `json:"timed_out,omitempty" jsonschema:"indicates whether the command was killed because it exceeded the timeout"`
+	Canceled bool   `json:"canceled,omitempty" jsonschema:"indicates whether the command was killed because the tool call was cancelled"`
+	OutputID string `json:"output_id,omitempty" jsonschema:"set if stdout or stderr were shortened; the full output is available as resources run://<output_id>/stdout and run://<output_id>/stderr"`
+}
@@ -7,20 +7,22 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/seb-schulz/mcpilot-pair/internal/textdiff"
 )
 
-// getSafePath ensures the path is within the working directory (including symlinks)
+// getSafePath ensures the path is within the working directory of ctx (including symlinks)
 // and does not contain dotfiles/dotdirs. It is platform-independent and works on both Unix and Windows.
-func getSafePath(p string) (string, error) {
-	wd, err := os.Getwd()
+func getSafePath(ctx context.Context, p string) (string, error) {
+	wd, err := Root(ctx)
 	if err != nil {
-		return "", fmt.Errorf("could not get working directory: %v", err)
+		return "", err
 	}
 
-	p = filepath.Clean(p)
-	abs, err := filepath.Abs(p)
-	if err != nil {
-		return "", fmt.Errorf("could not resolve absolute path: %v", err)
+	// Relative paths are relative to the root, which may differ from the process' working directory
+	abs := filepath.Clean(p)
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(wd, abs)
 	}
 
 	absEval, err := filepath.EvalSymlinks(abs)
@@ -53,6 +55,32 @@ func getSafePath(p string) (string, error) {
 	return absEval, nil
 }
 
+// ResolvePath resolves p to an absolute path within the working directory, applying the
+// same restrictions as the filesystem tools.
+func ResolvePath(ctx context.Context, p string) (string, error) {
+	return getSafePath(ctx, p)
+}
+
+// ResolveDirectory resolves directory like [ResolvePath] and checks that it is an existing directory.
+// An empty directory is the working directory.
+func ResolveDirectory(ctx context.Context, directory string) (string, error) {
+	if directory == "" {
+		directory = "."
+	}
+	dir, err := getSafePath(ctx, directory)
+	if err != nil {
+		return "", fmt.Errorf("invalid directory: %v", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid directory: %v", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("invalid directory: %s is not a directory", directory)
+	}
+	return dir, nil
+}
+
 // containsDotSegment checks if the relative path contains any segment starting with '.'.
 func containsDotSegment(rel string) bool {
 	for _, seg := range strings.Split(rel, string(filepath.Separator)) {
@@ -78,7 +106,7 @@ type ReadFileResult struct {
 
 // ReadFile reads the content of a file within the working directory.
 func ReadFile(ctx context.Context, args ReadFileArgs) (ReadFileResult, error) {
-	safePath, err := getSafePath(args.Path)
+	safePath, err := getSafePath(ctx, args.Path)
 	if err != nil {
 		log.Printf("Invalid path: %v", err)
 		return ReadFileResult{}, fmt.Errorf("invalid path: %v", err)
@@ -105,7 +133,7 @@ type WriteFileResult struct {
 // WriteFile writes content to a file within the working directory.
 // It creates directories if they do not exist.
 func WriteFile(ctx context.Context, args WriteFileArgs) (WriteFileResult, error) {
-	safePath, err := getSafePath(args.Path)
+	safePath, err := getSafePath(ctx, args.Path)
 	if err != nil {
 		log.Printf("Invalid path: %v", err)
 		return WriteFileResult{}, fmt.Errorf("invalid path: %v", err)
@@ -142,7 +170,7 @@ type ListFilesResult struct {
 
 // ListFiles lists files and directories within the working directory.
 func ListFiles(ctx context.Context, args ListFilesArgs) (ListFilesResult, error) {
-	safePath, err := getSafePath(args.Path)
+	safePath, err := getSafePath(ctx, args.Path)
 	if err != nil {
 		log.Printf("Invalid path: %v", err)
 		return ListFilesResult{}, fmt.Errorf("invalid path: %v", err)
@@ -189,7 +217,7 @@ type FileExistsResult struct {
 
 // FileExists checks if a file or directory exists within the working directory.
 func FileExists(ctx context.Context, args FileExistsArgs) (FileExistsResult, error) {
-	safePath, err := getSafePath(args.Path)
+	safePath, err := getSafePath(ctx, args.Path)
 	if err != nil {
 		log.Printf("Invalid path: %v", err)
 		return FileExistsResult{}, fmt.Errorf("invalid path: %v", err)
@@ -204,3 +232,22 @@ func FileExists(ctx context.Context, args FileExistsArgs) (FileExistsResult, err
 	}
 	return FileExistsResult{Exists: true}, nil
 }
+
+// PreviewWrite returns the unified diff WriteFile would apply to the file for args.
+func PreviewWrite(ctx context.Context, args WriteFileArgs) (string, error) {
+	safePath, err := getSafePath(ctx, args.Path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %v", err)
+	}
+
+	content, err := os.ReadFile(safePath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+
+	diff := textdiff.Unified("a/"+args.Path, "b/"+args.Path, string(content), args.Content)
+	if diff == "" {
+		return fmt.Sprintf("No changes to %s.", args.Path), nil
+	}
+	return diff, nil
+}
@@ -1,6 +1,10 @@
 package filesystem
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -45,7 +49,7 @@ func TestGetSafePath(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			_, err := getSafePath(tc.path)
+			_, err := getSafePath(context.Background(), tc.path)
 			if tc.expectError && err == nil {
 				t.Errorf("Expected error for %s, got nil", tc.path)
 			}
@@ -55,3 +59,105 @@ func TestGetSafePath(t *testing.T) {
 		})
 	}
 }
+
+// TestWithRoot tests that paths are resolved against the root of the context.
+func TestWithRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "file.txt"), []byte("root"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithRoot(context.Background(), root)
+
+	result, err := ReadFile(ctx, ReadFileArgs{Path: "file.txt"})
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if result.Content != "root" {
+		t.Errorf("Expected content of the root, got %q", result.Content)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ResolvePath(ctx, filepath.Join(wd, "filesystem.go")); err == nil {
+		t.Error("Expected an error for a path outside of the root")
+	}
+}
+
+// TestReplaceFiles tests that all files are replaced keeping their permissions.
+func TestReplaceFiles(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.sh")
+	if err := os.WriteFile(a, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	originals := map[string][]byte{a: []byte("a"), b: []byte("b")}
+	if err := ReplaceFiles(originals, map[string][]byte{a: []byte("A"), b: []byte("B")}); err != nil {
+		t.Fatalf("ReplaceFiles failed: %v", err)
+	}
+	for path, want := range map[string]string{a: "A", b: "B"} {
+		if data, _ := os.ReadFile(path); string(data) != want {
+			t.Errorf("Expected %q in %s, got %q", want, path, data)
+		}
+	}
+	if info, err := os.Stat(b); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected the permissions of %s to be kept, got %v", b, info.Mode())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("Expected no temporary files, got %d entries", len(entries))
+	}
+
+	if err := ReplaceFiles(originals, map[string][]byte{filepath.Join(dir, "missing.txt"): []byte("x")}); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+
+	// Files changed since their originals were read are not overwritten
+	originals = map[string][]byte{a: []byte("A"), b: []byte("b")}
+	if err := ReplaceFiles(originals, map[string][]byte{a: []byte("AA"), b: []byte("BB")}); err == nil || !strings.Contains(err.Error(), "changed since it was read") {
+		t.Errorf("Expected an error for a changed file, got %v", err)
+	}
+	for path, want := range map[string]string{a: "A", b: "B"} {
+		if data, _ := os.ReadFile(path); string(data) != want {
+			t.Errorf("Expected %q in %s, got %q", want, path, data)
+		}
+	}
+}
+
+// TestReplaceFilesRollback tests that a failed replacement restores the files replaced before
+// with their permissions.
+func TestReplaceFilesRollback(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.sh"), filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rename = func(oldpath, newpath string) error {
+		if newpath == b {
+			return os.ErrPermission
+		}
+		return os.Rename(oldpath, newpath)
+	}
+	t.Cleanup(func() { rename = os.Rename })
+
+	originals := map[string][]byte{a: []byte("a"), b: []byte("b")}
+	if err := ReplaceFiles(originals, map[string][]byte{a: []byte("A"), b: []byte("B")}); err == nil {
+		t.Fatal("Expected the replacement to fail")
+	}
+	if data, _ := os.ReadFile(a); string(data) != "a" {
+		t.Errorf("Expected %s to be restored, got %q", a, data)
+	}
+	if info, err := os.Stat(a); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected the permissions of %s to be restored, got %v", a, info.Mode())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("Expected no temporary files, got %d entries", len(entries))
+	}
+}
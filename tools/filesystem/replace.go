@@ -0,0 +1,81 @@
+package filesystem
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// rename is replaced in tests to make replacements fail.
+var rename = os.Rename
+
+// ReplaceFiles writes changes, the new contents by absolute path, to existing files.
+// originals holds the contents the changes are based on; if a file differs from them,
+// e.g. because another tool wrote it in the meantime, nothing is written. All files are
+// written to temporary files first and then renamed, so a failure leaves the files unchanged.
+func ReplaceFiles(originals, changes map[string][]byte) error {
+	temps := make(map[string]string)
+	defer func() {
+		for _, temp := range temps {
+			os.Remove(temp)
+		}
+	}()
+	perms := make(map[string]fs.FileMode)
+	for file, data := range changes {
+		current, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(current, originals[file]) {
+			return fmt.Errorf("%s was changed since it was read, try again", file)
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		perms[file] = info.Mode().Perm()
+		if temps[file], err = writeTemp(file, data, perms[file]); err != nil {
+			return fmt.Errorf("failed to write %s: %v", file, err)
+		}
+	}
+
+	var replaced []string
+	for _, file := range slices.Sorted(maps.Keys(temps)) {
+		if err := rename(temps[file], file); err != nil {
+			// Restore the files replaced so far
+			for _, done := range replaced {
+				if temp, err := writeTemp(done, originals[done], perms[done]); err == nil {
+					rename(temp, done)
+				}
+			}
+			return fmt.Errorf("failed to replace %s: %v", file, err)
+		}
+		delete(temps, file)
+		replaced = append(replaced, file)
+	}
+	return nil
+}
+
+// writeTemp writes data with perm to a temporary file next to file and returns its path.
+func writeTemp(file string, data []byte, perm fs.FileMode) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
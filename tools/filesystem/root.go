@@ -0,0 +1,29 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// rootKey is the context key of the working directory set by [WithRoot].
+type rootKey struct{}
+
+// WithRoot returns a context in which the tools use dir as working directory instead of
+// the working directory of the process. dir must be an absolute path.
+func WithRoot(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, rootKey{}, dir)
+}
+
+// Root returns the working directory of ctx: the directory set by [WithRoot], or the
+// working directory of the process.
+func Root(ctx context.Context) (string, error) {
+	if dir, ok := ctx.Value(rootKey{}).(string); ok {
+		return dir, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("could not get working directory: %v", err)
+	}
+	return wd, nil
+}
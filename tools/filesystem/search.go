@@ -33,9 +33,9 @@ func Search(ctx context.Context, args SearchArgs) (SearchResult, error) {
 	if err != nil {
 		return SearchResult{}, fmt.Errorf("invalid regex pattern: %v", err)
 	}
-	wd, err := os.Getwd()
+	wd, err := Root(ctx)
 	if err != nil {
-		return SearchResult{}, fmt.Errorf("could not get working directory: %v", err)
+		return SearchResult{}, err
 	}
 
 	result := SearchResult{
@@ -48,7 +48,7 @@ func Search(ctx context.Context, args SearchArgs) (SearchResult, error) {
 		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
 			return nil
 		}
-		safePath, err := getSafePath(path)
+		safePath, err := getSafePath(ctx, path)
 		if err != nil {
 			return nil // Skip files outside the working directory
 		}
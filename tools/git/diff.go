@@ -0,0 +1,141 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// diffArgs are passed to every command producing a patch. External diff drivers and
+// textconv filters could run commands configured in the repository.
+var diffArgs = []string{"--no-ext-diff", "--no-textconv", "--relative"}
+
+// Diff returns the changes of the working tree, the index or between revisions.
+func (r *Runner) Diff(ctx context.Context, args DiffArgs) (DiffResult, error) {
+	cmdArgs, err := diffCommand(ctx, args)
+	if err != nil {
+		return DiffResult{}, err
+	}
+
+	numstat, err := r.git(ctx, append([]string{"diff", "--numstat", "-z"}, cmdArgs...)...)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	patch, err := r.git(ctx, append([]string{"diff"}, cmdArgs...)...)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	patch, truncated := maxBytes(args.MaxBytes).Truncate(patch, "")
+	return DiffResult{Files: parseNumstat(numstat), Patch: patch, Truncated: truncated}, nil
+}
+
+// diffCommand returns the arguments of git diff following the subcommand.
+func diffCommand(ctx context.Context, args DiffArgs) ([]string, error) {
+	cmdArgs := append([]string{}, diffArgs...)
+	if args.Staged {
+		cmdArgs = append(cmdArgs, "--cached")
+	}
+	if args.To != "" && args.From == "" {
+		return nil, fmt.Errorf("to requires from")
+	}
+	if args.To != "" && args.Staged {
+		return nil, fmt.Errorf("staged cannot be combined with to")
+	}
+	for _, rev := range []string{args.From, args.To} {
+		if rev == "" {
+			continue
+		}
+		if err := checkRevision(rev); err != nil {
+			return nil, err
+		}
+		cmdArgs = append(cmdArgs, rev)
+	}
+	specs, err := pathspecs(ctx, args.Paths)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(cmdArgs, "--"), specs...), nil
+}
+
+// Show returns a commit with its changes, or the content of a file at a revision.
+func (r *Runner) Show(ctx context.Context, args ShowArgs) (ShowResult, error) {
+	rev := args.Revision
+	if rev == "" {
+		rev = "HEAD"
+	}
+	if err := checkRevision(rev); err != nil {
+		return ShowResult{}, err
+	}
+	limits := maxBytes(args.MaxBytes)
+
+	if args.Path != "" {
+		specs, err := pathspecs(ctx, []string{args.Path})
+		if err != nil {
+			return ShowResult{}, err
+		}
+		// <rev>:./<path> is resolved relative to the working directory
+		path := "./" + strings.TrimPrefix(specs[0], ":(literal)")
+		content, err := r.git(ctx, "show", "--no-textconv", rev+":"+path)
+		if err != nil {
+			return ShowResult{}, err
+		}
+		content, truncated := limits.Truncate(content, "")
+		return ShowResult{Content: content, Truncated: truncated}, nil
+	}
+
+	commit, files, err := r.commit(ctx, rev)
+	if err != nil {
+		return ShowResult{}, err
+	}
+	// The hash makes sure that the patch belongs to the same commit
+	patch, err := r.git(ctx, append(append([]string{"show", "--format="}, diffArgs...), commit.Hash, "--")...)
+	if err != nil {
+		return ShowResult{}, err
+	}
+	patch, truncated := limits.Truncate(strings.TrimLeft(patch, "\n"), "")
+	return ShowResult{Commit: &commit, Files: files, Patch: patch, Truncated: truncated}, nil
+}
+
+// commit returns the commit rev and the files it changed.
+func (r *Runner) commit(ctx context.Context, rev string) (Commit, []DiffStat, error) {
+	out, err := r.git(ctx, "show", "--no-patch", "--format="+commitFormat, rev, "--")
+	if err != nil {
+		return Commit{}, nil, err
+	}
+	commits := parseCommits(out)
+	if len(commits) != 1 {
+		return Commit{}, nil, fmt.Errorf("'%s' is not a commit", rev)
+	}
+	numstat, err := r.git(ctx, append(append([]string{"show", "--format=", "--numstat", "-z"}, diffArgs...), commits[0].Hash, "--")...)
+	if err != nil {
+		return Commit{}, nil, err
+	}
+	return commits[0], parseNumstat(numstat), nil
+}
+
+// parseNumstat parses the output of `git diff --numstat -z`. Renamed files are reported as
+// "added TAB deleted TAB NUL origPath NUL path NUL", binary files with "-" as counts.
+func parseNumstat(out string) []DiffStat {
+	stats := []DiffStat{}
+	records := strings.Split(out, "\x00")
+	for i := 0; i < len(records); i++ {
+		fields := strings.SplitN(strings.TrimLeft(records[i], "\n"), "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		stat := DiffStat{Path: fields[2]}
+		if fields[0] == "-" && fields[1] == "-" {
+			stat.Binary = true
+		} else {
+			stat.Added, _ = strconv.Atoi(fields[0])
+			stat.Deleted, _ = strconv.Atoi(fields[1])
+		}
+		if stat.Path == "" && i+2 < len(records) {
+			stat.OrigPath, stat.Path = records[i+1], records[i+2]
+			i += 2
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
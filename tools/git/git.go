@@ -0,0 +1,187 @@
+// Package git runs git on the repository of the working directory and turns
+// its output into structured results.
+package git
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/seb-schulz/mcpilot-pair/internal/gitsafe"
+	"github.com/seb-schulz/mcpilot-pair/internal/output"
+	"github.com/seb-schulz/mcpilot-pair/internal/runner"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+// DefaultTimeout is the time a git command may take unless configured otherwise.
+const DefaultTimeout = time.Minute
+
+// defaultMaxBytes is the size of patches and file contents returned by default.
+const defaultMaxBytes = 64 << 10
+
+// maxMaxBytes is the largest size a call may ask for.
+const maxMaxBytes = 1 << 20
+
+// revisionPattern matches revisions like HEAD~2, main, v1.0^{commit} or a commit hash.
+// Revisions starting with "-" would be taken as options.
+var revisionPattern = regexp.MustCompile(`^[A-Za-z0-9_./@^~{}-]+$`)
+
+// globalArgs are passed to every git command, quoting would garble non-ASCII paths. The
+// options of [gitsafe.Args] and, unless hooks are enabled, [gitsafe.NoHooks] follow them,
+// so git does not run programs configured in the repository.
+var globalArgs = []string{"--no-pager", "-c", "core.quotepath=off", "-c", "color.ui=false"}
+
+// Runner runs git in the working directory.
+type Runner struct {
+	// Timeout is the maximum duration of a git command.
+	Timeout time.Duration
+	// Env decides the environment of git.
+	Env runner.EnvPolicy
+	// Protected lists patterns of branches which must not be changed, in the syntax of [path.Match].
+	Protected []string
+	// CoAuthor is added as Co-authored-by trailer to commits if not empty, e.g. "Name <email>".
+	CoAuthor string
+	// Hooks runs the hooks of the repository, e.g. pre-commit or post-checkout. They run
+	// with the privileges of the server, and the approval of a commit does not show them.
+	Hooks bool
+}
+
+// NewRunner returns a Runner with the default timeout, environment and protected branches.
+func NewRunner() *Runner {
+	return &Runner{Timeout: DefaultTimeout, Env: runner.DefaultEnvPolicy(), Protected: DefaultProtected}
+}
+
+// git runs git with args in the working directory and returns its standard output.
+// A non-zero exit code is returned as error containing the standard error output.
+func (r *Runner) git(ctx context.Context, args ...string) (string, error) {
+	stdout, stderr, exitCode, err := r.run(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	if exitCode != 0 {
+		return "", fmt.Errorf("git %s failed: %s", args[0], strings.TrimSpace(stderr))
+	}
+	return stdout, nil
+}
+
+// run runs git with args in the working directory and returns its output and exit code.
+func (r *Runner) run(ctx context.Context, args ...string) (stdout, stderr string, exitCode int, err error) {
+	dir, err := filesystem.ResolvePath(ctx, ".")
+	if err != nil {
+		return "", "", 0, err
+	}
+	env, err := r.Env.Environ(os.Environ(), nil)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(r.Timeout, DefaultTimeout))
+	defer cancel()
+
+	var hooks []string
+	if !r.Hooks {
+		hooks = gitsafe.NoHooks
+	}
+	gitArgs := slices.Concat(globalArgs, hooks, gitsafe.Args(ctx, dir, env), args)
+	cmd := runner.Command(ctx, "git", gitArgs...)
+	cmd.Dir = dir
+	// Read-only commands must not take the index lock, git never asks for credentials or opens an editor
+	cmd.Env = append(env, "GIT_OPTIONAL_LOCKS=0", "GIT_TERMINAL_PROMPT=0", "GIT_EDITOR=true")
+	var stdoutBuf, stderrBuf bytes.Buffer
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
+	status, err := runner.Run(ctx, cmd)
+	switch {
+	case err != nil:
+		return "", "", 0, err
+	case status.TimedOut:
+		return "", "", 0, fmt.Errorf("git %s timed out", args[0])
+	case status.Canceled:
+		return "", "", 0, ctx.Err()
+	}
+	return stdoutBuf.String(), stderrBuf.String(), status.ExitCode, nil
+}
+
+// prefix returns the path of the working directory relative to the top of the repository,
+// ending with a slash unless it is the top.
+func (r *Runner) prefix(ctx context.Context) (string, error) {
+	out, err := r.git(ctx, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// checkRevision makes sure that rev cannot be taken as an option.
+func checkRevision(rev string) error {
+	if !revisionPattern.MatchString(rev) || strings.HasPrefix(rev, "-") {
+		return fmt.Errorf("invalid revision '%s'", rev)
+	}
+	return nil
+}
+
+// pathspecs confines paths to the working directory and returns them relative to it.
+func pathspecs(ctx context.Context, paths []string) ([]string, error) {
+	root, err := filesystem.ResolvePath(ctx, ".")
+	if err != nil {
+		return nil, err
+	}
+	var specs []string
+	for _, p := range paths {
+		abs, err := filesystem.ResolvePath(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil {
+			return nil, err
+		}
+		// Paths are taken literally, not as glob patterns
+		specs = append(specs, ":(literal)"+filepath.ToSlash(rel))
+	}
+	return specs, nil
+}
+
+// maxBytes returns the output limits for a call asking for n bytes.
+func maxBytes(n int) output.Limits {
+	if n <= 0 {
+		n = defaultMaxBytes
+	}
+	return output.Limits{MaxBytes: min(n, maxMaxBytes)}
+}
+
+// commitFormat is the pretty format parsed by parseCommits: the fields are separated by NUL
+// bytes, and commits are terminated by a record separator.
+const commitFormat = "%H%x00%P%x00%an <%ae>%x00%aI%x00%cn <%ce>%x00%cI%x00%s%x00%b%x1e"
+
+// parseCommits parses the output of git log or git show with [commitFormat].
+func parseCommits(out string) []Commit {
+	var commits []Commit
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimLeft(record, "\n"), "\x00")
+		if len(fields) < 8 {
+			continue
+		}
+		c := Commit{
+			Hash:       fields[0],
+			Parents:    strings.Fields(fields[1]),
+			Author:     fields[2],
+			AuthorDate: fields[3],
+			CommitDate: fields[5],
+			Subject:    fields[6],
+			Body:       strings.TrimSpace(fields[7]),
+		}
+		if fields[4] != fields[2] {
+			c.Committer = fields[4]
+		}
+		commits = append(commits, c)
+	}
+	return commits
+}
@@ -0,0 +1,180 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setupRepo creates a git repository with an initial commit of files and changes into it.
+func setupRepo(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	oldwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current working directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(oldwd) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change working directory: %v", err)
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	writeFiles(t, files)
+	gitCmd(t, "init", "-q", "-b", "main")
+	gitCmd(t, "config", "user.name", "Test")
+	gitCmd(t, "config", "user.email", "test@example.com")
+	gitCmd(t, "add", ".")
+	gitCmd(t, "commit", "-q", "-m", "Initial commit\n\nWith a body.")
+}
+
+func writeFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+}
+
+func gitCmd(t *testing.T, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+	return string(out)
+}
+
+func TestStatus(t *testing.T) {
+	setupRepo(t, map[string]string{"a.txt": "a\n", "b.txt": "b\n", "c.txt": "c\n", "sub/d.txt": "d\n"})
+	writeFiles(t, map[string]string{"a.txt": "changed\n", "b.txt": "staged\n", "new file.txt": "new\n", "sub/e.txt": "e\n"})
+	gitCmd(t, "add", "b.txt")
+	gitCmd(t, "mv", "c.txt", "renamed.txt")
+	os.Remove("sub/d.txt")
+
+	result, err := NewRunner().Status(context.Background(), StatusArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Branch != "main" || result.Commit == "" || result.Clean {
+		t.Errorf("Unexpected branch: %+v", result)
+	}
+	expectedStaged := []FileStatus{
+		{Path: "b.txt", Status: "modified"},
+		{Path: "renamed.txt", OrigPath: "c.txt", Status: "renamed"},
+	}
+	if !reflect.DeepEqual(result.Staged, expectedStaged) {
+		t.Errorf("Expected staged %+v, got %+v", expectedStaged, result.Staged)
+	}
+	expectedUnstaged := []FileStatus{{Path: "a.txt", Status: "modified"}, {Path: "sub/d.txt", Status: "deleted"}}
+	if !reflect.DeepEqual(result.Unstaged, expectedUnstaged) {
+		t.Errorf("Expected unstaged %+v, got %+v", expectedUnstaged, result.Unstaged)
+	}
+	if expected := []string{"new file.txt", "sub/e.txt"}; !reflect.DeepEqual(result.Untracked, expected) {
+		t.Errorf("Expected untracked %q, got %q", expected, result.Untracked)
+	}
+
+	// Paths are relative to the working directory, even if it is below the top of the repository
+	os.Chdir("sub")
+	result, err = NewRunner().Status(context.Background(), StatusArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Staged) != 0 || !reflect.DeepEqual(result.Untracked, []string{"e.txt"}) {
+		t.Errorf("Unexpected status in subdirectory: %+v", result)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	setupRepo(t, map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+	writeFiles(t, map[string]string{"a.txt": "a\nmore\n", "b.txt": "staged\n"})
+	gitCmd(t, "add", "b.txt")
+
+	runner := NewRunner()
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		args     DiffArgs
+		expected []DiffStat
+	}{
+		{"Working tree", DiffArgs{}, []DiffStat{{Path: "a.txt", Added: 1}}},
+		{"Staged", DiffArgs{Staged: true}, []DiffStat{{Path: "b.txt", Added: 1, Deleted: 1}}},
+		{"Against HEAD", DiffArgs{From: "HEAD"}, []DiffStat{{Path: "a.txt", Added: 1}, {Path: "b.txt", Added: 1, Deleted: 1}}},
+		{"Path filter", DiffArgs{From: "HEAD", Paths: []string{"b.txt"}}, []DiffStat{{Path: "b.txt", Added: 1, Deleted: 1}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := runner.Diff(ctx, tc.args)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result.Files, tc.expected) {
+				t.Errorf("Expected %+v, got %+v", tc.expected, result.Files)
+			}
+			for _, f := range tc.expected {
+				if !strings.Contains(result.Patch, "+++ b/"+f.Path) {
+					t.Errorf("Patch is missing %s:\n%s", f.Path, result.Patch)
+				}
+			}
+		})
+	}
+
+	writeFiles(t, map[string]string{"a.txt": strings.Repeat("line\n", 1000)})
+	result, err := runner.Diff(ctx, DiffArgs{MaxBytes: 1000})
+	if err != nil || !result.Truncated || len(result.Patch) > 1200 {
+		t.Errorf("Expected shortened patch, got %d bytes (%v)", len(result.Patch), err)
+	}
+
+	for _, args := range []DiffArgs{
+		{From: "--output=/tmp/pwned"},
+		{From: "HEAD", To: "-p"},
+		{To: "HEAD"},
+		{Paths: []string{"../outside"}},
+	} {
+		if _, err := runner.Diff(ctx, args); err == nil {
+			t.Errorf("Expected error for %+v", args)
+		}
+	}
+}
+
+func TestShow(t *testing.T) {
+	setupRepo(t, map[string]string{"a.txt": "a\n"})
+	writeFiles(t, map[string]string{"a.txt": "b\n"})
+	gitCmd(t, "commit", "-q", "-am", "Change a")
+
+	runner := NewRunner()
+	ctx := context.Background()
+	result, err := runner.Show(ctx, ShowArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c := result.Commit
+	if c == nil || c.Subject != "Change a" || c.Author != "Test <test@example.com>" || len(c.Parents) != 1 || c.Committer != "" {
+		t.Fatalf("Unexpected commit: %+v", c)
+	}
+	if !reflect.DeepEqual(result.Files, []DiffStat{{Path: "a.txt", Added: 1, Deleted: 1}}) || !strings.Contains(result.Patch, "-a\n+b\n") {
+		t.Errorf("Unexpected changes: %+v", result)
+	}
+
+	result, err = runner.Show(ctx, ShowArgs{Revision: "HEAD~1"})
+	if err != nil || result.Commit.Subject != "Initial commit" || result.Commit.Body != "With a body." {
+		t.Errorf("Unexpected commit: %+v (%v)", result.Commit, err)
+	}
+
+	result, err = runner.Show(ctx, ShowArgs{Revision: "HEAD~1", Path: "a.txt"})
+	if err != nil || result.Content != "a\n" || result.Commit != nil {
+		t.Errorf("Unexpected content: %+v (%v)", result, err)
+	}
+
+	if _, err := runner.Show(ctx, ShowArgs{Revision: "HEAD", Path: "../etc/passwd"}); err == nil {
+		t.Errorf("Expected error for path outside the working directory")
+	}
+}
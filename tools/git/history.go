@@ -0,0 +1,210 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+const (
+	// defaultLogLimit and maxLogLimit bound the number of commits of git_log.
+	defaultLogLimit = 20
+	maxLogLimit     = 200
+	// defaultBlameLines and maxBlameLines bound the number of lines of git_blame.
+	defaultBlameLines = 100
+	maxBlameLines     = 500
+	// defaultGrepResults and maxGrepResults bound the number of matches of git_grep.
+	defaultGrepResults = 200
+	maxGrepResults     = 1000
+)
+
+// limit returns n within [1, max], or def if n is not positive.
+func limit(n, def, max int) int {
+	if n <= 0 {
+		return def
+	}
+	return min(n, max)
+}
+
+// Log returns the commits of a revision, optionally filtered by paths, author and date.
+func (r *Runner) Log(ctx context.Context, args LogArgs) (LogResult, error) {
+	rev := args.Revision
+	if rev == "" {
+		rev = "HEAD"
+	}
+	if err := checkRevision(rev); err != nil {
+		return LogResult{}, err
+	}
+	specs, err := pathspecs(ctx, args.Paths)
+	if err != nil {
+		return LogResult{}, err
+	}
+	n := limit(args.Limit, defaultLogLimit, maxLogLimit)
+
+	// One more commit than asked for tells whether there are more
+	cmdArgs := []string{"log", "--format=" + commitFormat, "--max-count=" + strconv.Itoa(n+1)}
+	if args.Author != "" {
+		cmdArgs = append(cmdArgs, "--author="+args.Author)
+	}
+	if args.Since != "" {
+		cmdArgs = append(cmdArgs, "--since="+args.Since)
+	}
+	out, err := r.git(ctx, append(append(cmdArgs, rev, "--"), specs...)...)
+	if err != nil {
+		return LogResult{}, err
+	}
+	commits := parseCommits(out)
+	if commits == nil {
+		commits = []Commit{}
+	}
+	result := LogResult{Commits: commits}
+	if len(commits) > n {
+		result.Commits, result.More = commits[:n], true
+	}
+	return result, nil
+}
+
+// Blame returns which commit last changed each line of a range of a file.
+func (r *Runner) Blame(ctx context.Context, args BlameArgs) (BlameResult, error) {
+	if args.Path == "" {
+		return BlameResult{}, fmt.Errorf("no path given")
+	}
+	specs, err := pathspecs(ctx, []string{args.Path})
+	if err != nil {
+		return BlameResult{}, err
+	}
+	start := max(args.StartLine, 1)
+	end := args.EndLine
+	if end <= 0 {
+		end = start + defaultBlameLines - 1
+	}
+	if end < start {
+		return BlameResult{}, fmt.Errorf("end_line %d is before start_line %d", end, start)
+	}
+	end = min(end, start+maxBlameLines-1)
+
+	cmdArgs := []string{"blame", "--porcelain", "-L", fmt.Sprintf("%d,%d", start, end)}
+	if args.Revision != "" {
+		if err := checkRevision(args.Revision); err != nil {
+			return BlameResult{}, err
+		}
+		cmdArgs = append(cmdArgs, args.Revision)
+	}
+	// blame takes a plain path, not a pathspec
+	path := strings.TrimPrefix(specs[0], ":(literal)")
+	out, err := r.git(ctx, append(cmdArgs, "--", path)...)
+	if err != nil {
+		return BlameResult{}, err
+	}
+	return BlameResult{Lines: parseBlame(out)}, nil
+}
+
+// parseBlame parses the output of `git blame --porcelain`. The details of a commit are
+// only printed for its first line.
+func parseBlame(out string) []BlameLine {
+	type details struct{ author, mail, date, summary string }
+	commits := make(map[string]*details)
+	lines := []BlameLine{}
+
+	var current BlameLine
+	var d *details
+	for _, line := range strings.Split(out, "\n") {
+		if text, ok := strings.CutPrefix(line, "\t"); ok && d != nil {
+			current.Text = text
+			current.Author = strings.TrimSpace(d.author + " " + d.mail)
+			current.Date, current.Summary = d.date, d.summary
+			lines = append(lines, current)
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		if d == nil && len(key) != 40 && len(key) != 64 {
+			continue
+		}
+		switch key {
+		case "author":
+			d.author = value
+		case "author-mail":
+			d.mail = value
+		case "author-time":
+			if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+				d.date = time.Unix(sec, 0).UTC().Format(time.RFC3339)
+			}
+		case "summary":
+			d.summary = value
+		default:
+			// <hash> <orig line> <final line> [<lines in group>]
+			fields := strings.Fields(line)
+			if len(key) != 40 && len(key) != 64 || len(fields) < 3 {
+				continue
+			}
+			n, _ := strconv.Atoi(fields[2])
+			current = BlameLine{Line: n, Hash: key}
+			if d = commits[key]; d == nil {
+				d = &details{}
+				commits[key] = d
+			}
+		}
+	}
+	return lines
+}
+
+// Grep searches the tracked files of the working tree or of a revision for a pattern.
+func (r *Runner) Grep(ctx context.Context, args GrepArgs) (GrepResult, error) {
+	if args.Pattern == "" {
+		return GrepResult{}, fmt.Errorf("no pattern given")
+	}
+	specs, err := pathspecs(ctx, args.Paths)
+	if err != nil {
+		return GrepResult{}, err
+	}
+	cmdArgs := []string{"grep", "--line-number", "--null", "-I", "--extended-regexp"}
+	if args.IgnoreCase {
+		cmdArgs = append(cmdArgs, "--ignore-case")
+	}
+	cmdArgs = append(cmdArgs, "-e", args.Pattern)
+	if args.Revision != "" {
+		if err := checkRevision(args.Revision); err != nil {
+			return GrepResult{}, err
+		}
+		cmdArgs = append(cmdArgs, args.Revision)
+	}
+
+	stdout, stderr, exitCode, err := r.run(ctx, append(append(cmdArgs, "--"), specs...)...)
+	if err != nil {
+		return GrepResult{}, err
+	}
+	// git grep exits with 1 if nothing matches
+	if exitCode != 0 && (exitCode != 1 || strings.TrimSpace(stderr) != "") {
+		return GrepResult{}, fmt.Errorf("git grep failed: %s", strings.TrimSpace(stderr))
+	}
+	return parseGrep(stdout, args.Revision, limit(args.MaxResults, defaultGrepResults, maxGrepResults)), nil
+}
+
+// parseGrep parses the output of `git grep --line-number --null`: "path NUL line NUL text".
+// Paths searched in a revision are prefixed with "<revision>:".
+func parseGrep(out, rev string, max int) GrepResult {
+	result := GrepResult{Matches: make(map[string][]filesystem.Match)}
+	count := 0
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if count == max {
+			result.Truncated = true
+			break
+		}
+		n, _ := strconv.Atoi(fields[1])
+		path := fields[0]
+		if rev != "" {
+			path = strings.TrimPrefix(path, rev+":")
+		}
+		result.Matches[path] = append(result.Matches[path], filesystem.Match{LineNumber: n, Line: fields[2]})
+		count++
+	}
+	return result
+}
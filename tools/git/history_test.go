@@ -0,0 +1,124 @@
+package git
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+// setupHistory creates a repository with three commits by two authors.
+func setupHistory(t *testing.T) {
+	t.Helper()
+	setupRepo(t, map[string]string{"a.txt": "one\ntwo\n", "sub/b.txt": "needle\n"})
+	writeFiles(t, map[string]string{"a.txt": "one\nTWO needle\nthree\n"})
+	gitCmd(t, "commit", "-q", "-am", "Change a")
+	writeFiles(t, map[string]string{"sub/b.txt": "haystack\n"})
+	gitCmd(t, "-c", "user.name=Other", "-c", "user.email=other@example.com", "commit", "-q", "-am", "Change b")
+}
+
+func TestLog(t *testing.T) {
+	setupHistory(t)
+	runner := NewRunner()
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		args     LogArgs
+		expected []string
+		more     bool
+	}{
+		{"All", LogArgs{}, []string{"Change b", "Change a", "Initial commit"}, false},
+		{"Limit", LogArgs{Limit: 2}, []string{"Change b", "Change a"}, true},
+		{"Path", LogArgs{Paths: []string{"a.txt"}}, []string{"Change a", "Initial commit"}, false},
+		{"Author", LogArgs{Author: "other@"}, []string{"Change b"}, false},
+		{"Range", LogArgs{Revision: "HEAD~2..HEAD"}, []string{"Change b", "Change a"}, false},
+		{"Since", LogArgs{Since: "2000-01-01"}, []string{"Change b", "Change a", "Initial commit"}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := runner.Log(ctx, tc.args)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var subjects []string
+			for _, c := range result.Commits {
+				subjects = append(subjects, c.Subject)
+			}
+			if !reflect.DeepEqual(subjects, tc.expected) || result.More != tc.more {
+				t.Errorf("Expected %q (more %v), got %q (more %v)", tc.expected, tc.more, subjects, result.More)
+			}
+		})
+	}
+
+	if _, err := runner.Log(ctx, LogArgs{Revision: "--all"}); err == nil {
+		t.Errorf("Expected error for option as revision")
+	}
+}
+
+func TestBlame(t *testing.T) {
+	setupHistory(t)
+	runner := NewRunner()
+	ctx := context.Background()
+
+	result, err := runner.Blame(ctx, BlameArgs{Path: "a.txt", StartLine: 1, EndLine: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %+v", result.Lines)
+	}
+	first, second := result.Lines[0], result.Lines[1]
+	if first.Line != 1 || first.Text != "one" || first.Summary != "Initial commit" || first.Author != "Test <test@example.com>" || first.Date == "" {
+		t.Errorf("Unexpected line: %+v", first)
+	}
+	if second.Line != 2 || second.Text != "TWO needle" || second.Summary != "Change a" || second.Hash == first.Hash {
+		t.Errorf("Unexpected line: %+v", second)
+	}
+
+	result, err = runner.Blame(ctx, BlameArgs{Path: "a.txt", Revision: "HEAD~2"})
+	if err != nil || len(result.Lines) != 2 || result.Lines[1].Text != "two" {
+		t.Errorf("Unexpected blame of old revision: %+v (%v)", result, err)
+	}
+	if _, err := runner.Blame(ctx, BlameArgs{Path: "../a.txt"}); err == nil {
+		t.Errorf("Expected error for path outside the working directory")
+	}
+}
+
+func TestGrep(t *testing.T) {
+	setupHistory(t)
+	runner := NewRunner()
+	ctx := context.Background()
+
+	result, err := runner.Grep(ctx, GrepArgs{Pattern: "needle"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string][]filesystem.Match{"a.txt": {{LineNumber: 2, Line: "TWO needle"}}}
+	if !reflect.DeepEqual(result.Matches, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result.Matches)
+	}
+
+	result, err = runner.Grep(ctx, GrepArgs{Pattern: "NEEDLE", Revision: "HEAD~1", IgnoreCase: true, Paths: []string{"sub"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected = map[string][]filesystem.Match{"sub/b.txt": {{LineNumber: 1, Line: "needle"}}}
+	if !reflect.DeepEqual(result.Matches, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result.Matches)
+	}
+
+	result, err = runner.Grep(ctx, GrepArgs{Pattern: "nothing matches"})
+	if err != nil || len(result.Matches) != 0 {
+		t.Errorf("Unexpected result: %+v (%v)", result, err)
+	}
+	result, err = runner.Grep(ctx, GrepArgs{Pattern: "e", MaxResults: 1})
+	if err != nil || !result.Truncated {
+		t.Errorf("Expected truncated result: %+v (%v)", result, err)
+	}
+	if _, err := runner.Grep(ctx, GrepArgs{Pattern: "("}); err == nil || !strings.Contains(err.Error(), "grep") {
+		t.Errorf("Expected error for invalid pattern, got %v", err)
+	}
+}
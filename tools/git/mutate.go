@@ -0,0 +1,277 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultProtected lists the branches the mutating tools refuse to work on unless configured otherwise.
+var DefaultProtected = []string{"main", "master"}
+
+// stashPattern matches the entries of `git stash list --format=%gd%x00%gs`.
+var stashPattern = regexp.MustCompile(`^stash@\{(\d+)\}\x00(.*)$`)
+
+// isProtected reports whether branch matches one of the protected patterns.
+func (r *Runner) isProtected(branch string) bool {
+	for _, pattern := range r.Protected {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// currentBranch returns the checked out branch, empty if HEAD is detached.
+func (r *Runner) currentBranch(ctx context.Context) (string, error) {
+	out, err := r.git(ctx, "branch", "--show-current")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// checkBranch refuses to change a protected branch.
+func (r *Runner) checkBranch(ctx context.Context) (string, error) {
+	branch, err := r.currentBranch(ctx)
+	if err != nil {
+		return "", err
+	}
+	if r.isProtected(branch) {
+		return "", fmt.Errorf("branch '%s' is protected, create a branch for your work with git_branch_create first", branch)
+	}
+	return branch, nil
+}
+
+// checkBranchName validates the name of a branch to create or switch to.
+func (r *Runner) checkBranchName(ctx context.Context, name string) error {
+	if name == "" || strings.HasPrefix(name, "-") {
+		return fmt.Errorf("invalid branch name '%s'", name)
+	}
+	if _, err := r.git(ctx, "check-ref-format", "--branch", name); err != nil {
+		return fmt.Errorf("invalid branch name '%s'", name)
+	}
+	if r.isProtected(name) {
+		return fmt.Errorf("branch '%s' is protected", name)
+	}
+	return nil
+}
+
+// Add stages the changes of paths.
+func (r *Runner) Add(ctx context.Context, args AddArgs) (StatusResult, error) {
+	if len(args.Paths) == 0 {
+		return StatusResult{}, fmt.Errorf("no paths given")
+	}
+	specs, err := pathspecs(ctx, args.Paths)
+	if err != nil {
+		return StatusResult{}, err
+	}
+	if _, err := r.checkBranch(ctx); err != nil {
+		return StatusResult{}, err
+	}
+	if _, err := r.git(ctx, append([]string{"add", "--"}, specs...)...); err != nil {
+		return StatusResult{}, err
+	}
+	return r.Status(ctx, StatusArgs{})
+}
+
+// Commit commits the staged changes. The configured co-author is added as trailer.
+func (r *Runner) Commit(ctx context.Context, args CommitArgs) (CommitResult, error) {
+	if strings.TrimSpace(args.Message) == "" {
+		return CommitResult{}, fmt.Errorf("commit message is required")
+	}
+	branch, err := r.checkBranch(ctx)
+	if err != nil {
+		return CommitResult{}, err
+	}
+	if branch == "" {
+		return CommitResult{}, fmt.Errorf("HEAD is detached, create a branch with git_branch_create first")
+	}
+
+	cmdArgs := []string{"commit", "--message", args.Message}
+	if r.CoAuthor != "" {
+		cmdArgs = append(cmdArgs, "--trailer", "Co-authored-by: "+r.CoAuthor)
+	}
+	if _, err := r.git(ctx, cmdArgs...); err != nil {
+		return CommitResult{}, err
+	}
+
+	commit, files, err := r.commit(ctx, "HEAD")
+	if err != nil {
+		return CommitResult{}, err
+	}
+	return CommitResult{Branch: branch, Commit: commit, Files: files}, nil
+}
+
+// BranchCreate creates a branch and optionally switches to it.
+func (r *Runner) BranchCreate(ctx context.Context, args BranchCreateArgs) (BranchResult, error) {
+	if err := r.checkBranchName(ctx, args.Name); err != nil {
+		return BranchResult{}, err
+	}
+	startPoint := args.StartPoint
+	if startPoint == "" {
+		startPoint = "HEAD"
+	}
+	if err := checkRevision(startPoint); err != nil {
+		return BranchResult{}, err
+	}
+	if args.Switch {
+		_, err := r.git(ctx, "switch", "--no-track", "--create", args.Name, startPoint)
+		if err != nil {
+			return BranchResult{}, err
+		}
+	} else if _, err := r.git(ctx, "branch", "--no-track", args.Name, startPoint); err != nil {
+		return BranchResult{}, err
+	}
+	return r.branchResult(ctx, args.Name)
+}
+
+// BranchSwitch switches to an existing branch, keeping uncommitted changes.
+func (r *Runner) BranchSwitch(ctx context.Context, args BranchSwitchArgs) (BranchResult, error) {
+	if err := r.checkBranchName(ctx, args.Name); err != nil {
+		return BranchResult{}, err
+	}
+	if _, err := r.git(ctx, "switch", "--no-guess", args.Name); err != nil {
+		return BranchResult{}, err
+	}
+	return r.branchResult(ctx, args.Name)
+}
+
+func (r *Runner) branchResult(ctx context.Context, name string) (BranchResult, error) {
+	commit, err := r.git(ctx, "rev-parse", "--verify", "--quiet", "refs/heads/"+name)
+	if err != nil {
+		return BranchResult{}, err
+	}
+	current, err := r.currentBranch(ctx)
+	if err != nil {
+		return BranchResult{}, err
+	}
+	return BranchResult{Branch: name, Commit: strings.TrimSpace(commit), Current: current}, nil
+}
+
+// Stash saves, re-applies or lists uncommitted changes.
+func (r *Runner) Stash(ctx context.Context, args StashArgs) (StashResult, error) {
+	if args.Index < 0 {
+		return StashResult{}, fmt.Errorf("invalid stash index %d", args.Index)
+	}
+	ref := "stash@{" + strconv.Itoa(args.Index) + "}"
+	var cmdArgs []string
+	switch args.Action {
+	case "", "push":
+		cmdArgs = []string{"stash", "push"}
+		if args.IncludeUntracked {
+			cmdArgs = append(cmdArgs, "--include-untracked")
+		}
+		if args.Message != "" {
+			cmdArgs = append(cmdArgs, "--message", args.Message)
+		}
+	case "pop", "apply":
+		cmdArgs = []string{"stash", args.Action, ref}
+	case "list":
+	default:
+		return StashResult{}, fmt.Errorf("unknown stash action '%s', use push, pop, apply or list", args.Action)
+	}
+
+	var result StashResult
+	if cmdArgs != nil {
+		if _, err := r.checkBranch(ctx); err != nil {
+			return StashResult{}, err
+		}
+		// The files are listed before they change
+		var err error
+		if cmdArgs[1] == "push" {
+			result.Files, err = r.listFiles(ctx, "diff", "--name-only", "-z", "--relative", "HEAD")
+			if err == nil && args.IncludeUntracked {
+				var untracked []string
+				untracked, err = r.listFiles(ctx, "ls-files", "-z", "--others", "--exclude-standard")
+				result.Files = append(result.Files, untracked...)
+			}
+		} else {
+			result.Files, err = r.listFiles(ctx, "stash", "show", "--name-only", "-z", "--relative", "--include-untracked", ref)
+		}
+		if err != nil {
+			return StashResult{}, err
+		}
+		out, err := r.git(ctx, cmdArgs...)
+		if err != nil {
+			return StashResult{}, err
+		}
+		result.Output = strings.TrimSpace(out)
+	}
+
+	out, err := r.git(ctx, "stash", "list", "--format=%gd%x00%gs")
+	if err != nil {
+		return StashResult{}, err
+	}
+	result.Stashes = []Stash{}
+	for _, line := range strings.Split(out, "\n") {
+		if m := stashPattern.FindStringSubmatch(line); m != nil {
+			index, _ := strconv.Atoi(m[1])
+			result.Stashes = append(result.Stashes, Stash{Index: index, Message: m[2]})
+		}
+	}
+	return result, nil
+}
+
+// Restore discards changes of paths in the working tree, or unstages them.
+func (r *Runner) Restore(ctx context.Context, args RestoreArgs) (RestoreResult, error) {
+	if len(args.Paths) == 0 {
+		return RestoreResult{}, fmt.Errorf("no paths given")
+	}
+	specs, err := pathspecs(ctx, args.Paths)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	cmdArgs := []string{"restore"}
+	if args.Staged {
+		cmdArgs = append(cmdArgs, "--staged")
+	}
+	if args.Source != "" {
+		if err := checkRevision(args.Source); err != nil {
+			return RestoreResult{}, err
+		}
+		cmdArgs = append(cmdArgs, "--source="+args.Source)
+	}
+	if _, err := r.checkBranch(ctx); err != nil {
+		return RestoreResult{}, err
+	}
+
+	// Unstaging leaves the working tree alone; otherwise list the files before they change
+	var files []string
+	if !args.Staged {
+		diffArgs := []string{"diff", "--name-only", "-z", "--relative"}
+		if args.Source != "" {
+			diffArgs = append(diffArgs, args.Source)
+		}
+		if files, err = r.listFiles(ctx, append(append(diffArgs, "--"), specs...)...); err != nil {
+			return RestoreResult{}, err
+		}
+	}
+	if _, err := r.git(ctx, append(append(cmdArgs, "--"), specs...)...); err != nil {
+		return RestoreResult{}, err
+	}
+	status, err := r.Status(ctx, StatusArgs{})
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	return RestoreResult{StatusResult: status, Files: files}, nil
+}
+
+// listFiles runs a git command printing NUL-separated file names, like `diff --name-only -z`,
+// and returns the names.
+func (r *Runner) listFiles(ctx context.Context, args ...string) ([]string, error) {
+	out, err := r.git(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range strings.Split(out, "\x00") {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
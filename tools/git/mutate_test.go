@@ -0,0 +1,133 @@
+package git
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommitWorkflow(t *testing.T) {
+	setupRepo(t, map[string]string{"a.txt": "a\n"})
+	runner := NewRunner()
+	runner.CoAuthor = "Pair <pair@example.com>"
+	ctx := context.Background()
+
+	writeFiles(t, map[string]string{"a.txt": "changed\n", "b.txt": "new\n"})
+	if _, err := runner.Add(ctx, AddArgs{Paths: []string{"."}}); err == nil || !strings.Contains(err.Error(), "protected") {
+		t.Fatalf("Expected protected branch to be refused, got %v", err)
+	}
+	if _, err := runner.BranchSwitch(ctx, BranchSwitchArgs{Name: "master"}); err == nil {
+		t.Errorf("Expected switch to protected branch to be refused")
+	}
+
+	branch, err := runner.BranchCreate(ctx, BranchCreateArgs{Name: "feature/x", Switch: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if branch.Current != "feature/x" || branch.Commit == "" {
+		t.Errorf("Unexpected branch: %+v", branch)
+	}
+
+	status, err := runner.Add(ctx, AddArgs{Paths: []string{"b.txt"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(status.Staged, []FileStatus{{Path: "b.txt", Status: "added"}}) {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	if _, err := runner.Commit(ctx, CommitArgs{Message: " "}); err == nil {
+		t.Errorf("Expected empty message to be refused")
+	}
+	result, err := runner.Commit(ctx, CommitArgs{Message: "Add b"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Branch != "feature/x" || result.Commit.Subject != "Add b" || !strings.Contains(result.Commit.Body, "Co-authored-by: Pair <pair@example.com>") {
+		t.Errorf("Unexpected commit: %+v", result)
+	}
+	if !reflect.DeepEqual(result.Files, []DiffStat{{Path: "b.txt", Added: 1}}) {
+		t.Errorf("Unexpected files: %+v", result.Files)
+	}
+
+	// a.txt is still modified
+	stash, err := runner.Stash(ctx, StashArgs{Message: "wip"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stash.Stashes) != 1 || !strings.Contains(stash.Stashes[0].Message, "wip") || !reflect.DeepEqual(stash.Files, []string{"a.txt"}) {
+		t.Errorf("Unexpected stashes: %+v", stash)
+	}
+	if data, _ := os.ReadFile("a.txt"); string(data) != "a\n" {
+		t.Errorf("Expected changes to be stashed, got %q", data)
+	}
+	if stash, err = runner.Stash(ctx, StashArgs{Action: "pop"}); err != nil || len(stash.Stashes) != 0 || !reflect.DeepEqual(stash.Files, []string{"a.txt"}) {
+		t.Errorf("Unexpected result of pop: %+v (%v)", stash, err)
+	}
+
+	restored, err := runner.Restore(ctx, RestoreArgs{Paths: []string{"a.txt"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !restored.Clean || !reflect.DeepEqual(restored.Files, []string{"a.txt"}) {
+		t.Errorf("Expected clean working tree, got %+v", restored)
+	}
+
+	other, err := runner.BranchCreate(ctx, BranchCreateArgs{Name: "other", StartPoint: "HEAD~1"})
+	if err != nil || other.Current != "feature/x" {
+		t.Fatalf("Unexpected result: %+v (%v)", other, err)
+	}
+	if switched, err := runner.BranchSwitch(ctx, BranchSwitchArgs{Name: "other"}); err != nil || switched.Current != "other" {
+		t.Errorf("Unexpected result: %+v (%v)", switched, err)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	setupRepo(t, map[string]string{"a.txt": "a\n"})
+	writeFiles(t, map[string]string{".git/hooks/pre-commit": "#!/bin/sh\necho hooked > hooked.txt\nexit 1\n"})
+	if err := os.Chmod(".git/hooks/pre-commit", 0755); err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRunner()
+	ctx := context.Background()
+	if _, err := runner.BranchCreate(ctx, BranchCreateArgs{Name: "feature/x", Switch: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	writeFiles(t, map[string]string{"a.txt": "changed\n"})
+	if _, err := runner.Add(ctx, AddArgs{Paths: []string{"a.txt"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	runner.Hooks = true
+	if _, err := runner.Commit(ctx, CommitArgs{Message: "Hooked"}); err == nil {
+		t.Fatalf("Expected the failing hook to refuse the commit")
+	}
+	os.Remove("hooked.txt")
+
+	// Hooks are not run by default
+	runner.Hooks = false
+	if _, err := runner.Commit(ctx, CommitArgs{Message: "Not hooked"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat("hooked.txt"); err == nil {
+		t.Errorf("Expected the hook not to run")
+	}
+}
+
+func TestBranchNames(t *testing.T) {
+	setupRepo(t, map[string]string{"a.txt": "a\n"})
+	runner := NewRunner()
+	for _, args := range []BranchCreateArgs{
+		{Name: ""},
+		{Name: "-D"},
+		{Name: "main"},
+		{Name: "a..b"},
+		{Name: "ok", StartPoint: "--orphan"},
+	} {
+		if _, err := runner.BranchCreate(context.Background(), args); err == nil {
+			t.Errorf("Expected error for %+v", args)
+		}
+	}
+}
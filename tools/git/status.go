@@ -0,0 +1,109 @@
+package git
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// statusNames maps the status letters of git status --porcelain=v2 to their names.
+var statusNames = map[byte]string{
+	'A': "added",
+	'M': "modified",
+	'D': "deleted",
+	'R': "renamed",
+	'C': "copied",
+	'T': "type-changed",
+}
+
+// Status returns the branch and the staged, unstaged and untracked files of the working directory.
+func (r *Runner) Status(ctx context.Context, args StatusArgs) (StatusResult, error) {
+	specs, err := pathspecs(ctx, args.Paths)
+	if err != nil {
+		return StatusResult{}, err
+	}
+	if len(specs) == 0 {
+		specs = []string{"."}
+	}
+	prefix, err := r.prefix(ctx)
+	if err != nil {
+		return StatusResult{}, err
+	}
+	out, err := r.git(ctx, append([]string{"status", "--porcelain=v2", "-z", "--branch", "--untracked-files=all", "--"}, specs...)...)
+	if err != nil {
+		return StatusResult{}, err
+	}
+	return parseStatus(out, prefix), nil
+}
+
+// parseStatus parses the output of `git status --porcelain=v2 -z --branch`. Paths are made
+// relative to the working directory by removing prefix.
+func parseStatus(out, prefix string) StatusResult {
+	result := StatusResult{Staged: []FileStatus{}, Unstaged: []FileStatus{}, Untracked: []string{}}
+	rel := func(p string) string { return strings.TrimPrefix(p, prefix) }
+
+	records := strings.Split(out, "\x00")
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if record == "" {
+			continue
+		}
+		switch record[0] {
+		case '#':
+			fields := strings.Fields(record)
+			if len(fields) < 3 {
+				continue
+			}
+			switch fields[1] {
+			case "branch.oid":
+				if fields[2] != "(initial)" {
+					result.Commit = fields[2]
+				}
+			case "branch.head":
+				if fields[2] != "(detached)" {
+					result.Branch = fields[2]
+				}
+			case "branch.upstream":
+				result.Upstream = fields[2]
+			case "branch.ab":
+				if len(fields) == 4 {
+					result.Ahead, _ = strconv.Atoi(strings.TrimPrefix(fields[2], "+"))
+					result.Behind, _ = strconv.Atoi(strings.TrimPrefix(fields[3], "-"))
+				}
+			}
+		case '1', '2':
+			// 1 XY sub mH mI mW hH hI path
+			// 2 XY sub mH mI mW hH hI Xscore path NUL origPath
+			n := 9
+			if record[0] == '2' {
+				n = 10
+			}
+			fields := strings.SplitN(record, " ", n)
+			if len(fields) < n {
+				continue
+			}
+			path, origPath := rel(fields[n-1]), ""
+			if record[0] == '2' && i+1 < len(records) {
+				i++
+				origPath = rel(records[i])
+			}
+			xy := fields[1]
+			if name, ok := statusNames[xy[0]]; ok {
+				result.Staged = append(result.Staged, FileStatus{Path: path, OrigPath: origPath, Status: name})
+			}
+			if name, ok := statusNames[xy[1]]; ok {
+				// A rename is staged, in the working tree the file is only modified
+				result.Unstaged = append(result.Unstaged, FileStatus{Path: path, Status: name})
+			}
+		case 'u':
+			// u XY sub m1 m2 m3 mW h1 h2 h3 path
+			if fields := strings.SplitN(record, " ", 11); len(fields) == 11 {
+				result.Conflicted = append(result.Conflicted, rel(fields[10]))
+			}
+		case '?':
+			result.Untracked = append(result.Untracked, rel(strings.TrimPrefix(record, "? ")))
+		}
+	}
+	result.Clean = len(result.Staged) == 0 && len(result.Unstaged) == 0 && len(result.Untracked) == 0 && len(result.Conflicted) == 0
+	return result
+}
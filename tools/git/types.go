@@ -0,0 +1,205 @@
+package git
+
+import "github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+
+// StatusArgs are the arguments for the git_status tool.
+type StatusArgs struct {
+	Paths []string `json:"paths,omitempty" jsonschema:"only report these relative paths or directories (default the whole working directory)"`
+}
+
+// FileStatus is a changed file.
+type FileStatus struct {
+	Path     string `json:"path" jsonschema:"the path relative to the working directory"`
+	OrigPath string `json:"orig_path,omitempty" jsonschema:"the path before a rename or copy"`
+	Status   string `json:"status" jsonschema:"added, modified, deleted, renamed, copied or type-changed"`
+}
+
+// StatusResult is the result of the git_status tool.
+type StatusResult struct {
+	Branch     string       `json:"branch" jsonschema:"the current branch, empty if HEAD is detached"`
+	Commit     string       `json:"commit,omitempty" jsonschema:"the commit of HEAD, empty before the first commit"`
+	Upstream   string       `json:"upstream,omitempty" jsonschema:"the upstream branch, if any"`
+	Ahead      int          `json:"ahead,omitempty" jsonschema:"the number of commits not in the upstream branch"`
+	Behind     int          `json:"behind,omitempty" jsonschema:"the number of commits of the upstream branch not in the current branch"`
+	Staged     []FileStatus `json:"staged" jsonschema:"changes in the index, which will be committed"`
+	Unstaged   []FileStatus `json:"unstaged" jsonschema:"changes in the working tree which are not staged"`
+	Untracked  []string     `json:"untracked" jsonschema:"files not tracked by git and not ignored"`
+	Conflicted []string     `json:"conflicted,omitempty" jsonschema:"files with unresolved merge conflicts"`
+	Clean      bool         `json:"clean" jsonschema:"indicates whether there are no changes at all"`
+}
+
+// DiffArgs are the arguments for the git_diff tool.
+type DiffArgs struct {
+	Staged   bool     `json:"staged,omitempty" jsonschema:"show the staged changes (index against from, default HEAD) instead of the working tree"`
+	From     string   `json:"from,omitempty" jsonschema:"the revision to compare against, e.g. HEAD~3 or main; by default the index, or HEAD if staged is set"`
+	To       string   `json:"to,omitempty" jsonschema:"the revision to compare from with; requires from. By default the working tree or index"`
+	Paths    []string `json:"paths,omitempty" jsonschema:"only show changes of these relative paths or directories"`
+	MaxBytes int      `json:"max_bytes,omitempty" jsonschema:"the maximum size of the returned patch (default 64 KiB); larger patches are shortened in the middle"`
+}
+
+// DiffStat counts the changed lines of a file.
+type DiffStat struct {
+	Path     string `json:"path" jsonschema:"the path relative to the working directory"`
+	OrigPath string `json:"orig_path,omitempty" jsonschema:"the path before a rename or copy"`
+	Added    int    `json:"added" jsonschema:"the number of added lines"`
+	Deleted  int    `json:"deleted" jsonschema:"the number of deleted lines"`
+	Binary   bool   `json:"binary,omitempty" jsonschema:"indicates whether the file is binary, so no lines are counted"`
+}
+
+// DiffResult is the result of the git_diff tool.
+type DiffResult struct {
+	Files     []DiffStat `json:"files" jsonschema:"the changed files"`
+	Patch     string     `json:"patch" jsonschema:"the changes in unified diff format"`
+	Truncated bool       `json:"truncated,omitempty" jsonschema:"indicates whether the patch was shortened; narrow it down with paths"`
+}
+
+// ShowArgs are the arguments for the git_show tool.
+type ShowArgs struct {
+	Revision string `json:"revision,omitempty" jsonschema:"the commit to show, e.g. HEAD~1 or a commit hash (default HEAD)"`
+	Path     string `json:"path,omitempty" jsonschema:"if set, return the content of this relative file path at the revision instead of the commit"`
+	MaxBytes int    `json:"max_bytes,omitempty" jsonschema:"the maximum size of the returned patch or content (default 64 KiB)"`
+}
+
+// Commit describes a commit.
+type Commit struct {
+	Hash       string   `json:"hash"`
+	Parents    []string `json:"parents,omitempty"`
+	Author     string   `json:"author" jsonschema:"the name and email address of the author"`
+	AuthorDate string   `json:"author_date" jsonschema:"the author date in RFC 3339 format"`
+	Committer  string   `json:"committer,omitempty" jsonschema:"the name and email address of the committer, if different from the author"`
+	CommitDate string   `json:"commit_date" jsonschema:"the commit date in RFC 3339 format"`
+	Subject    string   `json:"subject" jsonschema:"the first line of the message"`
+	Body       string   `json:"body,omitempty" jsonschema:"the rest of the message"`
+}
+
+// ShowResult is the result of the git_show tool.
+type ShowResult struct {
+	Commit    *Commit    `json:"commit,omitempty" jsonschema:"the commit, unless a path was given"`
+	Files     []DiffStat `json:"files,omitempty" jsonschema:"the files changed by the commit"`
+	Patch     string     `json:"patch,omitempty" jsonschema:"the changes of the commit in unified diff format"`
+	Content   string     `json:"content,omitempty" jsonschema:"the content of the file at the revision, if a path was given"`
+	Truncated bool       `json:"truncated,omitempty" jsonschema:"indicates whether patch or content were shortened"`
+}
+
+// AddArgs are the arguments for the git_add tool.
+type AddArgs struct {
+	Paths []string `json:"paths" jsonschema:"the relative paths or directories to stage, e.g. [\".\"] for all changes"`
+}
+
+// CommitArgs are the arguments for the git_commit tool.
+type CommitArgs struct {
+	Message string `json:"message" jsonschema:"the commit message: a short subject line, optionally followed by an empty line and a body"`
+}
+
+// CommitResult is the result of the git_commit tool.
+type CommitResult struct {
+	Branch string     `json:"branch" jsonschema:"the branch the commit was added to"`
+	Commit Commit     `json:"commit" jsonschema:"the new commit"`
+	Files  []DiffStat `json:"files" jsonschema:"the files changed by the commit"`
+}
+
+// BranchCreateArgs are the arguments for the git_branch_create tool.
+type BranchCreateArgs struct {
+	Name       string `json:"name" jsonschema:"the name of the new branch"`
+	StartPoint string `json:"start_point,omitempty" jsonschema:"the revision the branch starts at (default HEAD)"`
+	Switch     bool   `json:"switch,omitempty" jsonschema:"switch to the new branch, keeping uncommitted changes"`
+}
+
+// BranchSwitchArgs are the arguments for the git_branch_switch tool.
+type BranchSwitchArgs struct {
+	Name string `json:"name" jsonschema:"the existing branch to switch to; uncommitted changes are kept, git refuses to switch if they conflict"`
+}
+
+// BranchResult is the result of the git_branch_create and git_branch_switch tools.
+type BranchResult struct {
+	Branch  string `json:"branch" jsonschema:"the created or current branch"`
+	Commit  string `json:"commit" jsonschema:"the commit the branch points to"`
+	Current string `json:"current" jsonschema:"the current branch after the call"`
+}
+
+// StashArgs are the arguments for the git_stash tool.
+type StashArgs struct {
+	Action           string `json:"action,omitempty" jsonschema:"push (default) saves and removes the uncommitted changes, pop re-applies and removes the latest or given stash, apply re-applies it, list shows the stashes"`
+	Message          string `json:"message,omitempty" jsonschema:"the description of the stash (push only)"`
+	IncludeUntracked bool   `json:"include_untracked,omitempty" jsonschema:"stash untracked files too (push only)"`
+	Index            int    `json:"index,omitempty" jsonschema:"the stash to pop or apply, 0 is the latest"`
+}
+
+// Stash is an entry of the stash list.
+type Stash struct {
+	Index   int    `json:"index"`
+	Message string `json:"message"`
+}
+
+// StashResult is the result of the git_stash tool.
+type StashResult struct {
+	Stashes []Stash  `json:"stashes" jsonschema:"the stashes after the call, the latest first"`
+	Files   []string `json:"files,omitempty" jsonschema:"the files changed in the working tree, relative to the working directory"`
+	Output  string   `json:"output,omitempty" jsonschema:"the output of git, e.g. conflicts when re-applying a stash"`
+}
+
+// RestoreArgs are the arguments for the git_restore tool.
+type RestoreArgs struct {
+	Paths  []string `json:"paths" jsonschema:"the relative paths or directories to restore"`
+	Staged bool     `json:"staged,omitempty" jsonschema:"unstage the paths, keeping the changes in the working tree; otherwise the changes in the working tree are discarded"`
+	Source string   `json:"source,omitempty" jsonschema:"restore the content from this revision instead of the index (or HEAD if staged is set)"`
+}
+
+// RestoreResult is the result of the git_restore tool.
+type RestoreResult struct {
+	StatusResult
+	Files []string `json:"files,omitempty" jsonschema:"the files changed in the working tree, relative to the working directory"`
+}
+
+// LogArgs are the arguments for the git_log tool.
+type LogArgs struct {
+	Revision string   `json:"revision,omitempty" jsonschema:"the revision or range to list, e.g. main..HEAD (default HEAD)"`
+	Paths    []string `json:"paths,omitempty" jsonschema:"only list commits changing these relative paths or directories"`
+	Author   string   `json:"author,omitempty" jsonschema:"only list commits whose author name or email matches this regular expression"`
+	Since    string   `json:"since,omitempty" jsonschema:"only list commits more recent than this date, e.g. 2024-05-01 or '2 weeks ago'"`
+	Limit    int      `json:"limit,omitempty" jsonschema:"the maximum number of commits (default 20, at most 200)"`
+}
+
+// LogResult is the result of the git_log tool.
+type LogResult struct {
+	Commits []Commit `json:"commits" jsonschema:"the commits, the most recent first"`
+	More    bool     `json:"more,omitempty" jsonschema:"indicates whether there are more commits than the limit"`
+}
+
+// BlameArgs are the arguments for the git_blame tool.
+type BlameArgs struct {
+	Path      string `json:"path" jsonschema:"the relative path of the file"`
+	StartLine int    `json:"start_line,omitempty" jsonschema:"the first line to annotate (default 1)"`
+	EndLine   int    `json:"end_line,omitempty" jsonschema:"the last line to annotate (default start_line + 99); at most 500 lines are annotated"`
+	Revision  string `json:"revision,omitempty" jsonschema:"annotate the file as of this revision instead of the working tree"`
+}
+
+// BlameLine tells which commit last changed a line.
+type BlameLine struct {
+	Line    int    `json:"line" jsonschema:"the line number"`
+	Hash    string `json:"hash" jsonschema:"the commit which last changed the line, all zeros if it is not committed yet"`
+	Author  string `json:"author" jsonschema:"the name and email address of the author"`
+	Date    string `json:"date" jsonschema:"the author date in RFC 3339 format"`
+	Summary string `json:"summary" jsonschema:"the subject of the commit"`
+	Text    string `json:"text" jsonschema:"the content of the line"`
+}
+
+// BlameResult is the result of the git_blame tool.
+type BlameResult struct {
+	Lines []BlameLine `json:"lines"`
+}
+
+// GrepArgs are the arguments for the git_grep tool.
+type GrepArgs struct {
+	Pattern    string   `json:"pattern" jsonschema:"the extended regular expression to search for"`
+	Revision   string   `json:"revision,omitempty" jsonschema:"search the files of this revision instead of the tracked files in the working tree"`
+	Paths      []string `json:"paths,omitempty" jsonschema:"only search these relative paths or directories"`
+	IgnoreCase bool     `json:"ignore_case,omitempty" jsonschema:"match case-insensitively"`
+	MaxResults int      `json:"max_results,omitempty" jsonschema:"the maximum number of matching lines (default 200, at most 1000)"`
+}
+
+// GrepResult is the result of the git_grep tool.
+type GrepResult struct {
+	Matches   map[string][]filesystem.Match `json:"matches" jsonschema:"a map of file paths to a list of matches, each containing the line number and the matching line"`
+	Truncated bool                          `json:"truncated,omitempty" jsonschema:"indicates whether there are more matches than max_results"`
+}
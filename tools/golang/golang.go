@@ -0,0 +1,134 @@
+// Package golang runs the go command on the working directory and turns its
+// output into structured results.
+package golang
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"go/build"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seb-schulz/mcpilot-pair/internal/output"
+	"github.com/seb-schulz/mcpilot-pair/internal/runner"
+	"github.com/seb-schulz/mcpilot-pair/internal/sandbox"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+// DefaultTimeout is the time a go command may take unless configured otherwise.
+const DefaultTimeout = 10 * time.Minute
+
+// outputLimits caps the output kept per test or package.
+var outputLimits = output.Limits{MaxBytes: 8 << 10, MaxLines: 100}
+
+// locationPattern matches file positions in compiler errors, t.Errorf output and stack traces.
+var locationPattern = regexp.MustCompile(`(?m)^\s*([^\s:]+\.go):(\d+)(?::(\d+))?`)
+
+// Runner runs the go command.
+type Runner struct {
+	// Timeout is the maximum duration of a go command. Calls may ask for a shorter one.
+	Timeout time.Duration
+	// Env decides the environment of the go command.
+	Env runner.EnvPolicy
+	// Sandbox confines the go command if not nil.
+	Sandbox *sandbox.Config
+}
+
+// NewRunner returns a Runner with the default timeout and environment.
+func NewRunner() *Runner {
+	return &Runner{Timeout: DefaultTimeout, Env: runner.DefaultEnvPolicy()}
+}
+
+// timeout returns the timeout of a run, limited to the configured one.
+func (r *Runner) timeout(seconds int) time.Duration {
+	timeout := cmp.Or(r.Timeout, DefaultTimeout)
+	if requested := time.Duration(seconds) * time.Second; requested > 0 && requested < timeout {
+		return requested
+	}
+	return timeout
+}
+
+// checkPatterns makes sure that package patterns are not taken as flags by the go command
+// and that patterns naming directories stay inside the working directory. Relative patterns
+// are relative to dir, the directory the go command runs in.
+func checkPatterns(ctx context.Context, dir string, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return []string{"./..."}, nil
+	}
+	for _, p := range patterns {
+		if p == "" || strings.HasPrefix(p, "-") || filepath.IsAbs(p) {
+			return nil, fmt.Errorf("invalid package pattern '%s'", p)
+		}
+		if !build.IsLocalImport(p) {
+			continue
+		}
+		// The directory part ends before the first wildcard
+		parts := strings.Split(p, "/")
+		if i := slices.IndexFunc(parts, func(part string) bool { return strings.Contains(part, "...") }); i >= 0 {
+			parts = parts[:i]
+		}
+		if _, err := filesystem.ResolveDirectory(ctx, filepath.Join(dir, filepath.FromSlash(strings.Join(parts, "/")))); err != nil {
+			return nil, fmt.Errorf("invalid package pattern '%s': %v", p, err)
+		}
+	}
+	return patterns, nil
+}
+
+// workRoots returns the working directory of ctx, as it is and with symlinks resolved.
+func workRoots(ctx context.Context) []string {
+	// go prints paths below the working directory as it is, which may be a symlink
+	var roots []string
+	if wd, err := filesystem.Root(ctx); err == nil {
+		roots = append(roots, wd)
+	}
+	if root, err := filesystem.ResolvePath(ctx, "."); err == nil {
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// locations extracts the source positions mentioned in text. Positions outside the
+// working directory roots, like the standard library in stack traces, are left out.
+func locations(roots []string, text string) []Location {
+	seen := make(map[Location]bool)
+	var result []Location
+	for _, m := range locationPattern.FindAllStringSubmatch(text, -1) {
+		file := m[1]
+		if filepath.IsAbs(file) {
+			rel, ok := relativeTo(roots, file)
+			if !ok {
+				continue
+			}
+			file = rel
+		}
+		loc := Location{File: filepath.ToSlash(file)}
+		loc.Line, _ = strconv.Atoi(m[2])
+		loc.Column, _ = strconv.Atoi(m[3])
+		if !seen[loc] {
+			seen[loc] = true
+			result = append(result, loc)
+		}
+	}
+	return result
+}
+
+// relativeTo returns file relative to the first root containing it.
+func relativeTo(roots []string, file string) (string, bool) {
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, file); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return rel, true
+		}
+	}
+	return "", false
+}
+
+// shorten caps text to the output limits.
+func shorten(text string) string {
+	text, _ = outputLimits.Truncate(text, "")
+	return text
+}
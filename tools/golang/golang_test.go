@@ -0,0 +1,170 @@
+package golang
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// setupModule creates a temporary Go module from files and changes into it.
+func setupModule(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	oldwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current working directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(oldwd) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change working directory: %v", err)
+	}
+
+	files["go.mod"] = "module example.com/m\n\ngo 1.22\n"
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+}
+
+func TestTest(t *testing.T) {
+	setupModule(t, map[string]string{
+		"a/a_test.go": `package a
+
+import "testing"
+
+func TestOK(t *testing.T) {}
+
+func TestBad(t *testing.T) {
+	t.Errorf("got %d", 1)
+	t.Run("sub", func(t *testing.T) { t.Skip("later") })
+}
+
+func TestPanic(t *testing.T) {
+	var m map[string]int
+	m["x"] = 1
+}
+`,
+		"b/b.go":      "package b\n\nfunc F() { undefined() }\n",
+		"b/b_test.go": "package b\n\nimport \"testing\"\n\nfunc TestB(t *testing.T) {}\n",
+		"c/c.go":      "package c\n",
+	})
+
+	result, err := NewRunner().Test(context.Background(), TestArgs{}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Success || result.Summary != (TestSummary{Passed: 1, Failed: 2, Skipped: 1}) {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	tests := make(map[string]TestCase)
+	for _, tc := range result.Tests {
+		tests[tc.Name] = tc
+	}
+	if tc := tests["TestOK"]; tc.Status != "pass" || tc.Output != "" || tc.Package != "example.com/m/a" {
+		t.Errorf("Unexpected test: %+v", tc)
+	}
+	if tc := tests["TestBad"]; tc.Status != "fail" || tc.Output != "    a_test.go:8: got 1\n" || len(tc.Locations) != 1 || tc.Locations[0] != (Location{File: "a_test.go", Line: 8}) {
+		t.Errorf("Unexpected test: %+v", tc)
+	}
+	if tc := tests["TestBad/sub"]; tc.Status != "skip" {
+		t.Errorf("Unexpected test: %+v", tc)
+	}
+	if tc := tests["TestPanic"]; tc.Status != "fail" || len(tc.Locations) != 1 || tc.Locations[0] != (Location{File: "a/a_test.go", Line: 14}) {
+		t.Errorf("Unexpected test: %+v", tc)
+	}
+
+	packages := make(map[string]PackageResult)
+	for _, p := range result.Packages {
+		packages[p.Package] = p
+	}
+	if p := packages["example.com/m/a"]; p.Status != "fail" {
+		t.Errorf("Unexpected package: %+v", p)
+	}
+	if p := packages["example.com/m/b"]; p.Status != "build-fail" || len(p.Locations) != 1 || p.Locations[0] != (Location{File: "b/b.go", Line: 3, Column: 12}) {
+		t.Errorf("Unexpected package: %+v", p)
+	}
+	if p := packages["example.com/m/c"]; p.Status != "skip" {
+		t.Errorf("Unexpected package: %+v", p)
+	}
+}
+
+func TestTestArguments(t *testing.T) {
+	setupModule(t, map[string]string{
+		"a/a_test.go": "package a\n\nimport \"testing\"\n\nfunc TestOne(t *testing.T) {}\n\nfunc TestTwo(t *testing.T) {}\n",
+	})
+
+	result, err := NewRunner().Test(context.Background(), TestArgs{Packages: []string{"./a"}, Run: "^TestTwo$"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Success || len(result.Tests) != 1 || result.Tests[0].Name != "TestTwo" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	for _, args := range []TestArgs{
+		{Packages: []string{"-exec=touch pwned"}},
+		{Run: "("},
+		{Directory: ".."},
+	} {
+		if _, err := NewRunner().Test(context.Background(), args, nil); err == nil {
+			t.Errorf("Expected error for %+v", args)
+		}
+	}
+}
+
+// hostilePatterns are package patterns which must not reach the go command.
+var hostilePatterns = []struct {
+	name    string
+	pattern string
+}{
+	{"Empty pattern", ""},
+	{"Flag as pattern", "-exec=touch pwned"},
+	{"Absolute path", "/"},
+	{"Absolute path of the standard library", filepath.Join(runtime.GOROOT(), "src", "fmt")},
+	{"Parent directory", ".."},
+	{"Packages below the parent directory", "../..."},
+	{"Path traversal", "./a/../../a"},
+	{"Hidden directory", "./.git"},
+	{"Missing directory", "./missing/..."},
+}
+
+func TestTestHostilePatterns(t *testing.T) {
+	setupModule(t, map[string]string{
+		"a/a_test.go": "package a\n\nimport \"testing\"\n\nfunc TestOne(t *testing.T) {}\n",
+	})
+	os.Mkdir(".git", 0755)
+
+	for _, tc := range hostilePatterns {
+		t.Run(tc.name, func(t *testing.T) {
+			args := TestArgs{Packages: []string{"./a", tc.pattern}}
+			if _, err := NewRunner().Test(context.Background(), args, nil); err == nil || !strings.Contains(err.Error(), "invalid package pattern") {
+				t.Errorf("Expected pattern %q to be rejected, got %v", tc.pattern, err)
+			}
+			if _, err := DescribeTest(context.Background(), args); err == nil {
+				t.Errorf("Expected pattern %q to be rejected in the description", tc.pattern)
+			}
+		})
+	}
+
+	// Patterns are relative to the directory of the call
+	if _, err := checkPatterns(context.Background(), mustAbs(t, "a"), []string{"..", "../...", ".", "example.com/m/a", "fmt"}); err != nil {
+		t.Errorf("Unexpected error for patterns inside the working directory: %v", err)
+	}
+}
+
+func mustAbs(t *testing.T, path string) string {
+	t.Helper()
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abs
+}
@@ -0,0 +1,282 @@
+package golang
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/seb-schulz/mcpilot-pair/internal/runner"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+// testEvent is an event of `go test -json`, see `go doc test2json`.
+type testEvent struct {
+	Time        time.Time
+	Action      string
+	Package     string
+	Test        string
+	Elapsed     float64
+	Output      string
+	ImportPath  string
+	FailedBuild string
+}
+
+// Test runs `go test -json` in the directory and returns the result per package and test.
+// If output is not nil, it receives the output of the tests line by line while they are running.
+func (r *Runner) Test(ctx context.Context, args TestArgs, output func(stream, line string)) (TestResult, error) {
+	dir, err := filesystem.ResolveDirectory(ctx, args.Directory)
+	if err != nil {
+		return TestResult{}, err
+	}
+	cmdArgs, err := testCommand(ctx, dir, args)
+	if err != nil {
+		return TestResult{}, err
+	}
+
+	env, err := r.Env.Environ(os.Environ(), args.Env)
+	if err != nil {
+		return TestResult{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout(args.TimeoutSeconds))
+	defer cancel()
+
+	cmd := runner.Command(ctx, "go", cmdArgs...)
+	cmd.Dir = dir
+	cmd.Env = env
+	if err := r.Sandbox.Wrap(cmd); err != nil {
+		return TestResult{}, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// Events are parsed while the tests are running, so their output can be streamed
+	stdout, stdoutWriter := io.Pipe()
+	cmd.Stdout = stdoutWriter
+	parsed := make(chan *testCollector, 1)
+	go func() {
+		c := newTestCollector(workRoots(ctx), output)
+		c.parse(stdout)
+		parsed <- c
+	}()
+	status, err := runner.Run(ctx, cmd)
+	stdoutWriter.Close()
+	c := <-parsed
+	if err != nil {
+		return TestResult{}, err
+	}
+
+	result := c.result()
+	result.ExitCode = status.ExitCode
+	result.TimedOut = status.TimedOut
+	result.Canceled = status.Canceled
+	result.Success = status.ExitCode == 0
+	result.Stderr = shorten(strings.TrimSpace(c.other.String() + stderr.String()))
+	return result, nil
+}
+
+// DescribeTest returns the command line Test runs for args.
+func DescribeTest(ctx context.Context, args TestArgs) (string, error) {
+	dir, err := filesystem.ResolveDirectory(ctx, args.Directory)
+	if err != nil {
+		return "", err
+	}
+	cmdArgs, err := testCommand(ctx, dir, args)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%sgo %s (in %s)", runner.FormatEnv(args.Env), strings.Join(cmdArgs, " "), cmp.Or(args.Directory, ".")), nil
+}
+
+// testCommand returns the arguments of the go command for args, run in dir.
+func testCommand(ctx context.Context, dir string, args TestArgs) ([]string, error) {
+	packages, err := checkPatterns(ctx, dir, args.Packages)
+	if err != nil {
+		return nil, err
+	}
+	cmdArgs := []string{"test", "-json"}
+	if args.Run != "" {
+		if _, err := regexp.Compile(args.Run); err != nil {
+			return nil, fmt.Errorf("invalid run pattern: %v", err)
+		}
+		cmdArgs = append(cmdArgs, "-run="+args.Run)
+	}
+	if args.Short {
+		cmdArgs = append(cmdArgs, "-short")
+	}
+	if args.Race {
+		cmdArgs = append(cmdArgs, "-race")
+	}
+	return append(cmdArgs, packages...), nil
+}
+
+type testKey struct {
+	pkg, test string
+}
+
+// testCollector assembles the events of `go test -json` into results.
+type testCollector struct {
+	output func(stream, line string)
+	roots  []string
+
+	tests     map[testKey]*TestCase
+	testOrder []testKey
+	packages  map[string]*PackageResult
+	pkgOrder  []string
+	outputs   map[testKey]*strings.Builder
+	builds    map[testKey]*strings.Builder
+	other     strings.Builder
+}
+
+func newTestCollector(roots []string, output func(stream, line string)) *testCollector {
+	return &testCollector{
+		output:   output,
+		roots:    roots,
+		tests:    make(map[testKey]*TestCase),
+		packages: make(map[string]*PackageResult),
+		outputs:  make(map[testKey]*strings.Builder),
+		builds:   make(map[testKey]*strings.Builder),
+	}
+}
+
+// parse reads events until r is exhausted. Lines which are no events are kept as other output.
+func (c *testCollector) parse(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var e testEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Action == "" {
+			c.other.Write(scanner.Bytes())
+			c.other.WriteByte('\n')
+			continue
+		}
+		c.handle(e)
+	}
+	// Drain the pipe, so go does not block on a full pipe
+	io.Copy(io.Discard, r)
+}
+
+func (c *testCollector) handle(e testEvent) {
+	switch e.Action {
+	case "build-output":
+		pkg := strings.SplitN(e.ImportPath, " ", 2)[0]
+		c.builder(c.builds, testKey{pkg: pkg}).WriteString(e.Output)
+		c.emit(e.Output)
+		return
+	case "output":
+		c.emit(e.Output)
+		// Frames like "=== RUN" carry no information beyond the events
+		if isFrame(e.Output) {
+			return
+		}
+		c.builder(c.outputs, testKey{e.Package, e.Test}).WriteString(e.Output)
+		return
+	case "run":
+		c.test(e.Package, e.Test)
+		return
+	case "pass", "fail", "skip":
+	default:
+		return
+	}
+
+	if e.Test != "" {
+		t := c.test(e.Package, e.Test)
+		t.Status, t.Elapsed = e.Action, e.Elapsed
+		return
+	}
+	p := c.pkg(e.Package)
+	p.Status, p.Elapsed = e.Action, e.Elapsed
+	if e.FailedBuild != "" {
+		p.Status = "build-fail"
+	}
+}
+
+func (c *testCollector) emit(text string) {
+	if c.output != nil {
+		c.output("stdout", strings.TrimSuffix(text, "\n"))
+	}
+}
+
+func (c *testCollector) builder(m map[testKey]*strings.Builder, key testKey) *strings.Builder {
+	b, ok := m[key]
+	if !ok {
+		b = &strings.Builder{}
+		m[key] = b
+	}
+	return b
+}
+
+func (c *testCollector) test(pkg, name string) *TestCase {
+	key := testKey{pkg, name}
+	t, ok := c.tests[key]
+	if !ok {
+		t = &TestCase{Package: pkg, Name: name, Status: "incomplete"}
+		c.tests[key] = t
+		c.testOrder = append(c.testOrder, key)
+	}
+	return t
+}
+
+func (c *testCollector) pkg(name string) *PackageResult {
+	p, ok := c.packages[name]
+	if !ok {
+		p = &PackageResult{Package: name, Status: "incomplete"}
+		c.packages[name] = p
+		c.pkgOrder = append(c.pkgOrder, name)
+	}
+	return p
+}
+
+func (c *testCollector) result() TestResult {
+	result := TestResult{Packages: []PackageResult{}, Tests: []TestCase{}}
+	for _, key := range c.testOrder {
+		t := *c.tests[key]
+		switch t.Status {
+		case "pass":
+			result.Summary.Passed++
+		case "skip":
+			result.Summary.Skipped++
+		default:
+			result.Summary.Failed++
+		}
+		if t.Status != "pass" {
+			if out, ok := c.outputs[key]; ok {
+				t.Output = shorten(out.String())
+				t.Locations = locations(c.roots, out.String())
+			}
+		}
+		result.Tests = append(result.Tests, t)
+	}
+	for _, name := range c.pkgOrder {
+		p := *c.packages[name]
+		if p.Status != "pass" && p.Status != "skip" {
+			var text string
+			for _, m := range []map[testKey]*strings.Builder{c.builds, c.outputs} {
+				if out, ok := m[testKey{pkg: name}]; ok {
+					text += out.String()
+				}
+			}
+			p.Output = shorten(text)
+			p.Locations = locations(c.roots, text)
+		}
+		result.Packages = append(result.Packages, p)
+	}
+	return result
+}
+
+// isFrame reports whether a line of test output is a frame printed by the testing package.
+func isFrame(line string) bool {
+	for _, prefix := range []string{"=== RUN", "=== PAUSE", "=== CONT", "=== NAME", "--- PASS", "--- SKIP", "--- FAIL", "PASS\n", "FAIL\n", "ok  \t", "FAIL\t", "?   \t"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
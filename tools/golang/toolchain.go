@@ -0,0 +1,297 @@
+package golang
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"go/scanner"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/seb-schulz/mcpilot-pair/internal/runner"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+// diagnosticPattern matches diagnostics like "a/a.go:3:12: undefined: x", optionally prefixed by "vet: ".
+var diagnosticPattern = regexp.MustCompile(`^(?:vet: )?([^\s:]+\.go):(\d+)(?::(\d+))?: (.*)$`)
+
+// run runs the go command in dir with the additional variables of env and returns its output.
+func (r *Runner) run(ctx context.Context, dir string, timeoutSeconds int, env map[string]string, args ...string) (stdout, stderr string, status runner.Status, err error) {
+	environ, err := r.Env.Environ(os.Environ(), env)
+	if err != nil {
+		return "", "", runner.Status{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout(timeoutSeconds))
+	defer cancel()
+
+	cmd := runner.Command(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = environ
+	if err := r.Sandbox.Wrap(cmd); err != nil {
+		return "", "", runner.Status{}, err
+	}
+	var stdoutBuf, stderrBuf bytes.Buffer
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
+	status, err = runner.Run(ctx, cmd)
+	return stdoutBuf.String(), stderrBuf.String(), status, err
+}
+
+// check runs a go command reporting diagnostics on stderr.
+func (r *Runner) check(ctx context.Context, args PackagesArgs, goArgs ...string) (CheckResult, error) {
+	dir, err := filesystem.ResolveDirectory(ctx, args.Directory)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	packages, err := checkPatterns(ctx, dir, args.Packages)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	stdout, stderr, status, err := r.run(ctx, dir, args.TimeoutSeconds, args.Env, append(goArgs, packages...)...)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	return newCheckResult(ctx, status, dir, stdout+stderr), nil
+}
+
+func newCheckResult(ctx context.Context, status runner.Status, dir, out string) CheckResult {
+	diagnostics, rest := parseDiagnostics(ctx, dir, out)
+	return CheckResult{
+		Success:     status.ExitCode == 0,
+		ExitCode:    status.ExitCode,
+		TimedOut:    status.TimedOut,
+		Canceled:    status.Canceled,
+		Diagnostics: diagnostics,
+		Output:      shorten(rest),
+	}
+}
+
+// Build compiles the packages without keeping the results.
+func (r *Runner) Build(ctx context.Context, args PackagesArgs) (CheckResult, error) {
+	return r.check(ctx, args, "build", "-o", os.DevNull)
+}
+
+// Vet runs go vet on the packages.
+func (r *Runner) Vet(ctx context.Context, args PackagesArgs) (CheckResult, error) {
+	return r.check(ctx, args, "vet")
+}
+
+// ModTidy runs go mod tidy on the module in the directory, or go mod tidy -diff when only checking.
+func (r *Runner) ModTidy(ctx context.Context, args ModTidyArgs) (ModTidyResult, error) {
+	dir, err := filesystem.ResolveDirectory(ctx, args.Directory)
+	if err != nil {
+		return ModTidyResult{}, err
+	}
+	if args.Check {
+		stdout, stderr, status, err := r.run(ctx, dir, args.TimeoutSeconds, nil, "mod", "tidy", "-diff")
+		if err != nil {
+			return ModTidyResult{}, err
+		}
+		// go mod tidy -diff fails if there are changes
+		return ModTidyResult{CheckResult: newCheckResult(ctx, status, dir, stderr), Diff: stdout, Changed: stdout != ""}, nil
+	}
+
+	before := readModFiles(dir)
+	_, stderr, status, err := r.run(ctx, dir, args.TimeoutSeconds, nil, "mod", "tidy")
+	if err != nil {
+		return ModTidyResult{}, err
+	}
+	return ModTidyResult{CheckResult: newCheckResult(ctx, status, dir, stderr), Changed: readModFiles(dir) != before}, nil
+}
+
+// readModFiles returns the content of go.mod and go.sum in dir.
+func readModFiles(dir string) string {
+	mod, _ := os.ReadFile(filepath.Join(dir, "go.mod"))
+	sum, _ := os.ReadFile(filepath.Join(dir, "go.sum"))
+	return string(mod) + "\x00" + string(sum)
+}
+
+// goListPackage is the subset of the output of `go list -json` used by List.
+type goListPackage struct {
+	ImportPath   string
+	Name         string
+	Dir          string
+	GoFiles      []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+	Imports      []string
+	Error        *struct{ Err string }
+}
+
+// List returns the packages matching the patterns.
+func (r *Runner) List(ctx context.Context, args PackagesArgs) (ListResult, error) {
+	dir, err := filesystem.ResolveDirectory(ctx, args.Directory)
+	if err != nil {
+		return ListResult{}, err
+	}
+	packages, err := checkPatterns(ctx, dir, args.Packages)
+	if err != nil {
+		return ListResult{}, err
+	}
+	goArgs := append([]string{"list", "-e", "-json=ImportPath,Name,Dir,GoFiles,TestGoFiles,XTestGoFiles,Imports,Error"}, packages...)
+	stdout, stderr, status, err := r.run(ctx, dir, args.TimeoutSeconds, args.Env, goArgs...)
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	result := ListResult{CheckResult: newCheckResult(ctx, status, dir, stderr), Packages: []Package{}}
+	decoder := json.NewDecoder(strings.NewReader(stdout))
+	for {
+		var p goListPackage
+		if err := decoder.Decode(&p); err == io.EOF {
+			break
+		} else if err != nil {
+			return ListResult{}, fmt.Errorf("could not parse go list output: %v", err)
+		}
+		pkg := Package{
+			ImportPath:   p.ImportPath,
+			Name:         p.Name,
+			Dir:          relativePath(dir, p.Dir),
+			GoFiles:      p.GoFiles,
+			TestGoFiles:  p.TestGoFiles,
+			XTestGoFiles: p.XTestGoFiles,
+			Imports:      p.Imports,
+		}
+		if p.Error != nil {
+			pkg.Error = p.Error.Err
+		}
+		result.Packages = append(result.Packages, pkg)
+	}
+	return result, nil
+}
+
+// Fmt reports or rewrites Go files which are not formatted like gofmt does.
+// Directories are walked recursively, skipping hidden directories, vendor and testdata.
+func Fmt(ctx context.Context, args FmtArgs) (FmtResult, error) {
+	paths := args.Paths
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	root, err := filesystem.ResolvePath(ctx, ".")
+	if err != nil {
+		return FmtResult{}, err
+	}
+
+	result := FmtResult{Files: []string{}, Diagnostics: []Diagnostic{}, Applied: args.Apply}
+	for _, p := range paths {
+		resolved, err := filesystem.ResolvePath(ctx, p)
+		if err != nil {
+			return FmtResult{}, err
+		}
+		err = filepath.WalkDir(resolved, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if name := d.Name(); path != resolved && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// Symlinks may point outside of the working directory
+			if !strings.HasSuffix(path, ".go") || strings.HasPrefix(d.Name(), ".") || !d.Type().IsRegular() {
+				return nil
+			}
+			return formatFile(root, path, args.Apply, &result)
+		})
+		if err != nil {
+			return FmtResult{}, err
+		}
+	}
+	return result, nil
+}
+
+// formatFile checks a single file and rewrites it if apply is set.
+func formatFile(root, path string, apply bool, result *FmtResult) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	rel := relativePath(root, path)
+	formatted, err := format.Source(src)
+	if list, ok := err.(scanner.ErrorList); ok {
+		for _, e := range list {
+			result.Diagnostics = append(result.Diagnostics, Diagnostic{File: rel, Line: e.Pos.Line, Column: e.Pos.Column, Message: e.Msg})
+		}
+		return nil
+	} else if err != nil {
+		result.Diagnostics = append(result.Diagnostics, Diagnostic{File: rel, Message: err.Error()})
+		return nil
+	}
+	if bytes.Equal(src, formatted) {
+		return nil
+	}
+	result.Files = append(result.Files, rel)
+	if !apply {
+		return nil
+	}
+	return filesystem.ReplaceFiles(map[string][]byte{path: src}, map[string][]byte{path: formatted})
+}
+
+// parseDiagnostics extracts the diagnostics of the go toolchain from its output. File names
+// relative to dir are turned into paths relative to the working directory. Diagnostics outside
+// the working directory and all other lines are returned as rest.
+func parseDiagnostics(ctx context.Context, dir, out string) ([]Diagnostic, string) {
+	root, err := filesystem.ResolvePath(ctx, ".")
+	if err != nil {
+		return nil, out
+	}
+	diagnostics := []Diagnostic{}
+	var rest strings.Builder
+	inDiagnostic := false
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Indented lines continue the previous diagnostic
+		if inDiagnostic && (strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "    ")) {
+			d := &diagnostics[len(diagnostics)-1]
+			d.Message += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		inDiagnostic = false
+		if strings.HasPrefix(line, "# ") {
+			continue
+		}
+		m := diagnosticPattern.FindStringSubmatch(line)
+		if m == nil {
+			rest.WriteString(line + "\n")
+			continue
+		}
+		file := m[1]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		rel, ok := relativeTo([]string{root}, file)
+		if !ok {
+			rest.WriteString(line + "\n")
+			continue
+		}
+		d := Diagnostic{File: filepath.ToSlash(rel), Message: m[4]}
+		d.Line, _ = strconv.Atoi(m[2])
+		d.Column, _ = strconv.Atoi(m[3])
+		diagnostics = append(diagnostics, d)
+		inDiagnostic = true
+	}
+	return diagnostics, strings.TrimSpace(rest.String())
+}
+
+// relativePath returns path relative to root, or path itself if it is outside of root.
+func relativePath(root, path string) string {
+	if rel, ok := relativeTo([]string{root}, path); ok {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
@@ -0,0 +1,186 @@
+package golang
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildAndVet(t *testing.T) {
+	setupModule(t, map[string]string{
+		"main.go": "package main\n\nfunc main() {}\n",
+		"a/a.go":  "package a\n\nimport \"fmt\"\n\nfunc F() { fmt.Printf(\"%d\", \"x\") }\n",
+		"c/c.go":  "package c\n\nfunc G() {\n\ty\n}\n",
+	})
+	ctx := context.Background()
+
+	build, err := NewRunner().Build(ctx, PackagesArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Diagnostic{{File: "c/c.go", Line: 4, Column: 2, Message: "undefined: y"}}
+	if build.Success || !reflect.DeepEqual(build.Diagnostics, expected) {
+		t.Errorf("Unexpected build result: %+v", build)
+	}
+	if _, err := os.Stat("m"); err == nil {
+		t.Errorf("Build left a binary behind")
+	}
+
+	// Diagnostics are relative to the working directory, not to the package directory
+	build, err = NewRunner().Build(ctx, PackagesArgs{Directory: "c", Packages: []string{"."}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(build.Diagnostics, expected) {
+		t.Errorf("Unexpected build result: %+v", build)
+	}
+
+	vet, err := NewRunner().Vet(ctx, PackagesArgs{Packages: []string{"./a"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if vet.Success || len(vet.Diagnostics) != 1 || vet.Diagnostics[0].File != "a/a.go" || vet.Diagnostics[0].Line != 5 ||
+		!strings.Contains(vet.Diagnostics[0].Message, "wrong type") {
+		t.Errorf("Unexpected vet result: %+v", vet)
+	}
+
+	if _, err := NewRunner().Vet(ctx, PackagesArgs{Packages: []string{"-vettool=/bin/sh"}}); err == nil {
+		t.Errorf("Expected flag as package pattern to be rejected")
+	}
+}
+
+func TestList(t *testing.T) {
+	setupModule(t, map[string]string{
+		"a/a.go":      "package a\n\nimport \"strings\"\n\nvar _ = strings.ToUpper\n",
+		"a/a_test.go": "package a\n",
+	})
+
+	result, err := NewRunner().List(context.Background(), PackagesArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Package{{
+		ImportPath:  "example.com/m/a",
+		Name:        "a",
+		Dir:         "a",
+		GoFiles:     []string{"a.go"},
+		TestGoFiles: []string{"a_test.go"},
+		Imports:     []string{"strings"},
+	}}
+	if !result.Success || !reflect.DeepEqual(result.Packages, expected) {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+}
+
+func TestModTidy(t *testing.T) {
+	setupModule(t, map[string]string{
+		"a/a.go": "package a\n",
+	})
+	// An unused requirement is removed by go mod tidy
+	untidy := "module example.com/m\n\ngo 1.22\n\nrequire example.com/unused v1.0.0\n"
+	os.WriteFile("go.mod", []byte(untidy), 0644)
+	ctx := context.Background()
+
+	check, err := NewRunner().ModTidy(ctx, ModTidyArgs{Check: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !check.Changed || !strings.Contains(check.Diff, "-require example.com/unused v1.0.0") {
+		t.Errorf("Unexpected result: %+v", check)
+	}
+	if data, _ := os.ReadFile("go.mod"); string(data) != untidy {
+		t.Errorf("Check modified go.mod")
+	}
+
+	tidy, err := NewRunner().ModTidy(ctx, ModTidyArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !tidy.Success || !tidy.Changed {
+		t.Errorf("Unexpected result: %+v", tidy)
+	}
+	if data, _ := os.ReadFile("go.mod"); strings.Contains(string(data), "unused") {
+		t.Errorf("go.mod was not tidied:\n%s", data)
+	}
+}
+
+func TestFmt(t *testing.T) {
+	setupModule(t, map[string]string{
+		"ok.go":             "package m\n",
+		"a/ugly.go":         "package a\nfunc  F( ) {}\n",
+		"a/broken.go":       "package a\nfunc {\n",
+		"a/testdata/bad.go": "package  bad\n",
+		"vendor/v/v.go":     "package  v\n",
+	})
+	ctx := context.Background()
+
+	check, err := Fmt(ctx, FmtArgs{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(check.Files, []string{"a/ugly.go"}) || check.Applied {
+		t.Errorf("Unexpected result: %+v", check)
+	}
+	if len(check.Diagnostics) == 0 || check.Diagnostics[0].File != "a/broken.go" || check.Diagnostics[0].Line != 2 {
+		t.Errorf("Unexpected diagnostics: %+v", check.Diagnostics)
+	}
+	if data, _ := os.ReadFile("a/ugly.go"); string(data) != "package a\nfunc  F( ) {}\n" {
+		t.Errorf("Check modified the file")
+	}
+
+	if _, err := Fmt(ctx, FmtArgs{Paths: []string{"a/ugly.go"}, Apply: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile("a/ugly.go"); string(data) != "package a\n\nfunc F() {}\n" {
+		t.Errorf("File was not formatted:\n%s", data)
+	}
+
+	if _, err := Fmt(ctx, FmtArgs{Paths: []string{".."}}); err == nil {
+		t.Errorf("Expected path outside the working directory to be rejected")
+	}
+
+	// Symlinked files are not followed, their target may be outside of the working directory
+	outside := filepath.Join(t.TempDir(), "outside.go")
+	if err := os.WriteFile(outside, []byte("package  outside\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, "a/link.go"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := Fmt(ctx, FmtArgs{Apply: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Files) != 0 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if data, _ := os.ReadFile(outside); string(data) != "package  outside\n" {
+		t.Errorf("The target of a symlink was formatted:\n%s", data)
+	}
+}
+
+func TestHostilePatterns(t *testing.T) {
+	setupModule(t, map[string]string{"a/a.go": "package a\n"})
+	os.Mkdir(".git", 0755)
+	ctx := context.Background()
+	runner := NewRunner()
+
+	for _, tc := range hostilePatterns {
+		t.Run(tc.name, func(t *testing.T) {
+			args := PackagesArgs{Packages: []string{"./a", tc.pattern}}
+			calls := map[string]func() error{
+				"build": func() error { _, err := runner.Build(ctx, args); return err },
+				"vet":   func() error { _, err := runner.Vet(ctx, args); return err },
+				"list":  func() error { _, err := runner.List(ctx, args); return err },
+			}
+			for name, call := range calls {
+				if err := call(); err == nil || !strings.Contains(err.Error(), "invalid package pattern") {
+					t.Errorf("Expected %s to reject pattern %q, got %v", name, tc.pattern, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package golang
+
+// TestArgs are the arguments for the go_test tool.
+type TestArgs struct {
+	Packages       []string          `json:"packages,omitempty" jsonschema:"the package patterns to test (default ./...)"`
+	Run            string            `json:"run,omitempty" jsonschema:"only run tests matching this regular expression, as go test -run"`
+	Short          bool              `json:"short,omitempty" jsonschema:"tell long-running tests to shorten their run time, as go test -short"`
+	Race           bool              `json:"race,omitempty" jsonschema:"enable the race detector, as go test -race"`
+	Directory      string            `json:"directory,omitempty" jsonschema:"The optional relative path of the module to test. If omitted, the root directory is used"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty" jsonschema:"The optional timeout in seconds after which the tests are killed. It cannot exceed the timeout configured on the server"`
+	Env            map[string]string `json:"env,omitempty" jsonschema:"the optional environment variables to set, e.g. {\"GOFLAGS\": \"-v\"}; only variables approved by the server are accepted"`
+}
+
+// Location is a position in a source file mentioned in the output.
+type Location struct {
+	File   string `json:"file" jsonschema:"the file, relative to the working directory if it is inside it, otherwise as printed by go"`
+	Line   int    `json:"line" jsonschema:"the line number"`
+	Column int    `json:"column,omitempty" jsonschema:"the column number, if known"`
+}
+
+// TestCase is the result of a single test or subtest.
+type TestCase struct {
+	Package   string     `json:"package" jsonschema:"the import path of the package"`
+	Name      string     `json:"name" jsonschema:"the name of the test, subtests are separated by /"`
+	Status    string     `json:"status" jsonschema:"pass, fail, skip or incomplete if the test did not finish"`
+	Elapsed   float64    `json:"elapsed" jsonschema:"the duration in seconds"`
+	Output    string     `json:"output,omitempty" jsonschema:"the output of the test, only for failed and skipped tests"`
+	Locations []Location `json:"locations,omitempty" jsonschema:"the source locations mentioned in the output, e.g. of t.Errorf calls and panics"`
+}
+
+// PackageResult is the result of testing a package.
+type PackageResult struct {
+	Package   string     `json:"package" jsonschema:"the import path of the package"`
+	Status    string     `json:"status" jsonschema:"pass, fail, skip (no test files) or build-fail"`
+	Elapsed   float64    `json:"elapsed" jsonschema:"the duration in seconds"`
+	Output    string     `json:"output,omitempty" jsonschema:"build errors and output outside of tests, only for failed packages"`
+	Locations []Location `json:"locations,omitempty" jsonschema:"the source locations mentioned in the output, e.g. of build errors"`
+}
+
+// TestSummary counts the tests by status.
+type TestSummary struct {
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+// TestResult is the result of the go_test tool.
+type TestResult struct {
+	Success  bool            `json:"success" jsonschema:"indicates whether all packages were built and all tests passed"`
+	ExitCode int             `json:"exit_code" jsonschema:"the exit code of go test, -1 if it was killed"`
+	TimedOut bool            `json:"timed_out,omitempty" jsonschema:"indicates whether go test was killed because it exceeded the timeout"`
+	Canceled bool            `json:"canceled,omitempty" jsonschema:"indicates whether go test was killed because the tool call was cancelled"`
+	Summary  TestSummary     `json:"summary" jsonschema:"the number of passed, failed and skipped tests"`
+	Packages []PackageResult `json:"packages" jsonschema:"the result per package"`
+	Tests    []TestCase      `json:"tests" jsonschema:"the result per test, in the order the tests finished"`
+	Stderr   string          `json:"stderr,omitempty" jsonschema:"output of go test which is not part of a test, e.g. errors loading packages"`
+}
+
+// Diagnostic is an error or warning reported by the go toolchain.
+type Diagnostic struct {
+	File    string `json:"file" jsonschema:"the file relative to the working directory"`
+	Line    int    `json:"line" jsonschema:"the line number"`
+	Column  int    `json:"column,omitempty" jsonschema:"the column number, if known"`
+	Message string `json:"message" jsonschema:"the message"`
+}
+
+// PackagesArgs are the arguments for the go_build, go_vet and go_list tools.
+type PackagesArgs struct {
+	Packages       []string          `json:"packages,omitempty" jsonschema:"the package patterns (default ./...)"`
+	Directory      string            `json:"directory,omitempty" jsonschema:"The optional relative path of the module. If omitted, the root directory is used"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty" jsonschema:"The optional timeout in seconds after which the command is killed. It cannot exceed the timeout configured on the server"`
+	Env            map[string]string `json:"env,omitempty" jsonschema:"the optional environment variables to set, e.g. {\"GOFLAGS\": \"-v\"}; only variables approved by the server are accepted"`
+}
+
+// CheckResult is the result of the go_build and go_vet tools.
+type CheckResult struct {
+	Success     bool         `json:"success" jsonschema:"indicates whether the command found no problems"`
+	ExitCode    int          `json:"exit_code" jsonschema:"the exit code of the go command, -1 if it was killed"`
+	TimedOut    bool         `json:"timed_out,omitempty" jsonschema:"indicates whether the command was killed because it exceeded the timeout"`
+	Canceled    bool         `json:"canceled,omitempty" jsonschema:"indicates whether the command was killed because the tool call was cancelled"`
+	Diagnostics []Diagnostic `json:"diagnostics" jsonschema:"the problems found within the working directory"`
+	Output      string       `json:"output,omitempty" jsonschema:"other output of the command, e.g. errors loading packages"`
+}
+
+// FmtArgs are the arguments for the go_fmt tool.
+type FmtArgs struct {
+	Paths []string `json:"paths,omitempty" jsonschema:"the relative paths of Go files or directories to format recursively (default the root directory)"`
+	Apply bool     `json:"apply,omitempty" jsonschema:"rewrite the files; if false, only report which files are not formatted"`
+}
+
+// FmtResult is the result of the go_fmt tool.
+type FmtResult struct {
+	Files       []string     `json:"files" jsonschema:"the files which are not formatted, or which were rewritten if apply is set"`
+	Applied     bool         `json:"applied" jsonschema:"indicates whether the files were rewritten"`
+	Diagnostics []Diagnostic `json:"diagnostics" jsonschema:"syntax errors of files which could not be formatted"`
+}
+
+// ModTidyArgs are the arguments for the go_mod_tidy tool.
+type ModTidyArgs struct {
+	Directory      string `json:"directory,omitempty" jsonschema:"The optional relative path of the module. If omitted, the root directory is used"`
+	Check          bool   `json:"check,omitempty" jsonschema:"only report the changes as diff without modifying go.mod and go.sum"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty" jsonschema:"The optional timeout in seconds after which the command is killed. It cannot exceed the timeout configured on the server"`
+}
+
+// ModTidyResult is the result of the go_mod_tidy tool.
+type ModTidyResult struct {
+	CheckResult
+	Changed bool   `json:"changed" jsonschema:"indicates whether go.mod or go.sum are (check) or were changed"`
+	Diff    string `json:"diff,omitempty" jsonschema:"the changes to go.mod and go.sum as unified diff"`
+}
+
+// Package describes a Go package.
+type Package struct {
+	ImportPath   string   `json:"import_path"`
+	Name         string   `json:"name"`
+	Dir          string   `json:"dir" jsonschema:"the directory relative to the working directory"`
+	GoFiles      []string `json:"go_files,omitempty"`
+	TestGoFiles  []string `json:"test_go_files,omitempty"`
+	XTestGoFiles []string `json:"xtest_go_files,omitempty"`
+	Imports      []string `json:"imports,omitempty"`
+	Error        string   `json:"error,omitempty" jsonschema:"the error loading the package, if any"`
+}
+
+// ListResult is the result of the go_list tool.
+type ListResult struct {
+	CheckResult
+	Packages []Package `json:"packages" jsonschema:"the packages matching the patterns"`
+}
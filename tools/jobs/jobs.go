@@ -0,0 +1,329 @@
+// Package jobs runs make targets in the background, so long-running commands
+// like integration tests or dev servers do not block a tool call.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/seb-schulz/mcpilot-pair/internal/runner"
+	"github.com/seb-schulz/mcpilot-pair/middleware/lock"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+	maketool "github.com/seb-schulz/mcpilot-pair/tools/make"
+)
+
+const (
+	// DefaultMaxRunning is the default number of jobs a session may run concurrently.
+	DefaultMaxRunning = 4
+	// DefaultTimeout is the default maximum duration of a job.
+	DefaultTimeout = time.Hour
+
+	// maxFinished is the number of finished jobs kept per session.
+	maxFinished = 16
+	// maxLines is the number of output lines kept per job; older lines are discarded.
+	maxLines = 10000
+	// defaultLimit is the number of lines job_output returns by default.
+	defaultLimit = 200
+	// stopTimeout bounds how long Stop waits for a killed job to end.
+	stopTimeout = 5 * time.Second
+)
+
+// Manager runs make targets as background jobs owned by MCP sessions.
+type Manager struct {
+	// Locks serialises jobs in the same directory if not nil. A job holds the lock of
+	// its directory until it ends; the key does not conflict with the locks of files and
+	// directories, so tools keep working on the workspace while a job runs.
+	Locks *lock.Manager
+
+	runner     *maketool.Runner
+	maxRunning int
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+
+	mu       sync.Mutex
+	nextID   int
+	sessions map[string][]*job
+}
+
+type job struct {
+	id      string
+	args    maketool.RunMakeArgs
+	started time.Time
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu       sync.Mutex
+	lines    []Line
+	dropped  int
+	stopped  bool
+	finished time.Time
+	result   runner.Status
+	err      error
+}
+
+// NewManager returns a Manager running jobs with runner and allowing maxRunning concurrent jobs per session.
+func NewManager(runner *maketool.Runner, maxRunning int) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		runner:     runner,
+		maxRunning: maxRunning,
+		ctx:        ctx,
+		cancel:     cancel,
+		sessions:   make(map[string][]*job),
+	}
+}
+
+// Start starts make in the background for the session and returns the new job.
+// The job keeps the working directory of ctx but not its cancellation.
+func (m *Manager) Start(ctx context.Context, sessionID string, args StartArgs) (Info, error) {
+	root, err := filesystem.Root(ctx)
+	if err != nil {
+		return Info{}, err
+	}
+	if err := m.runner.Validate(ctx, args); err != nil {
+		return Info{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ctx.Err() != nil {
+		return Info{}, fmt.Errorf("server is shutting down")
+	}
+	running := 0
+	for _, j := range m.sessions[sessionID] {
+		if !j.isDone() {
+			running++
+		}
+	}
+	if running >= m.maxRunning {
+		return Info{}, fmt.Errorf("too many running jobs (%d), stop one with job_stop first", running)
+	}
+
+	dir, err := filesystem.ResolveDirectory(ctx, args.Directory)
+	if err != nil {
+		return Info{}, err
+	}
+	id := fmt.Sprintf("job-%d", m.nextID+1)
+	release, err := m.Locks.TryAcquire([]string{lockKey(dir)}, lock.Holder{SessionID: sessionID, Operation: "background job " + id})
+	if err != nil {
+		return Info{}, err
+	}
+
+	m.nextID++
+	jobCtx, cancel := context.WithCancel(filesystem.WithRoot(m.ctx, root))
+	j := &job{
+		id:      id,
+		args:    args,
+		started: time.Now(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	m.sessions[sessionID] = append(m.prune(m.sessions[sessionID]), j)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		result, err := m.runner.Stream(jobCtx, args, j.append)
+		release()
+		j.mu.Lock()
+		j.result, j.err, j.finished = result, err, time.Now()
+		j.mu.Unlock()
+		close(j.done)
+	}()
+	return j.info(), nil
+}
+
+// lockKey returns the key jobs in dir lock. Jobs in a directory and its subdirectories
+// conflict with each other, but not with other tools.
+func lockKey(dir string) string {
+	return "job:" + dir
+}
+
+// prune drops the oldest finished jobs beyond maxFinished.
+func (m *Manager) prune(jobs []*job) []*job {
+	finished := 0
+	for _, j := range jobs {
+		if j.isDone() {
+			finished++
+		}
+	}
+	kept := jobs[:0]
+	for _, j := range jobs {
+		if finished >= maxFinished && j.isDone() {
+			finished--
+			continue
+		}
+		kept = append(kept, j)
+	}
+	return kept
+}
+
+// lookup returns the job with the given ID if it belongs to the session.
+func (m *Manager) lookup(sessionID, id string) (*job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range m.sessions[sessionID] {
+		if j.id == id {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown job '%s'", id)
+}
+
+// Status returns the state of a job of the session.
+func (m *Manager) Status(sessionID string, args JobArgs) (Info, error) {
+	j, err := m.lookup(sessionID, args.ID)
+	if err != nil {
+		return Info{}, err
+	}
+	return j.info(), nil
+}
+
+// Output returns output lines of a job of the session starting at args.Offset.
+func (m *Manager) Output(sessionID string, args OutputArgs) (OutputResult, error) {
+	j, err := m.lookup(sessionID, args.ID)
+	if err != nil {
+		return OutputResult{}, err
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	j.mu.Lock()
+	offset := max(args.Offset, j.dropped)
+	start := min(offset-j.dropped, len(j.lines))
+	end := min(start+limit, len(j.lines))
+	lines := append([]Line{}, j.lines[start:end]...)
+	j.mu.Unlock()
+
+	return OutputResult{
+		Lines:      lines,
+		Offset:     offset,
+		NextOffset: offset + len(lines),
+		State:      j.info().State,
+	}, nil
+}
+
+// Stop kills a running job of the session, including all processes it started, and waits for it to end.
+func (m *Manager) Stop(sessionID string, args JobArgs) (Info, error) {
+	j, err := m.lookup(sessionID, args.ID)
+	if err != nil {
+		return Info{}, err
+	}
+	j.stop()
+	select {
+	case <-j.done:
+	case <-time.After(stopTimeout):
+	}
+	return j.info(), nil
+}
+
+// List returns all jobs of the session.
+func (m *Manager) List(sessionID string) ListResult {
+	m.mu.Lock()
+	jobs := append([]*job{}, m.sessions[sessionID]...)
+	m.mu.Unlock()
+
+	result := ListResult{Jobs: []Info{}}
+	for _, j := range jobs {
+		result.Jobs = append(result.Jobs, j.info())
+	}
+	return result
+}
+
+// EndSession stops and forgets all jobs of a session which has ended.
+func (m *Manager) EndSession(sessionID string) {
+	m.mu.Lock()
+	jobs := m.sessions[sessionID]
+	delete(m.sessions, sessionID)
+	m.mu.Unlock()
+
+	for _, j := range jobs {
+		j.stop()
+	}
+}
+
+// Close stops all jobs and waits for them to end. No jobs can be started afterwards.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	for _, jobs := range m.sessions {
+		for _, j := range jobs {
+			j.markStopped()
+		}
+	}
+	m.cancel()
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+func (j *job) append(stream, text string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.lines = append(j.lines, Line{Stream: stream, Text: text})
+	if len(j.lines) > maxLines {
+		drop := len(j.lines) - maxLines
+		j.lines = append(j.lines[:0], j.lines[drop:]...)
+		j.dropped += drop
+	}
+}
+
+func (j *job) isDone() bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (j *job) markStopped() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.finished.IsZero() {
+		j.stopped = true
+	}
+}
+
+func (j *job) stop() {
+	j.markStopped()
+	j.cancel()
+}
+
+func (j *job) info() Info {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := Info{
+		ID:        j.id,
+		Target:    j.args.Target,
+		Directory: j.args.Directory,
+		State:     StateRunning,
+		StartedAt: j.started,
+		Lines:     j.dropped + len(j.lines),
+	}
+	if j.finished.IsZero() {
+		return info
+	}
+
+	finished := j.finished
+	info.FinishedAt = &finished
+	info.ExitCode = j.result.ExitCode
+	switch {
+	case j.err != nil:
+		info.State = StateError
+		info.Error = j.err.Error()
+	case j.stopped && j.result.Canceled:
+		info.State = StateStopped
+	case j.result.TimedOut:
+		info.State = StateTimedOut
+	case j.result.ExitCode == 0:
+		info.State = StateSucceeded
+	default:
+		info.State = StateFailed
+	}
+	return info
+}
@@ -0,0 +1,186 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seb-schulz/mcpilot-pair/middleware/lock"
+	maketool "github.com/seb-schulz/mcpilot-pair/tools/make"
+)
+
+// setupManager changes into a temporary workspace with a Makefile and returns a Manager for it.
+func setupManager(t *testing.T) *Manager {
+	t.Helper()
+	dir := t.TempDir()
+	oldwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current working directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(oldwd) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change working directory: %v", err)
+	}
+
+	makefile := "quick:\n\t@echo one; echo two; echo three >&2\n\nslow:\n\t@echo started; sleep 30\n\nbroken:\n\t@exit 2\n"
+	if err := os.WriteFile("Makefile", []byte(makefile), 0644); err != nil {
+		t.Fatalf("Failed to create Makefile: %v", err)
+	}
+	m := NewManager(maketool.NewRunner(maketool.Policy{Allow: []string{"*"}}), 2)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// waitFor polls the job until it is no longer running.
+func waitFor(t *testing.T, m *Manager, sessionID, id string) Info {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		info, err := m.Status(sessionID, JobArgs{ID: id})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.State != StateRunning {
+			return info
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish", id)
+	return Info{}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	m := setupManager(t)
+
+	quick, err := m.Start(context.Background(), "s1", StartArgs{Target: "quick"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info := waitFor(t, m, "s1", quick.ID); info.State != StateSucceeded || info.FinishedAt == nil || info.Lines < 3 {
+		t.Errorf("Unexpected job: %+v", info)
+	}
+	broken, _ := m.Start(context.Background(), "s1", StartArgs{Target: "broken"})
+	if info := waitFor(t, m, "s1", broken.ID); info.State != StateFailed || info.ExitCode != 2 {
+		t.Errorf("Unexpected job: %+v", info)
+	}
+
+	// Read the output in pages
+	var texts []string
+	for offset := 0; ; {
+		out, err := m.Output("s1", OutputArgs{ID: quick.ID, Offset: offset, Limit: 2})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(out.Lines) == 0 {
+			break
+		}
+		for _, l := range out.Lines {
+			texts = append(texts, l.Stream+":"+l.Text)
+		}
+		offset = out.NextOffset
+	}
+	for _, want := range []string{"stdout:one", "stdout:two", "stderr:three"} {
+		found := false
+		for _, text := range texts {
+			found = found || text == want
+		}
+		if !found {
+			t.Errorf("Missing %q in output %q", want, texts)
+		}
+	}
+
+	// Jobs are only visible to their own session
+	if _, err := m.Status("s2", JobArgs{ID: quick.ID}); err == nil {
+		t.Errorf("Expected job of another session to be hidden")
+	}
+	if jobs := m.List("s1").Jobs; len(jobs) != 2 {
+		t.Errorf("Expected 2 jobs, got %+v", jobs)
+	}
+	if jobs := m.List("s2").Jobs; len(jobs) != 0 {
+		t.Errorf("Expected no jobs, got %+v", jobs)
+	}
+}
+
+func TestJobStop(t *testing.T) {
+	m := setupManager(t)
+
+	first, err := m.Start(context.Background(), "s1", StartArgs{Target: "slow"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := m.Start(context.Background(), "s1", StartArgs{Target: "slow"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := m.Start(context.Background(), "s1", StartArgs{Target: "slow"}); err == nil {
+		t.Errorf("Expected limit of running jobs to be enforced")
+	}
+	if _, err := m.Start(context.Background(), "s1", StartArgs{Target: "undefined"}); err == nil {
+		t.Errorf("Expected undefined target to be rejected")
+	}
+
+	info, err := m.Stop("s1", JobArgs{ID: first.ID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.State != StateStopped {
+		t.Errorf("Unexpected job: %+v", info)
+	}
+	if _, err := m.Start(context.Background(), "s1", StartArgs{Target: "quick"}); err != nil {
+		t.Errorf("Expected stopped job to free a slot: %v", err)
+	}
+
+	m.EndSession("s1")
+	if jobs := m.List("s1").Jobs; len(jobs) != 0 {
+		t.Errorf("Expected jobs of ended session to be gone, got %+v", jobs)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Close did not wait for the jobs to end")
+	}
+	if _, err := m.Start(context.Background(), "s1", StartArgs{Target: "quick"}); err == nil {
+		t.Errorf("Expected no jobs to start after Close")
+	}
+}
+
+func TestJobLock(t *testing.T) {
+	m := setupManager(t)
+	m.Locks = lock.NewManager(0)
+
+	first, err := m.Start(context.Background(), "s1", StartArgs{Target: "slow"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var busy *lock.BusyError
+	if _, err := m.Start(context.Background(), "s2", StartArgs{Target: "quick"}); !errors.As(err, &busy) || busy.Holder.SessionID != "s1" {
+		t.Fatalf("Expected directory to be locked by the first job, got %v", err)
+	}
+
+	// Writes and builds in the directory of the job are not blocked
+	dir, _ := os.Getwd()
+	for _, key := range []string{dir, filepath.Join(dir, "a.txt")} {
+		release, err := m.Locks.TryAcquire([]string{key}, lock.Holder{SessionID: "s2", Operation: "filesystem_write_file"})
+		if err != nil {
+			t.Fatalf("Expected %s not to be locked by the job: %v", key, err)
+		}
+		release()
+	}
+
+	m.Stop("s1", JobArgs{ID: first.ID})
+	second, err := m.Start(context.Background(), "s2", StartArgs{Target: "quick"})
+	if err != nil {
+		t.Fatalf("Expected lock to be released by the stopped job: %v", err)
+	}
+	if info := waitFor(t, m, "s2", second.ID); info.State != StateSucceeded {
+		t.Errorf("Unexpected job: %+v", info)
+	}
+}
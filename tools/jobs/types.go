@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"time"
+
+	maketool "github.com/seb-schulz/mcpilot-pair/tools/make"
+)
+
+// State is the state of a job.
+type State string
+
+const (
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateTimedOut  State = "timed_out"
+	StateStopped   State = "stopped"
+	StateError     State = "error"
+)
+
+// StartArgs are the arguments for the job_start tool.
+type StartArgs = maketool.RunMakeArgs
+
+// JobArgs are the arguments for the job_status and job_stop tools.
+type JobArgs struct {
+	ID string `json:"id" jsonschema:"the ID of the job"`
+}
+
+// OutputArgs are the arguments for the job_output tool.
+type OutputArgs struct {
+	ID     string `json:"id" jsonschema:"the ID of the job"`
+	Offset int    `json:"offset,omitempty" jsonschema:"the number of the first line to return, usually next_offset of the previous call"`
+	Limit  int    `json:"limit,omitempty" jsonschema:"the maximum number of lines to return (default 200)"`
+}
+
+// Info describes a job.
+type Info struct {
+	ID         string     `json:"id" jsonschema:"the ID of the job"`
+	Target     string     `json:"target" jsonschema:"the make target of the job"`
+	Directory  string     `json:"directory,omitempty" jsonschema:"the directory make runs in"`
+	State      State      `json:"state" jsonschema:"one of running, succeeded, failed, timed_out, stopped or error"`
+	ExitCode   int        `json:"exit_code" jsonschema:"the exit code of make, -1 if it was killed"`
+	Error      string     `json:"error,omitempty" jsonschema:"the reason why make could not be run"`
+	StartedAt  time.Time  `json:"started_at" jsonschema:"the time the job was started"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" jsonschema:"the time the job ended"`
+	Lines      int        `json:"lines" jsonschema:"the number of output lines so far"`
+}
+
+// Line is a line of output of a job.
+type Line struct {
+	Stream string `json:"stream" jsonschema:"stdout or stderr"`
+	Text   string `json:"text" jsonschema:"the line without line break"`
+}
+
+// OutputResult is the result of the job_output tool.
+type OutputResult struct {
+	Lines      []Line `json:"lines" jsonschema:"the output lines starting at offset"`
+	Offset     int    `json:"offset" jsonschema:"the number of the first returned line; larger than requested if older lines were discarded"`
+	NextOffset int    `json:"next_offset" jsonschema:"the offset to continue reading from"`
+	State      State  `json:"state" jsonschema:"the state of the job"`
+}
+
+// ListResult is the result of the job_list tool.
+type ListResult struct {
+	Jobs []Info `json:"jobs" jsonschema:"the jobs of this session, oldest first"`
+}
@@ -0,0 +1,435 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/seb-schulz/mcpilot-pair/internal/runner"
+	"github.com/seb-schulz/mcpilot-pair/internal/sandbox"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+const (
+	// initTimeout bounds the start of a language server.
+	initTimeout = time.Minute
+	// shutdownTimeout bounds how long a server may take to exit before it is killed.
+	shutdownTimeout = 5 * time.Second
+	// maxDocuments is the number of documents kept open in a server. The least recently
+	// used one is closed when another one is opened.
+	maxDocuments = 100
+)
+
+// clientCapabilities announces what the bridge supports to the servers.
+var clientCapabilities = map[string]any{
+	"workspace": map[string]any{
+		"applyEdit":              true,
+		"workspaceEdit":          map[string]any{"documentChanges": true},
+		"didChangeWatchedFiles":  map[string]any{"dynamicRegistration": true},
+		"workspaceFolders":       true,
+		"configuration":          true,
+		"executeCommand":         map[string]any{},
+		"didChangeConfiguration": map[string]any{},
+	},
+	"textDocument": map[string]any{
+		"synchronization": map[string]any{},
+		"hover":           map[string]any{"contentFormat": []string{"markdown", "plaintext"}},
+		"definition":      map[string]any{"linkSupport": true},
+		"references":      map[string]any{},
+		"rename":          map[string]any{},
+		"publishDiagnostics": map[string]any{
+			"versionSupport": true,
+		},
+		"codeAction": map[string]any{
+			"codeActionLiteralSupport": map[string]any{
+				"codeActionKind": map[string]any{"valueSet": []string{
+					"", "quickfix", "refactor", "refactor.extract", "refactor.inline", "refactor.rewrite", "source", "source.organizeImports", "source.fixAll",
+				}},
+			},
+			"isPreferredSupport": true,
+			"disabledSupport":    true,
+			"dataSupport":        true,
+			"resolveSupport":     map[string]any{"properties": []string{"edit"}},
+		},
+	},
+	"window": map[string]any{"workDoneProgress": true},
+}
+
+// client is the connection to a language server running for one root directory.
+type client struct {
+	server Server
+	root   string
+	conn   *conn
+	cancel context.CancelFunc
+	// exited is closed when the server process ended.
+	exited chan struct{}
+
+	// syncMu serialises the notifications about documents, so versions arrive in order.
+	syncMu sync.Mutex
+	docs   map[string]*document
+
+	mu sync.Mutex
+	// diagnostics are the latest ones published per file.
+	diagnostics map[string]published
+	// seq counts the publications; published is closed and replaced on each of them.
+	seq       int
+	published chan struct{}
+	active    int
+	lastUse   time.Time
+	// commandEdits collects the edits a server applies while it executes a command.
+	commandEdits *fileEdits
+}
+
+// document is a file opened in the server.
+type document struct {
+	version int
+	content []byte
+	used    time.Time
+	// since is the number of diagnostics publications when the content was sent.
+	since int
+}
+
+// published are the diagnostics of a file, the number of their publication and the
+// version of the document they belong to, if the server tells.
+type published struct {
+	seq         int
+	version     *int
+	diagnostics []json.RawMessage
+}
+
+// startClient starts server in root and initializes it. The process is killed when ctx is done.
+func startClient(ctx context.Context, server Server, root string, env []string, box *sandbox.Config) (*client, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := runner.Command(ctx, server.Command[0], server.Command[1:]...)
+	cmd.Dir = root
+	cmd.Env = env
+	if err := box.Wrap(cmd); err != nil {
+		cancel()
+		return nil, err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	cmd.Stderr = runner.NewLineWriter(func(line string) { log.Printf("%s: %s", server.Name(), line) })
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start language server %s: %v", server.Name(), err)
+	}
+
+	c := &client{
+		server:      server,
+		root:        root,
+		cancel:      cancel,
+		exited:      make(chan struct{}),
+		docs:        make(map[string]*document),
+		diagnostics: make(map[string]published),
+		published:   make(chan struct{}),
+		lastUse:     time.Now(),
+	}
+	c.conn = newConn(stdin, c.handle)
+	go func() {
+		c.conn.read(stdout)
+		// Wait closes stdout, so it must not be called before reading is done
+		cmd.Wait()
+		cancel()
+		close(c.exited)
+	}()
+
+	initCtx, cancelInit := context.WithTimeout(ctx, initTimeout)
+	defer cancelInit()
+	params := map[string]any{
+		"processId":        os.Getpid(),
+		"clientInfo":       map[string]string{"name": "mcpilot-pair"},
+		"rootUri":          fileURI(root),
+		"rootPath":         root,
+		"workspaceFolders": c.workspaceFolders(),
+		"capabilities":     clientCapabilities,
+	}
+	if err := c.conn.call(initCtx, "initialize", params, nil); err != nil {
+		c.cancel()
+		return nil, fmt.Errorf("language server %s did not initialize: %v", server.Name(), err)
+	}
+	if err := c.conn.notify("initialized", struct{}{}); err != nil {
+		c.cancel()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *client) workspaceFolders() []map[string]string {
+	return []map[string]string{{"uri": fileURI(c.root), "name": filepath.Base(c.root)}}
+}
+
+// running reports whether the server process is still running.
+func (c *client) running() bool {
+	select {
+	case <-c.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// shutdown asks the server to exit and kills it if it does not in time.
+func (c *client) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := c.conn.call(ctx, "shutdown", nil, nil); err == nil {
+		c.conn.notify("exit", nil)
+	}
+	select {
+	case <-c.exited:
+	case <-ctx.Done():
+	}
+	c.cancel()
+	<-c.exited
+}
+
+// handle answers the requests and notifications of the server.
+func (c *client) handle(ctx context.Context, method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "textDocument/publishDiagnostics":
+		var p struct {
+			URI         string            `json:"uri"`
+			Version     *int              `json:"version"`
+			Diagnostics []json.RawMessage `json:"diagnostics"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		path, err := uriPath(p.URI)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.seq++
+		c.diagnostics[path] = published{seq: c.seq, version: p.Version, diagnostics: p.Diagnostics}
+		close(c.published)
+		c.published = make(chan struct{})
+		c.mu.Unlock()
+		return nil, nil
+	case "workspace/configuration":
+		// No settings are configured, servers fall back to their defaults
+		var p struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(params, &p)
+		return make([]any, len(p.Items)), nil
+	case "workspace/workspaceFolders":
+		return c.workspaceFolders(), nil
+	case "workspace/applyEdit":
+		return c.applyEdit(params)
+	case "client/registerCapability", "client/unregisterCapability", "window/workDoneProgress/create", "window/showMessageRequest",
+		"window/logMessage", "window/showMessage", "$/progress", "$/logTrace", "telemetry/event":
+		return nil, nil
+	}
+	return nil, &rpcError{Code: methodNotFound, Message: "method not supported by mcpilot-pair: " + method}
+}
+
+// applyEdit applies the edits of a command executed by [client.execute]. Servers may
+// not change files at other times.
+func (c *client) applyEdit(params json.RawMessage) (any, error) {
+	type result struct {
+		Applied       bool   `json:"applied"`
+		FailureReason string `json:"failureReason,omitempty"`
+	}
+	var p struct {
+		Edit workspaceEdit `json:"edit"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	collected := c.commandEdits
+	c.mu.Unlock()
+	if collected == nil {
+		return result{FailureReason: "edits are only applied while a code action runs"}, nil
+	}
+	ctx := filesystem.WithRoot(context.Background(), c.root)
+	edits, err := prepare(ctx, p.Edit)
+	if err == nil {
+		err = filesystem.ReplaceFiles(edits.before, edits.after)
+	}
+	if err != nil {
+		return result{FailureReason: err.Error()}, nil
+	}
+	c.mu.Lock()
+	collected.merge(edits)
+	c.mu.Unlock()
+	c.syncOpen()
+	return result{Applied: true}, nil
+}
+
+// execute runs a command in the server and returns the edits it applied.
+func (c *client) execute(ctx context.Context, cmd command) (*fileEdits, error) {
+	collected := newFileEdits()
+	c.mu.Lock()
+	if c.commandEdits != nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("another code action is running")
+	}
+	c.commandEdits = collected
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.commandEdits = nil
+		c.mu.Unlock()
+	}()
+
+	params := map[string]any{"command": cmd.Command, "arguments": cmd.Arguments}
+	if err := c.conn.call(ctx, "workspace/executeCommand", params, nil); err != nil {
+		return nil, err
+	}
+	return collected, nil
+}
+
+// sync opens path in the server or sends its changed content. It returns the content
+// and whether the server got new content.
+func (c *client) sync(path string) ([]byte, bool, error) {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	return c.syncLocked(path)
+}
+
+func (c *client) syncLocked(path string) ([]byte, bool, error) {
+	content, err := os.ReadFile(path)
+	doc, open := c.docs[path]
+	if err != nil {
+		if os.IsNotExist(err) && open {
+			delete(c.docs, path)
+			return nil, true, c.conn.notify("textDocument/didClose", map[string]any{"textDocument": textDocumentIdentifier{URI: fileURI(path)}})
+		}
+		return nil, false, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if !open {
+		if len(c.docs) >= maxDocuments {
+			c.closeLeastUsed()
+		}
+		c.docs[path] = &document{version: 1, content: content, used: time.Now(), since: c.publications()}
+		return content, true, c.conn.notify("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{"uri": fileURI(path), "languageId": languageID(path), "version": 1, "text": string(content)},
+		})
+	}
+	doc.used = time.Now()
+	if bytes.Equal(doc.content, content) {
+		return content, false, nil
+	}
+	doc.version++
+	doc.content = content
+	doc.since = c.publications()
+	return content, true, c.conn.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": fileURI(path), "version": doc.version},
+		"contentChanges": []map[string]string{{"text": string(content)}},
+	})
+}
+
+// closeLeastUsed closes the document used longest ago.
+func (c *client) closeLeastUsed() {
+	var oldest string
+	for path, doc := range c.docs {
+		if oldest == "" || doc.used.Before(c.docs[oldest].used) {
+			oldest = path
+		}
+	}
+	delete(c.docs, oldest)
+	c.conn.notify("textDocument/didClose", map[string]any{"textDocument": textDocumentIdentifier{URI: fileURI(oldest)}})
+}
+
+// syncOpen sends the changes of all open documents, e.g. after a tool wrote files.
+// It returns the paths of the open documents.
+func (c *client) syncOpen() []string {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	paths := make([]string, 0, len(c.docs))
+	for path := range c.docs {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	for _, path := range paths {
+		if _, _, err := c.syncLocked(path); err != nil {
+			log.Printf("%s: %v", c.server.Name(), err)
+		}
+	}
+	return paths
+}
+
+// saved sends didSave for the open documents among events, as their content was written to disk.
+func (c *client) saved(events map[string]int) {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	for _, path := range slices.Sorted(maps.Keys(events)) {
+		if _, open := c.docs[path]; open && events[path] != fileDeleted {
+			c.conn.notify("textDocument/didSave", map[string]any{"textDocument": textDocumentIdentifier{URI: fileURI(path)}})
+		}
+	}
+}
+
+// position syncs path and converts a 1-based line and byte column in it.
+func (c *client) position(path string, line, column int) (textDocumentPositionParams, []byte, error) {
+	content, _, err := c.sync(path)
+	if err != nil {
+		return textDocumentPositionParams{}, nil, err
+	}
+	pos, err := toPosition(content, line, column)
+	if err != nil {
+		return textDocumentPositionParams{}, nil, err
+	}
+	return textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: fileURI(path)}, Position: pos}, content, nil
+}
+
+// publications returns the number of diagnostics publications so far.
+func (c *client) publications() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq
+}
+
+// waitDiagnostics returns the diagnostics of the open document path published for its
+// current content. If there are none after wait, the latest ones are returned and
+// timedOut is set.
+func (c *client) waitDiagnostics(ctx context.Context, path string, wait time.Duration) (diagnostics []json.RawMessage, timedOut bool, err error) {
+	c.syncMu.Lock()
+	doc, ok := c.docs[path]
+	var version, since int
+	if ok {
+		version, since = doc.version, doc.since
+	}
+	c.syncMu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		c.mu.Lock()
+		p := c.diagnostics[path]
+		ch := c.published
+		c.mu.Unlock()
+		// Late publications for older versions are skipped
+		if p.seq > since && (p.version == nil || *p.version >= version) {
+			return p.diagnostics, false, nil
+		}
+		select {
+		case <-ch:
+		case <-timer.C:
+			return p.diagnostics, true, nil
+		case <-c.exited:
+			return nil, false, errClosed
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/seb-schulz/mcpilot-pair/internal/textdiff"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+// fileEdits are the contents of files before and after an edit, by absolute path.
+type fileEdits struct {
+	before map[string][]byte
+	after  map[string][]byte
+}
+
+func newFileEdits() *fileEdits {
+	return &fileEdits{before: make(map[string][]byte), after: make(map[string][]byte)}
+}
+
+// merge adds the edits of other, which were made after those of e.
+func (e *fileEdits) merge(other *fileEdits) {
+	for path, content := range other.after {
+		if _, ok := e.before[path]; !ok {
+			e.before[path] = other.before[path]
+		}
+		e.after[path] = content
+	}
+}
+
+// prepare reads the files changed by edit, which must be in the working directory of
+// ctx, and applies the edit to their contents. Files are not written.
+func prepare(ctx context.Context, edit workspaceEdit) (*fileEdits, error) {
+	byURI := make(map[string][]textEdit)
+	for uri, edits := range edit.Changes {
+		byURI[uri] = append(byURI[uri], edits...)
+	}
+	for _, change := range edit.DocumentChanges {
+		if change.Kind != "" {
+			return nil, fmt.Errorf("the edit would %s a file, which is not supported", change.Kind)
+		}
+		byURI[change.TextDocument.URI] = append(byURI[change.TextDocument.URI], change.Edits...)
+	}
+
+	edits := newFileEdits()
+	for _, uri := range slices.Sorted(maps.Keys(byURI)) {
+		path, err := uriPath(uri)
+		if err != nil {
+			return nil, err
+		}
+		safePath, err := filesystem.ResolvePath(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("the edit changes %s: %v", path, err)
+		}
+		before, err := os.ReadFile(safePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		after, err := applyEdits(before, byURI[uri])
+		if err != nil {
+			return nil, fmt.Errorf("failed to edit %s: %v", path, err)
+		}
+		if !bytes.Equal(before, after) {
+			edits.before[safePath] = before
+			edits.after[safePath] = after
+		}
+	}
+	return edits, nil
+}
+
+// result describes the edits with paths relative to root.
+func (e *fileEdits) result(root string, applied bool) EditResult {
+	result := EditResult{Files: []string{}, Applied: applied}
+	var diff strings.Builder
+	for _, path := range slices.Sorted(maps.Keys(e.after)) {
+		rel := relative(root, path)
+		result.Files = append(result.Files, rel)
+		diff.WriteString(textdiff.Unified("a/"+rel, "b/"+rel, string(e.before[path]), string(e.after[path])))
+	}
+	result.Diff = diff.String()
+	return result
+}
+
+// relative returns path relative to root, or path itself if it is outside of root.
+func relative(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
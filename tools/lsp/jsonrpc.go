@@ -0,0 +1,223 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// errClosed is returned by calls on a connection whose peer went away.
+var errClosed = errors.New("the language server connection is closed")
+
+// message is a JSON-RPC 2.0 request, notification or response.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is the error of a JSON-RPC response.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// methodNotFound is the JSON-RPC error code for unknown methods.
+const methodNotFound = -32601
+
+// handler answers the requests and notifications a peer sends. Notifications are
+// handled one after another in the order they arrive, requests concurrently; the
+// result is ignored for notifications.
+type handler func(ctx context.Context, method string, params json.RawMessage) (any, error)
+
+// conn is a JSON-RPC 2.0 connection with the Content-Length framing of the Language
+// Server Protocol. It works for both sides, so tests use it for a fake server.
+type conn struct {
+	handle handler
+
+	writeMu sync.Mutex
+	w       io.Writer
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *message
+	err     error
+	done    chan struct{}
+}
+
+// newConn returns a connection writing to w. Messages are read by [conn.read].
+func newConn(w io.Writer, handle handler) *conn {
+	return &conn{handle: handle, w: w, pending: make(map[int64]chan *message), done: make(chan struct{})}
+}
+
+// read dispatches the messages of r until it fails, then closes the connection.
+func (c *conn) read(r io.Reader) {
+	tr := textproto.NewReader(bufio.NewReader(r))
+	for {
+		data, err := readMessage(tr)
+		if err != nil {
+			c.close(err)
+			return
+		}
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		switch {
+		case msg.Method != "" && msg.ID != nil:
+			go c.reply(msg)
+		case msg.Method != "":
+			c.handle(context.Background(), msg.Method, msg.Params)
+		case msg.ID != nil:
+			var id int64
+			if err := json.Unmarshal(msg.ID, &id); err != nil {
+				continue
+			}
+			c.mu.Lock()
+			ch := c.pending[id]
+			delete(c.pending, id)
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- &msg
+			}
+		}
+	}
+}
+
+// readMessage reads the header and the content of a message.
+func readMessage(tr *textproto.Reader) ([]byte, error) {
+	header, err := tr.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(tr.R, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// reply answers a request of the peer.
+func (c *conn) reply(req message) {
+	resp := message{JSONRPC: "2.0", ID: req.ID}
+	result, err := c.handle(context.Background(), req.Method, req.Params)
+	if err == nil {
+		resp.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		var rpcErr *rpcError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &rpcError{Code: -32603, Message: err.Error()}
+		}
+		resp.Result, resp.Error = nil, rpcErr
+	}
+	c.write(resp)
+}
+
+// write sends a message.
+func (c *conn) write(msg message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data); err != nil {
+		return fmt.Errorf("failed to write to the language server: %v", err)
+	}
+	return nil
+}
+
+// call sends a request and decodes the result into result unless it is nil.
+// When ctx is done, the request is cancelled.
+func (c *conn) call(ctx context.Context, method string, params, result any) error {
+	raw, err := marshalParams(params)
+	if err != nil {
+		return err
+	}
+	ch := make(chan *message, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return errClosed
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := c.write(message{JSONRPC: "2.0", ID: json.RawMessage(strconv.FormatInt(id, 10)), Method: method, Params: raw}); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		c.notify("$/cancelRequest", map[string]int64{"id": id})
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	case resp := <-ch:
+		if resp == nil {
+			return errClosed
+		}
+		if resp.Error != nil {
+			return fmt.Errorf("%s failed: %w", method, resp.Error)
+		}
+		if result != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, result)
+		}
+		return nil
+	}
+}
+
+// notify sends a notification.
+func (c *conn) notify(method string, params any) error {
+	raw, err := marshalParams(params)
+	if err != nil {
+		return err
+	}
+	return c.write(message{JSONRPC: "2.0", Method: method, Params: raw})
+}
+
+// marshalParams encodes params, leaving them out if nil like for shutdown and exit.
+func marshalParams(params any) (json.RawMessage, error) {
+	if params == nil {
+		return nil, nil
+	}
+	return json.Marshal(params)
+}
+
+// close fails all pending calls with errClosed.
+func (c *conn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	close(c.done)
+}
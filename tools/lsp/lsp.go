@@ -0,0 +1,702 @@
+// Package lsp bridges language servers like gopls, pyright, rust-analyzer or
+// typescript-language-server to MCP tools. Servers are started on first use for
+// the working directory of a session, talk the Language Server Protocol over
+// stdio and are told about files the other tools change.
+package lsp
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/seb-schulz/mcpilot-pair/internal/runner"
+	"github.com/seb-schulz/mcpilot-pair/internal/sandbox"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+const (
+	// DefaultIdleTimeout is the time after which an unused server is shut down.
+	DefaultIdleTimeout = 15 * time.Minute
+	// DefaultDiagnosticsWait is how long lsp_diagnostics waits for a server to check a changed file.
+	DefaultDiagnosticsWait = 10 * time.Second
+	// requestTimeout bounds a request; servers may take a while to load the workspace first.
+	requestTimeout = 2 * time.Minute
+	// maxLocations is the number of definitions or references returned at most.
+	maxLocations = 500
+)
+
+// The types of file events of workspace/didChangeWatchedFiles.
+const (
+	fileCreated = 1
+	fileChanged = 2
+	fileDeleted = 3
+)
+
+// FilesFunc returns the absolute paths of the files a call with the given arguments may change.
+type FilesFunc func(ctx context.Context, arguments json.RawMessage) []string
+
+// Files adapts a function taking the typed arguments of a tool to a [FilesFunc].
+func Files[In any](fn func(ctx context.Context, args In) []string) FilesFunc {
+	return func(ctx context.Context, arguments json.RawMessage) []string {
+		var args In
+		if len(arguments) > 0 {
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return nil
+			}
+		}
+		return fn(ctx, args)
+	}
+}
+
+// ResultFilesFunc returns the absolute paths of the files a call changed according to its result.
+type ResultFilesFunc func(ctx context.Context, result *mcp.CallToolResult) []string
+
+// ResultFiles adapts a function taking the typed result of a tool to a [ResultFilesFunc].
+func ResultFiles[Out any](fn func(ctx context.Context, result Out) []string) ResultFilesFunc {
+	return func(ctx context.Context, result *mcp.CallToolResult) []string {
+		var out Out
+		data, err := json.Marshal(result.StructuredContent)
+		if err != nil || json.Unmarshal(data, &out) != nil {
+			return nil
+		}
+		return fn(ctx, out)
+	}
+}
+
+// clientKey identifies a running server: the index of its configuration and its root directory.
+type clientKey struct {
+	server int
+	root   string
+}
+
+// Manager starts the configured language servers on demand, one per server and working
+// directory, and shuts them down when they are idle.
+type Manager struct {
+	Servers Servers
+	// Env decides the environment of the servers.
+	Env runner.EnvPolicy
+	// Sandbox confines the servers if not nil.
+	Sandbox *sandbox.Config
+	// IdleTimeout is the time after which an unused server is shut down; 0 keeps it running.
+	IdleTimeout time.Duration
+	// DiagnosticsWait is how long Diagnostics waits for the diagnostics of a changed file.
+	DiagnosticsWait time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	clients map[clientKey]*client
+	files   map[string]FilesFunc
+	results map[string]ResultFilesFunc
+	closed  bool
+}
+
+// NewManager returns a Manager for servers with the default environment and timeouts.
+func NewManager(servers Servers) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		Servers:         servers,
+		Env:             runner.DefaultEnvPolicy(),
+		IdleTimeout:     DefaultIdleTimeout,
+		DiagnosticsWait: DefaultDiagnosticsWait,
+		ctx:             ctx,
+		cancel:          cancel,
+		clients:         make(map[clientKey]*client),
+		files:           make(map[string]FilesFunc),
+		results:         make(map[string]ResultFilesFunc),
+	}
+	go m.expire()
+	return m
+}
+
+// Close shuts down all servers.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	clients := slices.Collect(maps.Values(m.clients))
+	clear(m.clients)
+	m.closed = true
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.shutdown()
+		}()
+	}
+	wg.Wait()
+	m.cancel()
+}
+
+// expire shuts down servers which were not used for the idle timeout.
+func (m *Manager) expire() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var idle []*client
+		m.mu.Lock()
+		for key, c := range m.clients {
+			c.mu.Lock()
+			if m.IdleTimeout > 0 && c.active == 0 && time.Since(c.lastUse) > m.IdleTimeout {
+				idle = append(idle, c)
+				delete(m.clients, key)
+			}
+			c.mu.Unlock()
+		}
+		m.mu.Unlock()
+		for _, c := range idle {
+			log.Printf("Shutting down idle language server %s in %s", c.server.Name(), c.root)
+			c.shutdown()
+		}
+	}
+}
+
+// client returns the running server for path, starting it if needed, and the absolute
+// path. release must be called when the server is no longer used by the call.
+func (m *Manager) client(ctx context.Context, path string) (c *client, absPath string, release func(), err error) {
+	absPath, err = filesystem.ResolvePath(ctx, path)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	root, err := filesystem.ResolvePath(ctx, ".")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	i, ok := m.Servers.find(absPath)
+	if !ok {
+		return nil, "", nil, fmt.Errorf("no language server is configured for %s, only for the extensions %s", path, strings.Join(m.Servers.Extensions(), ", "))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, "", nil, fmt.Errorf("the language servers are shut down")
+	}
+	key := clientKey{server: i, root: root}
+	c = m.clients[key]
+	if c != nil && !c.running() {
+		log.Printf("Language server %s in %s exited, restarting it", c.server.Name(), root)
+		c = nil
+	}
+	if c == nil {
+		env, err := m.Env.Environ(os.Environ(), nil)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		// Starting under the lock keeps concurrent calls from starting the server twice
+		c, err = startClient(m.ctx, m.Servers[i], root, env, m.Sandbox)
+		if err != nil {
+			delete(m.clients, key)
+			return nil, "", nil, err
+		}
+		m.clients[key] = c
+	}
+
+	c.mu.Lock()
+	c.active++
+	c.mu.Unlock()
+	return c, absPath, func() {
+		c.mu.Lock()
+		c.active--
+		c.lastUse = time.Now()
+		c.mu.Unlock()
+	}, nil
+}
+
+// TrackFiles tells the servers about the files returned by fn after every call of tool.
+// Open documents are synchronised after every tool call anyway.
+func (m *Manager) TrackFiles(tool string, fn FilesFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[tool] = fn
+}
+
+// TrackResultFiles tells the servers about the files returned by fn after every successful
+// call of tool. It is meant for tools which only know the files they change when done.
+func (m *Manager) TrackResultFiles(tool string, fn ResultFilesFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results[tool] = fn
+}
+
+// Middleware is an MCP middleware which, after every tool call, sends the changed content
+// of open documents and the files changed by tracked tools to the servers of the session.
+func (m *Manager) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || method != "tools/call" {
+			return next(ctx, method, req)
+		}
+
+		m.mu.Lock()
+		filesFunc := m.files[call.Params.Name]
+		resultsFunc := m.results[call.Params.Name]
+		m.mu.Unlock()
+		existed := make(map[string]bool)
+		if filesFunc != nil {
+			for _, path := range filesFunc(ctx, call.Params.Arguments) {
+				_, err := os.Stat(path)
+				existed[path] = err == nil
+			}
+		}
+
+		res, err := next(ctx, method, req)
+
+		events := make(map[string]int)
+		for path, before := range existed {
+			_, err := os.Stat(path)
+			switch {
+			case err == nil && !before:
+				events[path] = fileCreated
+			case err == nil:
+				events[path] = fileChanged
+			case before:
+				events[path] = fileDeleted
+			}
+		}
+		if ctr, ok := res.(*mcp.CallToolResult); ok && ctr != nil && !ctr.IsError && err == nil && resultsFunc != nil {
+			for _, path := range resultsFunc(ctx, ctr) {
+				if _, ok := events[path]; ok {
+					continue
+				}
+				if _, err := os.Stat(path); err == nil {
+					events[path] = fileChanged
+				} else {
+					events[path] = fileDeleted
+				}
+			}
+		}
+		if root, err := filesystem.ResolvePath(ctx, "."); err == nil {
+			m.changed(root, events)
+		}
+		return res, err
+	}
+}
+
+// changed synchronises the open documents of the servers running in root and notifies
+// them about events, the types of file changes by path.
+func (m *Manager) changed(root string, events map[string]int) {
+	m.mu.Lock()
+	var clients []*client
+	for key, c := range m.clients {
+		if key.root == root && c.running() {
+			clients = append(clients, c)
+		}
+	}
+	m.mu.Unlock()
+
+	var changes []map[string]any
+	for _, path := range slices.Sorted(maps.Keys(events)) {
+		changes = append(changes, map[string]any{"uri": fileURI(path), "type": events[path]})
+	}
+	for _, c := range clients {
+		c.syncOpen()
+		c.saved(events)
+		if len(changes) > 0 {
+			c.conn.notify("workspace/didChangeWatchedFiles", map[string]any{"changes": changes})
+		}
+	}
+}
+
+// apply writes edits and tells the servers of root about them.
+func (m *Manager) apply(root string, edits *fileEdits) error {
+	if err := filesystem.ReplaceFiles(edits.before, edits.after); err != nil {
+		return err
+	}
+	events := make(map[string]int)
+	for path := range edits.after {
+		events[path] = fileChanged
+	}
+	m.changed(root, events)
+	return nil
+}
+
+// call sends a request to c, bounded by the request timeout.
+func (c *client) call(ctx context.Context, method string, params, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	return c.conn.call(ctx, method, params, result)
+}
+
+// Hover returns the documentation and type of the symbol at a position.
+func (m *Manager) Hover(ctx context.Context, args PositionArgs) (HoverResult, error) {
+	c, path, release, err := m.client(ctx, args.Path)
+	if err != nil {
+		return HoverResult{}, err
+	}
+	defer release()
+	params, _, err := c.position(path, args.Line, args.Column)
+	if err != nil {
+		return HoverResult{}, err
+	}
+	var hover *struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if err := c.call(ctx, "textDocument/hover", params, &hover); err != nil {
+		return HoverResult{}, err
+	}
+	if hover == nil {
+		return HoverResult{}, nil
+	}
+	return HoverResult{Contents: hoverText(hover.Contents)}, nil
+}
+
+// Definition returns where the symbol at a position is defined.
+func (m *Manager) Definition(ctx context.Context, args PositionArgs) (LocationsResult, error) {
+	c, path, release, err := m.client(ctx, args.Path)
+	if err != nil {
+		return LocationsResult{}, err
+	}
+	defer release()
+	params, _, err := c.position(path, args.Line, args.Column)
+	if err != nil {
+		return LocationsResult{}, err
+	}
+	var raw json.RawMessage
+	if err := c.call(ctx, "textDocument/definition", params, &raw); err != nil {
+		return LocationsResult{}, err
+	}
+	return locations(ctx, definitionLocations(raw)), nil
+}
+
+// References returns the uses of the symbol at a position.
+func (m *Manager) References(ctx context.Context, args ReferencesArgs) (LocationsResult, error) {
+	c, path, release, err := m.client(ctx, args.Path)
+	if err != nil {
+		return LocationsResult{}, err
+	}
+	defer release()
+	params, _, err := c.position(path, args.Line, args.Column)
+	if err != nil {
+		return LocationsResult{}, err
+	}
+	var refs []location
+	err = c.call(ctx, "textDocument/references", map[string]any{
+		"textDocument": params.TextDocument,
+		"position":     params.Position,
+		"context":      map[string]bool{"includeDeclaration": args.IncludeDeclaration},
+	}, &refs)
+	if err != nil {
+		return LocationsResult{}, err
+	}
+	return locations(ctx, refs), nil
+}
+
+// locations converts the locations of a server with the source lines of files in the
+// working directory of ctx.
+func locations(ctx context.Context, locs []location) LocationsResult {
+	result := LocationsResult{Locations: []Location{}}
+	root, _ := filesystem.ResolvePath(ctx, ".")
+	contents := make(map[string][]byte)
+	for _, loc := range locs {
+		if len(result.Locations) == maxLocations {
+			result.Truncated = true
+			break
+		}
+		path, err := uriPath(loc.URI)
+		if err != nil {
+			continue
+		}
+		content, ok := contents[path]
+		if !ok {
+			// Files outside of the working directory are only read to convert the columns
+			content, _ = os.ReadFile(path)
+			contents[path] = content
+		}
+		l := Location{File: relative(root, path)}
+		l.Line, l.Column = fromPosition(content, loc.Range.Start)
+		l.EndLine, l.EndCol = fromPosition(content, loc.Range.End)
+		if _, err := filesystem.ResolvePath(ctx, path); err == nil {
+			if all := lines(content); l.Line <= len(all) {
+				l.Text = strings.TrimSpace(string(all[l.Line-1]))
+			}
+		}
+		result.Locations = append(result.Locations, l)
+	}
+	slices.SortStableFunc(result.Locations, func(a, b Location) int {
+		return cmpLocation(a, b)
+	})
+	return result
+}
+
+// cmpLocation orders locations by file and position.
+func cmpLocation(a, b Location) int {
+	if c := strings.Compare(a.File, b.File); c != 0 {
+		return c
+	}
+	if a.Line != b.Line {
+		return a.Line - b.Line
+	}
+	return a.Column - b.Column
+}
+
+// Diagnostics returns the errors and warnings a server reports for a file. If the file
+// changed since the server last saw it, it waits for the server to check it again.
+func (m *Manager) Diagnostics(ctx context.Context, args DiagnosticsArgs) (DiagnosticsResult, error) {
+	c, path, release, err := m.client(ctx, args.Path)
+	if err != nil {
+		return DiagnosticsResult{}, err
+	}
+	defer release()
+	content, _, err := c.sync(path)
+	if err != nil {
+		return DiagnosticsResult{}, err
+	}
+	raw, timedOut, err := c.waitDiagnostics(ctx, path, m.DiagnosticsWait)
+	if err != nil {
+		return DiagnosticsResult{}, err
+	}
+
+	result := DiagnosticsResult{Diagnostics: []Diagnostic{}, TimedOut: timedOut}
+	for _, r := range raw {
+		var d diagnostic
+		if err := json.Unmarshal(r, &d); err != nil {
+			continue
+		}
+		out := Diagnostic{Severity: "error", Source: d.Source, Message: d.Message}
+		if d.Severity > 0 && d.Severity < len(severities) {
+			out.Severity = severities[d.Severity]
+		}
+		var code string
+		if json.Unmarshal(d.Code, &code) != nil {
+			code = string(d.Code)
+		}
+		out.Code = code
+		out.Line, out.Column = fromPosition(content, d.Range.Start)
+		out.EndLine, out.EndColumn = fromPosition(content, d.Range.End)
+		result.Diagnostics = append(result.Diagnostics, out)
+	}
+	return result, nil
+}
+
+// Rename renames the symbol at a position in all files. Without args.Apply only the diff is returned.
+func (m *Manager) Rename(ctx context.Context, args RenameArgs) (EditResult, error) {
+	c, path, release, err := m.client(ctx, args.Path)
+	if err != nil {
+		return EditResult{}, err
+	}
+	defer release()
+	params, _, err := c.position(path, args.Line, args.Column)
+	if err != nil {
+		return EditResult{}, err
+	}
+	var edit *workspaceEdit
+	err = c.call(ctx, "textDocument/rename", map[string]any{
+		"textDocument": params.TextDocument,
+		"position":     params.Position,
+		"newName":      args.NewName,
+	}, &edit)
+	if err != nil {
+		return EditResult{}, err
+	}
+	if edit == nil {
+		return EditResult{}, fmt.Errorf("there is nothing to rename at %s:%d:%d", args.Path, args.Line, args.Column)
+	}
+	edits, err := prepare(ctx, *edit)
+	if err != nil {
+		return EditResult{}, err
+	}
+	if args.Apply {
+		if err := m.apply(c.root, edits); err != nil {
+			return EditResult{}, err
+		}
+	}
+	return edits.result(c.root, args.Apply), nil
+}
+
+// PreviewRename returns the unified diff Rename would apply for args.
+func (m *Manager) PreviewRename(ctx context.Context, args RenameArgs) (string, error) {
+	args.Apply = false
+	result, err := m.Rename(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Rename the symbol at %s:%d:%d to %s:\n\n%s", args.Path, args.Line, args.Column, args.NewName, result.Diff), nil
+}
+
+// CodeActions lists the quick fixes and refactorings for a range, or applies the one
+// titled args.Apply.
+func (m *Manager) CodeActions(ctx context.Context, args CodeActionsArgs) (CodeActionsResult, error) {
+	c, path, release, err := m.client(ctx, args.Path)
+	if err != nil {
+		return CodeActionsResult{}, err
+	}
+	defer release()
+	items, err := c.codeActions(ctx, path, args)
+	if err != nil {
+		return CodeActionsResult{}, err
+	}
+
+	if args.Apply != "" {
+		action, cmd, err := c.findAction(ctx, items, args.Apply)
+		if err != nil {
+			return CodeActionsResult{}, err
+		}
+		edits := newFileEdits()
+		if action.Edit != nil {
+			e, err := prepare(ctx, *action.Edit)
+			if err != nil {
+				return CodeActionsResult{}, err
+			}
+			if err := m.apply(c.root, e); err != nil {
+				return CodeActionsResult{}, err
+			}
+			edits.merge(e)
+		}
+		if cmd != nil {
+			e, err := c.execute(ctx, *cmd)
+			if err != nil {
+				return CodeActionsResult{}, fmt.Errorf("the command of the code action '%s' failed: %v", action.Title, err)
+			}
+			edits.merge(e)
+		}
+		result := edits.result(c.root, true)
+		return CodeActionsResult{Applied: &result}, nil
+	}
+
+	result := CodeActionsResult{Actions: []CodeAction{}}
+	for _, item := range items {
+		action, _ := parseAction(item)
+		a := CodeAction{Title: action.Title, Kind: action.Kind, Preferred: action.IsPreferred}
+		if action.Disabled != nil {
+			a.Disabled = cmp.Or(action.Disabled.Reason, "disabled")
+		}
+		result.Actions = append(result.Actions, a)
+	}
+	return result, nil
+}
+
+// PreviewCodeAction returns the unified diff of the code action args.Apply. The edits of
+// its command, if any, are only known once the server runs it.
+func (m *Manager) PreviewCodeAction(ctx context.Context, args CodeActionsArgs) (string, error) {
+	c, path, release, err := m.client(ctx, args.Path)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	items, err := c.codeActions(ctx, path, args)
+	if err != nil {
+		return "", err
+	}
+	action, cmd, err := c.findAction(ctx, items, args.Apply)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Apply the code action %q at %s:%d:%d", args.Apply, args.Path, args.Line, args.Column)
+	if action.Edit != nil {
+		edits, err := prepare(ctx, *action.Edit)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, ":\n\n%s", edits.result(c.root, false).Diff)
+	}
+	if cmd != nil {
+		fmt.Fprintf(&b, "\n\nThe action runs the command %s of the language server, its edits are not known in advance.", cmd.Command)
+	}
+	return b.String(), nil
+}
+
+// codeActions returns the code actions of the server for the range of args in path,
+// passing the diagnostics of the range for quick fixes.
+func (c *client) codeActions(ctx context.Context, path string, args CodeActionsArgs) ([]json.RawMessage, error) {
+	params, content, err := c.position(path, args.Line, args.Column)
+	if err != nil {
+		return nil, err
+	}
+	end := params.Position
+	if args.EndLine > 0 {
+		if end, err = toPosition(content, args.EndLine, max(args.EndColumn, 1)); err != nil {
+			return nil, err
+		}
+	}
+	rng := lspRange{Start: params.Position, End: end}
+
+	c.mu.Lock()
+	published := c.diagnostics[path].diagnostics
+	c.mu.Unlock()
+	diagnostics := []json.RawMessage{}
+	for _, raw := range published {
+		var d diagnostic
+		if json.Unmarshal(raw, &d) == nil && overlaps(d.Range, rng) {
+			diagnostics = append(diagnostics, raw)
+		}
+	}
+
+	var items []json.RawMessage
+	err = c.call(ctx, "textDocument/codeAction", map[string]any{
+		"textDocument": params.TextDocument,
+		"range":        rng,
+		"context":      map[string]any{"diagnostics": diagnostics, "triggerKind": 1},
+	}, &items)
+	return items, err
+}
+
+// findAction returns the action of items titled title with its edit resolved, and its command.
+func (c *client) findAction(ctx context.Context, items []json.RawMessage, title string) (codeAction, *command, error) {
+	var titles []string
+	for _, item := range items {
+		action, cmd := parseAction(item)
+		titles = append(titles, action.Title)
+		if action.Title != title {
+			continue
+		}
+		if action.Disabled != nil {
+			return codeAction{}, nil, fmt.Errorf("the code action '%s' is disabled: %s", action.Title, action.Disabled.Reason)
+		}
+		if action.Edit == nil && cmd == nil {
+			// The edit of the action is computed on demand
+			var resolved json.RawMessage
+			if err := c.call(ctx, "codeAction/resolve", item, &resolved); err != nil {
+				return codeAction{}, nil, err
+			}
+			action, cmd = parseAction(resolved)
+		}
+		return action, cmd, nil
+	}
+	return codeAction{}, nil, fmt.Errorf("there is no code action '%s', available are: %s", title, strings.Join(titles, "; "))
+}
+
+// parseAction parses a code action or a bare command and returns the command to execute, if any.
+func parseAction(raw json.RawMessage) (codeAction, *command) {
+	var action codeAction
+	json.Unmarshal(raw, &action)
+	var name string
+	if json.Unmarshal(action.Command, &name) == nil {
+		var cmd command
+		json.Unmarshal(raw, &cmd)
+		return codeAction{Title: cmd.Title}, &cmd
+	}
+	var cmd *command
+	if len(action.Command) > 0 && string(action.Command) != "null" {
+		cmd = new(command)
+		json.Unmarshal(action.Command, cmd)
+	}
+	return action, cmd
+}
+
+// overlaps reports whether two ranges share a position. Empty ranges overlap ranges containing them.
+func overlaps(a, b lspRange) bool {
+	return !before(a.End, b.Start) && !before(b.End, a.Start)
+}
+
+func before(a, b position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+}
@@ -0,0 +1,459 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/seb-schulz/mcpilot-pair/internal/runner"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
+)
+
+// fakeServerEnv makes the test binary run [fakeServer] instead of the tests.
+const fakeServerEnv = "MCPILOT_FAKE_LANGUAGE_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeServerEnv) == "1" {
+		fakeServer()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// word matches the identifiers of the fake language.
+var word = regexp.MustCompile(`[A-Za-z_]+`)
+
+// fakeServer is a language server for .fake files: every word is a symbol defined by its
+// first occurrence, and every TODO is reported as a warning.
+func fakeServer() {
+	docs := make(map[string]string)
+	// notified lists the file notifications received, as "method uri"
+	var notified []string
+	var c *conn
+	// wordAt returns the URI, the word and the ranges of all its occurrences.
+	wordAt := func(params json.RawMessage) (string, string, []lspRange) {
+		var p textDocumentPositionParams
+		json.Unmarshal(params, &p)
+		content := []byte(docs[p.TextDocument.URI])
+		line := lines(content)[p.Position.Line]
+		column := byteColumn(line, p.Position.Character)
+		var name string
+		for _, loc := range word.FindAllIndex(line, -1) {
+			if loc[0] <= column && column < loc[1] {
+				name = string(line[loc[0]:loc[1]])
+			}
+		}
+		var ranges []lspRange
+		for i, l := range lines(content) {
+			for _, loc := range word.FindAllIndex(l, -1) {
+				if string(l[loc[0]:loc[1]]) == name {
+					ranges = append(ranges, lspRange{
+						Start: position{Line: i, Character: utf16Len(l[:loc[0]])},
+						End:   position{Line: i, Character: utf16Len(l[:loc[1]])},
+					})
+				}
+			}
+		}
+		return p.TextDocument.URI, name, ranges
+	}
+	publish := func(uri string, version int) {
+		diagnostics := []diagnostic{}
+		for i, l := range lines([]byte(docs[uri])) {
+			if j := strings.Index(string(l), "TODO"); j >= 0 {
+				diagnostics = append(diagnostics, diagnostic{
+					Range:    lspRange{Start: position{i, utf16Len(l[:j])}, End: position{i, utf16Len(l[:j+4])}},
+					Severity: 2,
+					Code:     json.RawMessage(`"todo"`),
+					Source:   "fake",
+					Message:  "unresolved TODO",
+				})
+			}
+		}
+		c.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "version": version, "diagnostics": diagnostics})
+	}
+
+	c = newConn(os.Stdout, func(ctx context.Context, method string, params json.RawMessage) (any, error) {
+		switch method {
+		case "initialize":
+			return map[string]any{"capabilities": map[string]any{"textDocumentSync": 1}}, nil
+		case "shutdown":
+			return nil, nil
+		case "exit":
+			os.Exit(0)
+		case "textDocument/didOpen":
+			var p struct {
+				TextDocument struct {
+					URI     string `json:"uri"`
+					Version int    `json:"version"`
+					Text    string `json:"text"`
+				} `json:"textDocument"`
+			}
+			json.Unmarshal(params, &p)
+			docs[p.TextDocument.URI] = p.TextDocument.Text
+			publish(p.TextDocument.URI, p.TextDocument.Version)
+		case "textDocument/didChange":
+			var p struct {
+				TextDocument struct {
+					URI     string `json:"uri"`
+					Version int    `json:"version"`
+				} `json:"textDocument"`
+				ContentChanges []struct {
+					Text string `json:"text"`
+				} `json:"contentChanges"`
+			}
+			json.Unmarshal(params, &p)
+			docs[p.TextDocument.URI] = p.ContentChanges[0].Text
+			publish(p.TextDocument.URI, p.TextDocument.Version)
+		case "textDocument/didSave":
+			var p struct {
+				TextDocument textDocumentIdentifier `json:"textDocument"`
+			}
+			json.Unmarshal(params, &p)
+			notified = append(notified, method+" "+p.TextDocument.URI)
+		case "workspace/didChangeWatchedFiles":
+			var p struct {
+				Changes []struct {
+					URI string `json:"uri"`
+				} `json:"changes"`
+			}
+			json.Unmarshal(params, &p)
+			for _, change := range p.Changes {
+				notified = append(notified, method+" "+change.URI)
+			}
+		case "fake/notified":
+			return notified, nil
+		case "textDocument/hover":
+			_, name, _ := wordAt(params)
+			return map[string]any{"contents": map[string]string{"kind": "markdown", "value": "`" + name + "` is a word"}}, nil
+		case "textDocument/definition":
+			uri, _, ranges := wordAt(params)
+			return []location{{URI: uri, Range: ranges[0]}}, nil
+		case "textDocument/references":
+			uri, _, ranges := wordAt(params)
+			var p struct {
+				Context struct {
+					IncludeDeclaration bool `json:"includeDeclaration"`
+				} `json:"context"`
+			}
+			json.Unmarshal(params, &p)
+			if !p.Context.IncludeDeclaration {
+				ranges = ranges[1:]
+			}
+			var locs []location
+			for _, r := range ranges {
+				locs = append(locs, location{URI: uri, Range: r})
+			}
+			return locs, nil
+		case "textDocument/rename":
+			uri, _, ranges := wordAt(params)
+			var p struct {
+				NewName string `json:"newName"`
+			}
+			json.Unmarshal(params, &p)
+			var edits []textEdit
+			for _, r := range ranges {
+				edits = append(edits, textEdit{Range: r, NewText: p.NewName})
+			}
+			return workspaceEdit{Changes: map[string][]textEdit{uri: edits}}, nil
+		case "textDocument/codeAction":
+			var p struct {
+				TextDocument textDocumentIdentifier `json:"textDocument"`
+				Range        lspRange               `json:"range"`
+				Context      struct {
+					Diagnostics []diagnostic `json:"diagnostics"`
+				} `json:"context"`
+			}
+			json.Unmarshal(params, &p)
+			args, _ := json.Marshal(textDocumentPositionParams{TextDocument: p.TextDocument, Position: p.Range.Start})
+			actions := []any{
+				map[string]any{"title": "Uppercase word", "kind": "refactor.rewrite", "command": command{Title: "Uppercase word", Command: "fake.upper", Arguments: []json.RawMessage{args}}},
+			}
+			for _, d := range p.Context.Diagnostics {
+				edit := workspaceEdit{Changes: map[string][]textEdit{p.TextDocument.URI: {{Range: d.Range, NewText: "DONE"}}}}
+				actions = append(actions, map[string]any{"title": "Resolve TODO", "kind": "quickfix", "isPreferred": true, "edit": edit})
+			}
+			return actions, nil
+		case "workspace/executeCommand":
+			var p struct {
+				Arguments []json.RawMessage `json:"arguments"`
+			}
+			json.Unmarshal(params, &p)
+			uri, name, ranges := wordAt(p.Arguments[0])
+			var edits []textEdit
+			for _, r := range ranges {
+				edits = append(edits, textEdit{Range: r, NewText: strings.ToUpper(name)})
+			}
+			var result struct {
+				Applied bool `json:"applied"`
+			}
+			if err := c.call(ctx, "workspace/applyEdit", map[string]any{"edit": workspaceEdit{Changes: map[string][]textEdit{uri: edits}}}, &result); err != nil || !result.Applied {
+				return nil, &rpcError{Code: 1, Message: "edit not applied"}
+			}
+			return nil, nil
+		}
+		return nil, nil
+	})
+	c.read(os.Stdin)
+}
+
+// setupManager creates a working directory with files and a manager for the fake server.
+func setupManager(t *testing.T, files map[string]string) *Manager {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	m := NewManager(Servers{{Extensions: []string{"fake"}, Command: []string{os.Args[0]}}})
+	m.Env = runner.EnvPolicy{Pass: []string{"*"}, Set: []string{fakeServerEnv + "=1"}}
+	m.DiagnosticsWait = 5 * time.Second
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestParseServer(t *testing.T) {
+	tests := []struct {
+		in, want, err string
+	}{
+		{"go=gopls", "go=gopls", ""},
+		{" .py, pyi = pyright-langserver  --stdio", "py,pyi=pyright-langserver --stdio", ""},
+		{"gopls", "", "invalid language server"},
+		{"go=", "", "missing command"},
+		{"go,=gopls", "", "invalid extension"},
+	}
+	for _, tc := range tests {
+		server, err := ParseServer(tc.in)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("ParseServer(%q): expected error %q, got %v", tc.in, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || server.String() != tc.want {
+			t.Errorf("ParseServer(%q) = %q, %v, want %q", tc.in, server, err, tc.want)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	content := []byte("héllo 𝔘x\r\nsecond")
+	pos, err := toPosition(content, 1, 12)
+	if err != nil || pos != (position{Line: 0, Character: 8}) {
+		t.Errorf("toPosition = %+v, %v", pos, err)
+	}
+	if line, column := fromPosition(content, pos); line != 1 || column != 12 {
+		t.Errorf("fromPosition = %d:%d", line, column)
+	}
+	if _, err := toPosition(content, 3, 1); err == nil {
+		t.Error("Expected an error for a line out of range")
+	}
+
+	edited, err := applyEdits(content, []textEdit{
+		{Range: lspRange{Start: position{1, 0}, End: position{1, 6}}, NewText: "2nd"},
+		{Range: lspRange{Start: position{0, 8}, End: position{0, 9}}, NewText: "y"},
+	})
+	if err != nil || string(edited) != "héllo 𝔘y\r\n2nd" {
+		t.Errorf("applyEdits = %q, %v", edited, err)
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	m := setupManager(t, map[string]string{"a.fake": "alpha beta\nbeta gamma\n", "a.txt": "text"})
+	ctx := context.Background()
+
+	hover, err := m.Hover(ctx, PositionArgs{Path: "a.fake", Line: 2, Column: 2})
+	if err != nil || hover.Contents != "`beta` is a word" {
+		t.Errorf("Hover = %+v, %v", hover, err)
+	}
+
+	def, err := m.Definition(ctx, PositionArgs{Path: "a.fake", Line: 2, Column: 1})
+	want := Location{File: "a.fake", Line: 1, Column: 7, EndLine: 1, EndCol: 11, Text: "alpha beta"}
+	if err != nil || len(def.Locations) != 1 || def.Locations[0] != want {
+		t.Errorf("Definition = %+v, %v", def, err)
+	}
+
+	refs, err := m.References(ctx, ReferencesArgs{Path: "a.fake", Line: 1, Column: 7})
+	if err != nil || len(refs.Locations) != 1 || refs.Locations[0].Line != 2 {
+		t.Errorf("References = %+v, %v", refs, err)
+	}
+	refs, err = m.References(ctx, ReferencesArgs{Path: "a.fake", Line: 1, Column: 7, IncludeDeclaration: true})
+	if err != nil || len(refs.Locations) != 2 {
+		t.Errorf("References = %+v, %v", refs, err)
+	}
+
+	if _, err := m.Hover(ctx, PositionArgs{Path: "a.txt", Line: 1, Column: 1}); err == nil || !strings.Contains(err.Error(), "only for the extensions fake") {
+		t.Errorf("Expected an error for a file without server, got %v", err)
+	}
+	if _, err := m.Hover(ctx, PositionArgs{Path: "a.fake", Line: 9, Column: 1}); err == nil {
+		t.Error("Expected an error for a line out of range")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	m := setupManager(t, map[string]string{"a.fake": "one\nTODO two\n"})
+	ctx := context.Background()
+
+	result, err := m.Diagnostics(ctx, DiagnosticsArgs{Path: "a.fake"})
+	want := Diagnostic{Line: 2, Column: 1, EndLine: 2, EndColumn: 5, Severity: "warning", Source: "fake", Code: "todo", Message: "unresolved TODO"}
+	if err != nil || result.TimedOut || len(result.Diagnostics) != 1 || result.Diagnostics[0] != want {
+		t.Fatalf("Diagnostics = %+v, %v", result, err)
+	}
+
+	// Changes by other tools are sent to the server before diagnostics are returned
+	if err := os.WriteFile("a.fake", []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = m.Diagnostics(ctx, DiagnosticsArgs{Path: "a.fake"})
+	if err != nil || result.TimedOut || len(result.Diagnostics) != 0 {
+		t.Errorf("Diagnostics after the change = %+v, %v", result, err)
+	}
+}
+
+func TestRename(t *testing.T) {
+	m := setupManager(t, map[string]string{"a.fake": "alpha beta\nbeta gamma\n"})
+	ctx := context.Background()
+
+	result, err := m.Rename(ctx, RenameArgs{Path: "a.fake", Line: 1, Column: 7, NewName: "delta"})
+	if err != nil || result.Applied || strings.Join(result.Files, ",") != "a.fake" || !strings.Contains(result.Diff, "+alpha delta\n+delta gamma\n") {
+		t.Fatalf("Rename = %+v, %v", result, err)
+	}
+	if data, _ := os.ReadFile("a.fake"); string(data) != "alpha beta\nbeta gamma\n" {
+		t.Errorf("The preview changed the file: %q", data)
+	}
+
+	result, err = m.Rename(ctx, RenameArgs{Path: "a.fake", Line: 1, Column: 7, NewName: "delta", Apply: true})
+	if err != nil || !result.Applied {
+		t.Fatalf("Rename = %+v, %v", result, err)
+	}
+	if data, _ := os.ReadFile("a.fake"); string(data) != "alpha delta\ndelta gamma\n" {
+		t.Errorf("Unexpected content after rename: %q", data)
+	}
+	// The server got the new content
+	hover, err := m.Hover(ctx, PositionArgs{Path: "a.fake", Line: 2, Column: 1})
+	if err != nil || hover.Contents != "`delta` is a word" {
+		t.Errorf("Hover after rename = %+v, %v", hover, err)
+	}
+}
+
+func TestCodeActions(t *testing.T) {
+	m := setupManager(t, map[string]string{"a.fake": "alpha TODO\nalpha\n"})
+	ctx := context.Background()
+
+	// The diagnostics of the range are passed to the server
+	if _, err := m.Diagnostics(ctx, DiagnosticsArgs{Path: "a.fake"}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := m.CodeActions(ctx, CodeActionsArgs{Path: "a.fake", Line: 1, Column: 7})
+	if err != nil || len(result.Actions) != 2 || result.Actions[1] != (CodeAction{Title: "Resolve TODO", Kind: "quickfix", Preferred: true}) {
+		t.Fatalf("CodeActions = %+v, %v", result, err)
+	}
+
+	// The preview shows the edit without applying it
+	preview, err := m.PreviewCodeAction(ctx, CodeActionsArgs{Path: "a.fake", Line: 1, Column: 7, Apply: "Resolve TODO"})
+	if err != nil || !strings.Contains(preview, "-alpha TODO\n+alpha DONE\n") {
+		t.Fatalf("PreviewCodeAction = %q, %v", preview, err)
+	}
+	if data, _ := os.ReadFile("a.fake"); string(data) != "alpha TODO\nalpha\n" {
+		t.Errorf("The preview changed the file: %q", data)
+	}
+	preview, err = m.PreviewCodeAction(ctx, CodeActionsArgs{Path: "a.fake", Line: 2, Column: 1, Apply: "Uppercase word"})
+	if err != nil || !strings.Contains(preview, "runs the command fake.upper") {
+		t.Errorf("PreviewCodeAction = %q, %v", preview, err)
+	}
+
+	result, err = m.CodeActions(ctx, CodeActionsArgs{Path: "a.fake", Line: 1, Column: 7, Apply: "Resolve TODO"})
+	if err != nil || result.Applied == nil || !strings.Contains(result.Applied.Diff, "+alpha DONE\n") {
+		t.Fatalf("CodeActions = %+v, %v", result, err)
+	}
+
+	// The command of the action makes the server apply an edit
+	result, err = m.CodeActions(ctx, CodeActionsArgs{Path: "a.fake", Line: 2, Column: 1, Apply: "Uppercase word"})
+	if err != nil || result.Applied == nil || strings.Join(result.Applied.Files, ",") != "a.fake" {
+		t.Fatalf("CodeActions = %+v, %v", result, err)
+	}
+	if data, _ := os.ReadFile("a.fake"); string(data) != "ALPHA DONE\nALPHA\n" {
+		t.Errorf("Unexpected content after code actions: %q", data)
+	}
+
+	if _, err := m.CodeActions(ctx, CodeActionsArgs{Path: "a.fake", Line: 1, Column: 1, Apply: "Missing"}); err == nil || !strings.Contains(err.Error(), "available are: Uppercase word") {
+		t.Errorf("Expected an error for an unknown action, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	m := setupManager(t, map[string]string{"a.fake": "alpha\n", "b.fake": "beta\n"})
+	ctx := context.Background()
+
+	type formatResult struct {
+		Files []string `json:"files"`
+	}
+	srv := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(srv, &mcp.Tool{Name: "format"}, func(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, formatResult, error) {
+		for _, name := range []string{"a.fake", "b.fake"} {
+			if err := os.WriteFile(name, []byte("formatted\n"), 0644); err != nil {
+				return nil, formatResult{}, err
+			}
+		}
+		return &mcp.CallToolResult{}, formatResult{Files: []string{"a.fake", "b.fake"}}, nil
+	})
+	m.TrackResultFiles("format", ResultFiles(func(ctx context.Context, result formatResult) []string {
+		var paths []string
+		for _, f := range result.Files {
+			if path, err := filesystem.ResolvePath(ctx, f); err == nil {
+				paths = append(paths, path)
+			}
+		}
+		return paths
+	}))
+	srv.AddReceivingMiddleware(m.Middleware)
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	ss, err := srv.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect server: %v", err)
+	}
+	defer ss.Close()
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil).Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer cs.Close()
+
+	// a.fake is open in the server, b.fake is not
+	if _, err := m.Hover(ctx, PositionArgs{Path: "a.fake", Line: 1, Column: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "format", Arguments: map[string]any{}}); err != nil || res.IsError {
+		t.Fatalf("Failed to call format: %+v, %v", res, err)
+	}
+
+	hover, err := m.Hover(ctx, PositionArgs{Path: "a.fake", Line: 1, Column: 1})
+	if err != nil || hover.Contents != "`formatted` is a word" {
+		t.Errorf("Hover after formatting = %+v, %v", hover, err)
+	}
+	c, _, release, err := m.client(ctx, "a.fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	var notified []string
+	if err := c.call(ctx, "fake/notified", nil, &notified); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := filesystem.ResolvePath(ctx, "a.fake")
+	b, _ := filesystem.ResolvePath(ctx, "b.fake")
+	want := []string{
+		"textDocument/didSave " + fileURI(a),
+		"workspace/didChangeWatchedFiles " + fileURI(a),
+		"workspace/didChangeWatchedFiles " + fileURI(b),
+	}
+	if strings.Join(notified, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected notifications %q, got %q", want, notified)
+	}
+}
@@ -0,0 +1,301 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The types of the Language Server Protocol used by the bridge. Positions count lines
+// from 0 and characters in UTF-16 code units.
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+// locationLink is returned by servers instead of a location if the client supports it.
+type locationLink struct {
+	TargetURI            string   `json:"targetUri"`
+	TargetSelectionRange lspRange `json:"targetSelectionRange"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+type textEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+// workspaceEdit holds the changes of a rename or code action. Entries of
+// documentChanges creating, renaming or deleting files have a kind.
+type workspaceEdit struct {
+	Changes         map[string][]textEdit `json:"changes,omitempty"`
+	DocumentChanges []struct {
+		Kind         string                 `json:"kind,omitempty"`
+		TextDocument textDocumentIdentifier `json:"textDocument"`
+		Edits        []textEdit             `json:"edits"`
+	} `json:"documentChanges,omitempty"`
+}
+
+type diagnostic struct {
+	Range    lspRange        `json:"range"`
+	Severity int             `json:"severity,omitempty"`
+	Code     json.RawMessage `json:"code,omitempty"`
+	Source   string          `json:"source,omitempty"`
+	Message  string          `json:"message"`
+}
+
+type command struct {
+	Title     string            `json:"title"`
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments,omitempty"`
+}
+
+// codeAction is a code action or, from older servers, a bare command.
+type codeAction struct {
+	Title       string       `json:"title"`
+	Kind        string       `json:"kind,omitempty"`
+	Diagnostics []diagnostic `json:"diagnostics,omitempty"`
+	IsPreferred bool         `json:"isPreferred,omitempty"`
+	Disabled    *struct {
+		Reason string `json:"reason"`
+	} `json:"disabled,omitempty"`
+	Edit    *workspaceEdit  `json:"edit,omitempty"`
+	Command json.RawMessage `json:"command,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// severities names the diagnostic severities, which start at 1.
+var severities = []string{"", "error", "warning", "information", "hint"}
+
+// languageIDs maps file extensions to the language identifiers of the protocol where they differ.
+var languageIDs = map[string]string{
+	"py":   "python",
+	"pyi":  "python",
+	"rs":   "rust",
+	"ts":   "typescript",
+	"mts":  "typescript",
+	"cts":  "typescript",
+	"tsx":  "typescriptreact",
+	"js":   "javascript",
+	"mjs":  "javascript",
+	"cjs":  "javascript",
+	"jsx":  "javascriptreact",
+	"rb":   "ruby",
+	"h":    "c",
+	"cc":   "cpp",
+	"cxx":  "cpp",
+	"hpp":  "cpp",
+	"cs":   "csharp",
+	"kt":   "kotlin",
+	"md":   "markdown",
+	"sh":   "shellscript",
+	"yml":  "yaml",
+	"bash": "shellscript",
+}
+
+// languageID returns the language identifier of a file.
+func languageID(path string) string {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if id, ok := languageIDs[ext]; ok {
+		return id
+	}
+	return ext
+}
+
+// fileURI returns the URI of an absolute path.
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// uriPath returns the absolute path of a file URI.
+func uriPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported URI %s", uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+// lines splits content into lines without their line breaks.
+func lines(content []byte) [][]byte {
+	lines := bytes.Split(content, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimSuffix(line, []byte("\r"))
+	}
+	return lines
+}
+
+// toPosition converts a 1-based line and byte column of content to a protocol position.
+func toPosition(content []byte, line, column int) (position, error) {
+	all := lines(content)
+	if line < 1 || line > len(all) {
+		return position{}, fmt.Errorf("line %d is out of range, the file has %d lines", line, len(all))
+	}
+	text := all[line-1]
+	if column < 1 || column > len(text)+1 {
+		return position{}, fmt.Errorf("column %d is out of range, line %d has %d bytes", column, line, len(text))
+	}
+	return position{Line: line - 1, Character: utf16Len(text[:column-1])}, nil
+}
+
+// fromPosition converts a protocol position to a 1-based line and byte column of content.
+func fromPosition(content []byte, pos position) (int, int) {
+	all := lines(content)
+	if pos.Line >= len(all) {
+		return pos.Line + 1, pos.Character + 1
+	}
+	return pos.Line + 1, byteColumn(all[pos.Line], pos.Character) + 1
+}
+
+// utf16Len returns the number of UTF-16 code units of text.
+func utf16Len(text []byte) int {
+	n := 0
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		n += utf16.RuneLen(r)
+		text = text[size:]
+	}
+	return n
+}
+
+// byteColumn returns the byte offset of the UTF-16 offset character in line, clamped to its end.
+func byteColumn(line []byte, character int) int {
+	offset := 0
+	for offset < len(line) && character > 0 {
+		r, size := utf8.DecodeRune(line[offset:])
+		character -= utf16.RuneLen(r)
+		offset += size
+	}
+	return offset
+}
+
+// offset returns the byte offset of a position in content.
+func offset(content []byte, pos position) (int, error) {
+	start := 0
+	for range pos.Line {
+		i := bytes.IndexByte(content[start:], '\n')
+		if i < 0 {
+			return 0, fmt.Errorf("line %d is out of range", pos.Line+1)
+		}
+		start += i + 1
+	}
+	end := len(content)
+	if i := bytes.IndexByte(content[start:], '\n'); i >= 0 {
+		end = start + i
+	}
+	return start + byteColumn(bytes.TrimSuffix(content[start:end], []byte("\r")), pos.Character), nil
+}
+
+// applyEdits returns content with edits applied. Edits must not overlap.
+func applyEdits(content []byte, edits []textEdit) ([]byte, error) {
+	type span struct {
+		start, end int
+		text       string
+	}
+	spans := make([]span, 0, len(edits))
+	for _, e := range edits {
+		start, err := offset(content, e.Range.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := offset(content, e.Range.End)
+		if err != nil {
+			return nil, err
+		}
+		if end < start {
+			return nil, fmt.Errorf("invalid edit range")
+		}
+		spans = append(spans, span{start, end, e.NewText})
+	}
+	// Edits at the same position are applied in their order
+	slices.SortStableFunc(spans, func(a, b span) int { return a.start - b.start })
+
+	var b bytes.Buffer
+	last := 0
+	for _, s := range spans {
+		if s.start < last {
+			return nil, fmt.Errorf("overlapping edits")
+		}
+		b.Write(content[last:s.start])
+		b.WriteString(s.text)
+		last = s.end
+	}
+	b.Write(content[last:])
+	return b.Bytes(), nil
+}
+
+// hoverText renders the contents of a hover, which are markup content, a marked
+// string or a list of marked strings.
+func hoverText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) == nil {
+		var parts []string
+		for _, item := range list {
+			if text := hoverText(item); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	var marked struct {
+		Language string `json:"language"`
+		Value    string `json:"value"`
+	}
+	if json.Unmarshal(raw, &marked) == nil && marked.Language != "" {
+		return "```" + marked.Language + "\n" + marked.Value + "\n```"
+	}
+	return marked.Value
+}
+
+// definitionLocations parses the result of a definition request: a location, a list of
+// locations or a list of location links.
+func definitionLocations(raw json.RawMessage) []location {
+	var single location
+	if json.Unmarshal(raw, &single) == nil && single.URI != "" {
+		return []location{single}
+	}
+	var items []json.RawMessage
+	json.Unmarshal(raw, &items)
+	var locations []location
+	for _, item := range items {
+		var link locationLink
+		if json.Unmarshal(item, &link) == nil && link.TargetURI != "" {
+			locations = append(locations, location{URI: link.TargetURI, Range: link.TargetSelectionRange})
+			continue
+		}
+		var l location
+		if json.Unmarshal(item, &l) == nil && l.URI != "" {
+			locations = append(locations, l)
+		}
+	}
+	return locations
+}
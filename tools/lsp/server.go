@@ -0,0 +1,88 @@
+package lsp
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Server configures a language server for the files with certain extensions.
+type Server struct {
+	// Extensions are the file extensions without dot, e.g. "py" and "pyi".
+	Extensions []string
+	// Command starts the server speaking the protocol on stdin and stdout.
+	Command []string
+}
+
+// ParseServer parses a server like `py,pyi=pyright-langserver --stdio`. Words of the
+// command are separated by white space.
+func ParseServer(s string) (Server, error) {
+	exts, cmd, ok := strings.Cut(s, "=")
+	if !ok {
+		return Server{}, fmt.Errorf("invalid language server '%s', use EXT,...=COMMAND like 'go=gopls'", s)
+	}
+	var server Server
+	for _, ext := range strings.Split(exts, ",") {
+		ext = strings.TrimPrefix(strings.TrimSpace(ext), ".")
+		if ext == "" || strings.ContainsAny(ext, `/\ `) {
+			return Server{}, fmt.Errorf("invalid extension '%s' in language server '%s'", ext, s)
+		}
+		server.Extensions = append(server.Extensions, ext)
+	}
+	server.Command = strings.Fields(cmd)
+	if len(server.Command) == 0 {
+		return Server{}, fmt.Errorf("missing command in language server '%s'", s)
+	}
+	return server, nil
+}
+
+func (s Server) String() string {
+	return strings.Join(s.Extensions, ",") + "=" + strings.Join(s.Command, " ")
+}
+
+// Name returns the name of the executable, e.g. for log messages.
+func (s Server) Name() string {
+	return filepath.Base(s.Command[0])
+}
+
+// Servers is a flag.Value collecting the language servers of a repeatable flag.
+type Servers []Server
+
+func (s *Servers) String() string {
+	var servers []string
+	for _, server := range *s {
+		servers = append(servers, server.String())
+	}
+	return strings.Join(servers, "; ")
+}
+
+// Set adds a server parsed by [ParseServer]. Extensions of earlier servers take precedence.
+func (s *Servers) Set(v string) error {
+	server, err := ParseServer(v)
+	if err != nil {
+		return err
+	}
+	*s = append(*s, server)
+	return nil
+}
+
+// find returns the index of the server responsible for path.
+func (s Servers) find(path string) (int, bool) {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	for i, server := range s {
+		if slices.Contains(server.Extensions, ext) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Extensions returns the extensions of all servers.
+func (s Servers) Extensions() []string {
+	var exts []string
+	for _, server := range s {
+		exts = append(exts, server.Extensions...)
+	}
+	return exts
+}
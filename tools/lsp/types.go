@@ -0,0 +1,100 @@
+package lsp
+
+// PositionArgs are the arguments for the lsp_hover and lsp_definition tools.
+type PositionArgs struct {
+	Path   string `json:"path" jsonschema:"the relative path of the file"`
+	Line   int    `json:"line" jsonschema:"the 1-based line"`
+	Column int    `json:"column" jsonschema:"the 1-based column in bytes, e.g. of the first character of an identifier"`
+}
+
+// HoverResult is the result of the lsp_hover tool.
+type HoverResult struct {
+	Contents string `json:"contents" jsonschema:"the documentation and type information shown by the language server, usually markdown; empty if there is none"`
+}
+
+// Location is a position in a file.
+type Location struct {
+	File    string `json:"file" jsonschema:"the file relative to the working directory, or an absolute path outside of it"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	EndLine int    `json:"end_line"`
+	EndCol  int    `json:"end_column"`
+	Text    string `json:"text,omitempty" jsonschema:"the source line, only for files in the working directory"`
+}
+
+// LocationsResult is the result of the lsp_definition and lsp_references tools.
+type LocationsResult struct {
+	Locations []Location `json:"locations"`
+	Truncated bool       `json:"truncated,omitempty" jsonschema:"indicates whether there are more than 500 locations"`
+}
+
+// ReferencesArgs are the arguments for the lsp_references tool.
+type ReferencesArgs struct {
+	Path               string `json:"path" jsonschema:"the relative path of the file"`
+	Line               int    `json:"line" jsonschema:"the 1-based line"`
+	Column             int    `json:"column" jsonschema:"the 1-based column in bytes"`
+	IncludeDeclaration bool   `json:"include_declaration,omitempty" jsonschema:"also return the declaration of the symbol"`
+}
+
+// DiagnosticsArgs are the arguments for the lsp_diagnostics tool.
+type DiagnosticsArgs struct {
+	Path string `json:"path" jsonschema:"the relative path of the file"`
+}
+
+// Diagnostic is an error, warning or hint reported by a language server.
+type Diagnostic struct {
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"end_line"`
+	EndColumn int    `json:"end_column"`
+	Severity  string `json:"severity" jsonschema:"error, warning, information or hint"`
+	Source    string `json:"source,omitempty" jsonschema:"the tool which reported it, e.g. compiler or a linter"`
+	Code      string `json:"code,omitempty"`
+	Message   string `json:"message"`
+}
+
+// DiagnosticsResult is the result of the lsp_diagnostics tool.
+type DiagnosticsResult struct {
+	Diagnostics []Diagnostic `json:"diagnostics"`
+	TimedOut    bool         `json:"timed_out,omitempty" jsonschema:"indicates whether the server did not report diagnostics for the current content in time, so they may be outdated or missing"`
+}
+
+// RenameArgs are the arguments for the lsp_rename tool.
+type RenameArgs struct {
+	Path    string `json:"path" jsonschema:"the relative path of the file"`
+	Line    int    `json:"line" jsonschema:"the 1-based line"`
+	Column  int    `json:"column" jsonschema:"the 1-based column in bytes of the symbol to rename"`
+	NewName string `json:"new_name" jsonschema:"the new name of the symbol"`
+	Apply   bool   `json:"apply,omitempty" jsonschema:"write the changes; by default only the diff is returned"`
+}
+
+// EditResult is the result of tools changing files through a language server.
+type EditResult struct {
+	Files   []string `json:"files" jsonschema:"the changed files relative to the working directory"`
+	Diff    string   `json:"diff" jsonschema:"the unified diff of the changes"`
+	Applied bool     `json:"applied" jsonschema:"indicates whether the files were written"`
+}
+
+// CodeActionsArgs are the arguments for the lsp_code_actions tool.
+type CodeActionsArgs struct {
+	Path      string `json:"path" jsonschema:"the relative path of the file"`
+	Line      int    `json:"line" jsonschema:"the 1-based first line of the range"`
+	Column    int    `json:"column" jsonschema:"the 1-based first column in bytes of the range"`
+	EndLine   int    `json:"end_line,omitempty" jsonschema:"the last line of the range (default line)"`
+	EndColumn int    `json:"end_column,omitempty" jsonschema:"the column after the range (default column)"`
+	Apply     string `json:"apply,omitempty" jsonschema:"the title of the action to apply; by default the available actions are listed"`
+}
+
+// CodeAction is a quick fix or refactoring offered by a language server.
+type CodeAction struct {
+	Title     string `json:"title"`
+	Kind      string `json:"kind,omitempty" jsonschema:"e.g. quickfix, refactor.extract or source.organizeImports"`
+	Preferred bool   `json:"preferred,omitempty"`
+	Disabled  string `json:"disabled,omitempty" jsonschema:"the reason why the action cannot be applied"`
+}
+
+// CodeActionsResult is the result of the lsp_code_actions tool.
+type CodeActionsResult struct {
+	Actions []CodeAction `json:"actions,omitempty" jsonschema:"the available actions, if none was applied"`
+	Applied *EditResult  `json:"applied,omitempty" jsonschema:"the changes of the applied action"`
+}
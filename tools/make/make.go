@@ -2,49 +2,189 @@ package make
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"fmt"
-	"os/exec"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/seb-schulz/mcpilot-pair/internal/runner"
+	"github.com/seb-schulz/mcpilot-pair/internal/sandbox"
+	"github.com/seb-schulz/mcpilot-pair/tools/filesystem"
 )
 
-var allowedTargets = map[string]bool{
-	"all":   true,
-	"build": true,
-	"test":  true,
-	"clean": true,
+// DefaultTimeout is the time a make run may take unless configured otherwise.
+const DefaultTimeout = 10 * time.Minute
+
+// Runner runs make targets permitted by its policy.
+type Runner struct {
+	Policy Policy
+	// Timeout is the maximum duration of a run. Calls may ask for a shorter one.
+	Timeout time.Duration
+	// Env decides the environment of make.
+	Env runner.EnvPolicy
+	// Sandbox confines make if not nil.
+	Sandbox *sandbox.Config
 }
 
-// RunMake executes `make -C <directory> <target>` in a bash environment.
-func RunMake(ctx context.Context, args RunMakeArgs) (RunMakeResult, error) {
-	// Validate target
-	if !allowedTargets[args.Target] {
-		return RunMakeResult{}, fmt.Errorf("target '%s' is not allowed", args.Target)
+// NewRunner returns a Runner enforcing policy with the default timeout and environment.
+func NewRunner(policy Policy) *Runner {
+	return &Runner{Policy: policy, Timeout: DefaultTimeout, Env: runner.DefaultEnvPolicy()}
+}
+
+// ListTargets returns the targets of the Makefile in the given directory and whether they may be run.
+func (r *Runner) ListTargets(ctx context.Context, args ListTargetsArgs) (ListTargetsResult, error) {
+	dir, err := filesystem.ResolveDirectory(ctx, args.Directory)
+	if err != nil {
+		return ListTargetsResult{}, err
+	}
+	targets, err := readTargets(dir)
+	if err != nil {
+		return ListTargetsResult{}, err
+	}
+	for i := range targets {
+		targets[i].Allowed = r.Policy.Allowed(targets[i].Name)
 	}
+	return ListTargetsResult{Targets: targets}, nil
+}
 
-	// Build command
-	cmd := exec.Command("bash", "-c", "make -C "+args.Directory+" "+args.Target)
+// OutputFunc receives the output of a running make line by line. stream is "stdout" or "stderr".
+// It may be called concurrently for both streams.
+type OutputFunc func(stream, line string)
 
+// RunMake executes `make -C <directory> <target>`.
+// make is invoked directly without a shell, and the directory is confined to the working directory.
+// The target has to be defined in the Makefile and permitted by the policy.
+// When the timeout expires or ctx is cancelled, make and all its child processes are killed.
+// If output is not nil, it receives each line while make is running.
+func (r *Runner) RunMake(ctx context.Context, args RunMakeArgs, output OutputFunc) (RunMakeResult, error) {
 	var stdoutBuf, stderrBuf bytes.Buffer
-	cmd.Stdout = &stdoutBuf
-	cmd.Stderr = &stderrBuf
-
-	// Run command
-	err := cmd.Run()
+	var stdout, stderr io.Writer = &stdoutBuf, &stderrBuf
+	flush := func() {}
+	if output != nil {
+		stdoutLines := runner.NewLineWriter(func(line string) { output("stdout", line) })
+		stderrLines := runner.NewLineWriter(func(line string) { output("stderr", line) })
+		stdout = io.MultiWriter(&stdoutBuf, stdoutLines)
+		stderr = io.MultiWriter(&stderrBuf, stderrLines)
+		flush = func() {
+			stdoutLines.Flush()
+			stderrLines.Flush()
+		}
+	}
 
-	// Capture exit code
-	exitCode := 0
+	status, err := r.run(ctx, args, stdout, stderr)
+	flush()
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-		} else {
-			return RunMakeResult{}, fmt.Errorf("command failed: %v", err)
-		}
+		return RunMakeResult{}, err
 	}
 
 	return RunMakeResult{
 		Stdout:   stdoutBuf.String(),
 		Stderr:   stderrBuf.String(),
-		Success:  err == nil,
-		ExitCode: exitCode,
+		Success:  status.ExitCode == 0,
+		ExitCode: status.ExitCode,
+		TimedOut: status.TimedOut,
+		Canceled: status.Canceled,
 	}, nil
 }
+
+// Stream executes make like [Runner.RunMake], but only passes the output line by line to
+// output without keeping it, so long-running targets do not accumulate their output.
+func (r *Runner) Stream(ctx context.Context, args RunMakeArgs, output OutputFunc) (runner.Status, error) {
+	stdoutLines := runner.NewLineWriter(func(line string) { output("stdout", line) })
+	stderrLines := runner.NewLineWriter(func(line string) { output("stderr", line) })
+	status, err := r.run(ctx, args, stdoutLines, stderrLines)
+	stdoutLines.Flush()
+	stderrLines.Flush()
+	return status, err
+}
+
+// run executes make, writing its output to stdout and stderr.
+func (r *Runner) run(ctx context.Context, args RunMakeArgs, stdout, stderr io.Writer) (runner.Status, error) {
+	dir, err := r.validate(ctx, args)
+	if err != nil {
+		return runner.Status{}, err
+	}
+
+	env, err := r.Env.Environ(os.Environ(), args.Env)
+	if err != nil {
+		return runner.Status{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout(args.TimeoutSeconds))
+	defer cancel()
+
+	// Build command
+	cmd := runner.Command(ctx, "make", "-C", dir, args.Target)
+	cmd.Env = env
+	if err := r.Sandbox.Wrap(cmd); err != nil {
+		return runner.Status{}, err
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// Run command
+	return runner.Run(ctx, cmd)
+}
+
+// Validate checks that make may run the target in the directory, without running it.
+func (r *Runner) Validate(ctx context.Context, args RunMakeArgs) error {
+	_, err := r.validate(ctx, args)
+	return err
+}
+
+// validate checks the arguments and returns the resolved directory.
+func (r *Runner) validate(ctx context.Context, args RunMakeArgs) (string, error) {
+	// Validate target
+	if !targetName.MatchString(args.Target) {
+		return "", fmt.Errorf("invalid target '%s'", args.Target)
+	}
+	if !r.Policy.Allowed(args.Target) {
+		return "", fmt.Errorf("target '%s' is not allowed", args.Target)
+	}
+
+	dir, err := filesystem.ResolveDirectory(ctx, args.Directory)
+	if err != nil {
+		return "", err
+	}
+	targets, err := readTargets(dir)
+	if err != nil {
+		return "", err
+	}
+	if !slices.ContainsFunc(targets, func(t Target) bool { return t.Name == args.Target }) {
+		return "", fmt.Errorf("target '%s' is not defined in the Makefile, use make_list_targets to see the available targets", args.Target)
+	}
+	if err := r.Env.Check(args.Env); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// timeout returns the timeout of a run, limited to the configured one.
+func (r *Runner) timeout(seconds int) time.Duration {
+	timeout := cmp.Or(r.Timeout, DefaultTimeout)
+	if requested := time.Duration(seconds) * time.Second; requested > 0 && requested < timeout {
+		return requested
+	}
+	return timeout
+}
+
+// readTargets parses the Makefile in dir.
+func readTargets(dir string) ([]Target, error) {
+	path, err := findMakefile(dir)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	targets, err := parseTargets(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", path, err)
+	}
+	return targets, nil
+}
@@ -0,0 +1,234 @@
+package make
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setupWorkspace creates a temporary working directory with a Makefile and changes into it.
+func setupWorkspace(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	oldwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current working directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(oldwd) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change working directory: %v", err)
+	}
+
+	makefile := "test: ## Run the tests\n\t@echo running test in $(CURDIR) $(VERBOSE)$(GITHUB_TOKEN)\n\ndeploy:\n\t@touch deployed\n\nhang:\n\t@sleep 30\n"
+	if err := os.WriteFile("Makefile", []byte(makefile), 0644); err != nil {
+		t.Fatalf("Failed to create Makefile: %v", err)
+	}
+	if err := os.Mkdir("sub", 0755); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join("sub", "Makefile"), []byte(makefile), 0644); err != nil {
+		t.Fatalf("Failed to create Makefile: %v", err)
+	}
+	return dir
+}
+
+func TestRunMake(t *testing.T) {
+	dir := setupWorkspace(t)
+
+	tests := []struct {
+		name      string
+		directory string
+		wantDir   string
+	}{
+		{"Root directory", "", dir},
+		{"Explicit root directory", ".", dir},
+		{"Subdirectory", "sub", filepath.Join(dir, "sub")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := NewRunner(DefaultPolicy()).RunMake(context.Background(), RunMakeArgs{Target: "test", Directory: tc.directory}, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			wantDir, _ := filepath.EvalSymlinks(tc.wantDir)
+			if !result.Success || !strings.Contains(result.Stdout, "running test in "+wantDir) {
+				t.Errorf("Unexpected result: %+v", result)
+			}
+		})
+	}
+}
+
+// TestRunMakeHostileInput makes sure that arguments are never interpreted by a shell.
+func TestRunMakeHostileInput(t *testing.T) {
+	setupWorkspace(t)
+
+	tests := []struct {
+		name      string
+		target    string
+		directory string
+	}{
+		{"Command separator in directory", "test", ". ; touch pwned"},
+		{"Command substitution in directory", "test", "$(touch pwned)"},
+		{"Backticks in directory", "test", "`touch pwned`"},
+		{"Pipe in directory", "test", ". | touch pwned"},
+		{"Newline in directory", "test", ".\ntouch pwned"},
+		{"Option in directory", "test", "--eval=$(shell touch pwned)"},
+		{"Path traversal", "test", ".."},
+		{"Absolute path outside", "test", "/"},
+		{"Dot directory", "test", ".git"},
+		{"Command separator in target", "test; touch pwned", ""},
+		{"Option as target", "--eval=$(shell touch pwned)", ""},
+		{"Variable override as target", "SHELL=/bin/touch", ""},
+		{"Undefined target", "pwned", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewRunner(DefaultPolicy()).RunMake(context.Background(), RunMakeArgs{Target: tc.target, Directory: tc.directory}, nil)
+			if err == nil {
+				t.Errorf("Expected error for target %q in directory %q", tc.target, tc.directory)
+			}
+			if _, err := os.Stat("pwned"); err == nil {
+				t.Fatalf("Hostile input was executed")
+			}
+		})
+	}
+}
+
+func TestRunMakeOutput(t *testing.T) {
+	setupWorkspace(t)
+
+	var mu sync.Mutex
+	var lines []string
+	result, err := NewRunner(DefaultPolicy()).RunMake(context.Background(), RunMakeArgs{Target: "test"}, func(stream, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, stream+": "+line)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !slices.ContainsFunc(lines, func(l string) bool { return strings.HasPrefix(l, "stdout: running test in ") }) {
+		t.Errorf("Unexpected output lines: %q", lines)
+	}
+	if !strings.Contains(result.Stdout, "running test in ") {
+		t.Errorf("Output is missing from result: %+v", result)
+	}
+}
+
+func TestStream(t *testing.T) {
+	setupWorkspace(t)
+
+	var mu sync.Mutex
+	var lines []string
+	status, err := NewRunner(DefaultPolicy()).Stream(context.Background(), RunMakeArgs{Target: "test"}, func(stream, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, stream+": "+line)
+	})
+	if err != nil || status.ExitCode != 0 {
+		t.Fatalf("Unexpected result: %+v (%v)", status, err)
+	}
+	if !slices.ContainsFunc(lines, func(l string) bool { return strings.HasPrefix(l, "stdout: running test in ") }) {
+		t.Errorf("Unexpected output lines: %q", lines)
+	}
+
+	if _, err := NewRunner(DefaultPolicy()).Stream(context.Background(), RunMakeArgs{Target: "missing"}, func(stream, line string) {}); err == nil {
+		t.Error("Expected an error for an undefined target")
+	}
+}
+
+func TestRunMakeTimeout(t *testing.T) {
+	setupWorkspace(t)
+
+	runner := &Runner{Policy: Policy{Allow: []string{"hang"}}, Timeout: time.Minute}
+	start := time.Now()
+	result, err := runner.RunMake(context.Background(), RunMakeArgs{Target: "hang", TimeoutSeconds: 1}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.TimedOut || result.Success || result.ExitCode != -1 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("RunMake returned after %v", elapsed)
+	}
+
+	if timeout := runner.timeout(3600); timeout != time.Minute {
+		t.Errorf("Requested timeout exceeds configured one: %v", timeout)
+	}
+}
+
+func TestRunMakePolicy(t *testing.T) {
+	setupWorkspace(t)
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		target  string
+		allowed bool
+	}{
+		{"Default policy", DefaultPolicy(), "test", true},
+		{"Denied by default", DefaultPolicy(), "deploy", false},
+		{"Not allowed by default", DefaultPolicy(), "hang", false},
+		{"Not in allow list", Policy{Allow: []string{"build"}}, "test", false},
+		{"Allowed by pattern", Policy{Allow: []string{"te*"}}, "test", true},
+		{"Deny wins", Policy{Allow: []string{"*"}, Deny: []string{"test"}}, "test", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewRunner(tc.policy).RunMake(context.Background(), RunMakeArgs{Target: tc.target}, nil)
+			if (err == nil) != tc.allowed {
+				t.Errorf("Expected allowed=%v, got error %v", tc.allowed, err)
+			}
+		})
+	}
+	if _, err := os.Stat("deployed"); err == nil {
+		t.Errorf("Denied target was executed")
+	}
+	if widened := (Policy{Allow: append(DefaultPolicy().Allow, "ha*")}); !widened.Allowed("hang") {
+		t.Errorf("Widened policy does not allow hang")
+	}
+}
+
+func TestListTargets(t *testing.T) {
+	setupWorkspace(t)
+
+	result, err := NewRunner(DefaultPolicy()).ListTargets(context.Background(), ListTargetsArgs{Directory: "sub"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Target{
+		{Name: "deploy", Allowed: false},
+		{Name: "hang", Allowed: false},
+		{Name: "test", Help: "Run the tests", Allowed: true},
+	}
+	if !reflect.DeepEqual(result.Targets, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result.Targets)
+	}
+}
+
+func TestRunMakeEnv(t *testing.T) {
+	setupWorkspace(t)
+	t.Setenv("GITHUB_TOKEN", "s3cr3t")
+
+	result, err := NewRunner(DefaultPolicy()).RunMake(context.Background(), RunMakeArgs{Target: "test", Env: map[string]string{"VERBOSE": "loud"}}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(result.Stdout, "loud") || strings.Contains(result.Stdout, "s3cr3t") {
+		t.Errorf("Unexpected output: %q", result.Stdout)
+	}
+
+	if _, err := NewRunner(DefaultPolicy()).RunMake(context.Background(), RunMakeArgs{Target: "test", Env: map[string]string{"MAKEFLAGS": "--eval=x"}}, nil); err == nil {
+		t.Errorf("Expected error for variable which is not allowed")
+	}
+}
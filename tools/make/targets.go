@@ -0,0 +1,163 @@
+package make
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// makefileNames are the file names GNU make looks for, in order.
+var makefileNames = []string{"GNUmakefile", "makefile", "Makefile"}
+
+// targetName matches plain target names; anything else (options, variable assignments,
+// shell syntax) is never passed to make.
+var targetName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_./-]*$`)
+
+// Policy decides which make targets may be run. Patterns use the syntax of [path.Match].
+// A target is allowed if it matches an Allow pattern and no Deny pattern.
+type Policy struct {
+	Allow []string
+	Deny  []string
+}
+
+// DefaultPolicy allows the targets all, build, test and clean. Operators widen it with
+// their own patterns; targets publishing or installing artifacts stay denied.
+func DefaultPolicy() Policy {
+	return Policy{
+		Allow: []string{"all", "build", "test", "clean"},
+		Deny:  []string{"install", "install-*", "uninstall", "deploy", "deploy-*", "publish", "publish-*", "release", "release-*", "push", "push-*"},
+	}
+}
+
+// Allowed reports whether target may be run.
+func (p Policy) Allowed(target string) bool {
+	return matchAny(p.Allow, target) && !matchAny(p.Deny, target)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// findMakefile returns the path of the Makefile make would use in dir.
+func findMakefile(dir string) (string, error) {
+	for _, name := range makefileNames {
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no Makefile found in %s", dir)
+}
+
+// parseTargets extracts the explicit targets of a Makefile together with their help comments.
+// A help comment is either a trailing `## text` on the rule line or a `## text` line directly
+// above the rule. Pattern rules, special targets and targets built from variables are skipped.
+// The Makefile is only parsed, never evaluated.
+func parseTargets(r io.Reader) ([]Target, error) {
+	seen := make(map[string]int)
+	var targets []Target
+	var help []string
+	inDefine := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Join continuation lines
+		for strings.HasSuffix(line, "\\") && scanner.Scan() {
+			line = strings.TrimSuffix(line, "\\") + " " + strings.TrimSpace(scanner.Text())
+		}
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case inDefine:
+			inDefine = !strings.HasPrefix(trimmed, "endef")
+			continue
+		case strings.HasPrefix(trimmed, "define ") || trimmed == "define":
+			inDefine = true
+			help = nil
+			continue
+		case strings.HasPrefix(line, "\t"):
+			// Recipe line
+			continue
+		case strings.HasPrefix(trimmed, "##"):
+			help = append(help, strings.TrimSpace(strings.TrimPrefix(trimmed, "##")))
+			continue
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			help = nil
+			continue
+		}
+
+		names, comment, ok := parseRule(line)
+		if !ok {
+			help = nil
+			continue
+		}
+		if comment == "" {
+			comment = strings.Join(help, " ")
+		}
+		help = nil
+
+		for _, name := range names {
+			if i, ok := seen[name]; ok {
+				if targets[i].Help == "" {
+					targets[i].Help = comment
+				}
+				continue
+			}
+			seen[name] = len(targets)
+			targets = append(targets, Target{Name: name, Help: comment})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+	return targets, nil
+}
+
+// parseRule splits a rule line `targets: prerequisites ## help` into its target names and help text.
+func parseRule(line string) (names []string, help string, ok bool) {
+	if i := strings.Index(line, "##"); i >= 0 {
+		help = strings.TrimSpace(line[i+2:])
+		line = line[:i]
+	} else if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+
+	colon := strings.Index(line, ":")
+	if colon <= 0 {
+		return nil, "", false
+	}
+	head, rest := line[:colon], line[colon+1:]
+	// Variable assignments (`X := y`, `X ::= y`) and target-specific variables (`t: X = y`)
+	if strings.ContainsAny(head, "=") || strings.HasPrefix(rest, "=") || strings.HasPrefix(rest, ":=") {
+		return nil, "", false
+	}
+	if strings.Contains(strings.SplitN(rest, ";", 2)[0], "=") {
+		return nil, "", false
+	}
+	for _, keyword := range []string{"ifeq", "ifneq", "ifdef", "ifndef", "else", "endif", "include", "-include", "sinclude", "export", "override", "vpath"} {
+		if f := strings.Fields(head); len(f) > 0 && f[0] == keyword {
+			return nil, "", false
+		}
+	}
+
+	for _, name := range strings.Fields(head) {
+		if strings.HasPrefix(name, ".") || strings.ContainsAny(name, "%$()") || !targetName.MatchString(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, help, len(names) > 0
+}
@@ -0,0 +1,77 @@
+package make
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTargets(t *testing.T) {
+	makefile := `GO ?= go
+VERSION := $(shell git describe)
+BIN = bin/$(NAME)
+
+.PHONY: all build test vet
+
+## Build and test everything
+all: build test
+
+build: ## Compile the binary
+	$(GO) build ./...
+
+# not a help comment
+test vet: build ## Run the checks
+	$(GO) test ./...
+
+test: GOFLAGS = -race
+
+%.o: %.c
+	cc -c $<
+
+$(BIN): build
+
+define RECIPE
+fake: target
+endef
+
+ifeq ($(GO),go)
+generate: \
+		build
+	$(GO) generate ./...
+endif
+
+run: ; ./bin/app # inline recipe
+`
+	targets, err := parseTargets(strings.NewReader(makefile))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Target{
+		{Name: "all", Help: "Build and test everything"},
+		{Name: "build", Help: "Compile the binary"},
+		{Name: "generate"},
+		{Name: "run"},
+		{Name: "test", Help: "Run the checks"},
+		{Name: "vet", Help: "Run the checks"},
+	}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, targets)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy := Policy{Allow: []string{"*"}, Deny: []string{"deploy", "release-*"}}
+	for target, expected := range map[string]bool{
+		"test":         true,
+		"deploy":       false,
+		"deploy-local": true,
+		"release-prod": false,
+	} {
+		if got := policy.Allowed(target); got != expected {
+			t.Errorf("Allowed(%q) = %v, expected %v", target, got, expected)
+		}
+	}
+	if (Policy{}).Allowed("test") {
+		t.Errorf("Empty policy must not allow anything")
+	}
+}
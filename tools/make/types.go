@@ -2,8 +2,10 @@ package make
 
 // RunMakeArgs are the arguments for the run_make tool.
 type RunMakeArgs struct {
-	Target    string `json:"target" jsonschema:"the make target to execute (e.g., 'all', 'build', 'test')"`
-	Directory string `json:"directory,omitempty" jsonschema:"The optional relative path to execute the make command. If omitted, the root directory is used. Only specify if you explicitly want to run make in a subdirectory"`
+	Target         string            `json:"target" jsonschema:"the make target to execute (e.g., 'all', 'build', 'test')"`
+	Directory      string            `json:"directory,omitempty" jsonschema:"The optional relative path to execute the make command. If omitted, the root directory is used. Only specify if you explicitly want to run make in a subdirectory"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty" jsonschema:"The optional timeout in seconds after which make is killed. It cannot exceed the timeout configured on the server"`
+	Env            map[string]string `json:"env,omitempty" jsonschema:"the optional environment variables to set, e.g. {\"GOFLAGS\": \"-v\"}; only variables approved by the server are accepted"`
 }
 
 // RunMakeResult is the result of the run_make tool.
@@ -11,5 +13,25 @@ type RunMakeResult struct {
 	Stdout   string `json:"stdout" jsonschema:"the standard output of the make command"`
 	Stderr   string `json:"stderr" jsonschema:"the standard error output of the make command"`
 	Success  bool   `json:"success" jsonschema:"indicates whether the make command executed successfully"`
-	ExitCode int    `json:"exit_code" jsonschema:"the exit code of the make command"`
+	ExitCode int    `json:"exit_code" jsonschema:"the exit code of the make command, -1 if it was killed"`
+	TimedOut bool   `json:"timed_out,omitempty" jsonschema:"indicates whether the make command was killed because it exceeded the timeout"`
+	Canceled bool   `json:"canceled,omitempty" jsonschema:"indicates whether the make command was killed because the tool call was cancelled"`
+	OutputID string `json:"output_id,omitempty" jsonschema:"set if stdout or stderr were shortened; the full output is available as resources run://<output_id>/stdout and run://<output_id>/stderr"`
+}
+
+// ListTargetsArgs are the arguments for the make_list_targets tool.
+type ListTargetsArgs struct {
+	Directory string `json:"directory,omitempty" jsonschema:"The optional relative path of the directory containing the Makefile. If omitted, the root directory is used"`
+}
+
+// Target is a target defined in a Makefile.
+type Target struct {
+	Name    string `json:"name" jsonschema:"the name of the target"`
+	Help    string `json:"help,omitempty" jsonschema:"the help text from the ## comment of the target"`
+	Allowed bool   `json:"allowed" jsonschema:"indicates whether make_run may run the target"`
+}
+
+// ListTargetsResult is the result of the make_list_targets tool.
+type ListTargetsResult struct {
+	Targets []Target `json:"targets" jsonschema:"the targets defined in the Makefile"`
 }